@@ -1,3 +1,14 @@
 var hooks = require('hooks');
 var http = require('http');
 var fs = require('fs');
+
+// Endpoints of optional features, which are disabled in the Dredd environment
+var optionalEndpoints = ['/claim-check/'];
+
+hooks.beforeEach(function (transaction) {
+    optionalEndpoints.forEach(function (prefix) {
+        if (transaction.request.uri.indexOf(prefix) === 0) {
+            transaction.skip = true;
+        }
+    });
+});
@@ -0,0 +1,101 @@
+// Package audit keeps a bounded in-memory log of the recent decisions taken on the published content.
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// Entry types
+const (
+	PolicySkip = "policy-skip"
+	// ForceOverride is a force request changing the topic, the headers or the origin of the forced message.
+	ForceOverride = "force-override"
+	// ForceBypass is a force request bypassing the force policy.
+	ForceBypass = "force-bypass"
+)
+
+type Entry struct {
+	Time          time.Time `json:"time"`
+	Type          string    `json:"type"`
+	UUID          string    `json:"uuid,omitempty"`
+	TransactionID string    `json:"transactionId,omitempty"`
+	Policy        string    `json:"policy,omitempty"`
+	Reasons       []string  `json:"reasons,omitempty"`
+	DecisionID    string    `json:"decisionId,omitempty"`
+	// Caller is the authenticated caller who requested a force override or bypass.
+	Caller    string            `json:"caller,omitempty"`
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// Filter selects the entries returned by Log.Entries. Empty fields match all the entries.
+type Filter struct {
+	Type          string
+	UUID          string
+	TransactionID string
+	Policy        string
+	// Limit is the maximum number of returned entries. Zero means no limit.
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	return (f.Type == "" || f.Type == e.Type) &&
+		(f.UUID == "" || f.UUID == e.UUID) &&
+		(f.TransactionID == "" || f.TransactionID == e.TransactionID) &&
+		(f.Policy == "" || f.Policy == e.Policy)
+}
+
+// Log is a ring buffer of the most recent entries. It is safe for concurrent use.
+type Log struct {
+	mu      sync.RWMutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+func NewLog(size int) *Log {
+	return &Log{entries: make([]Entry, size)}
+}
+
+// Record adds the entry, replacing the oldest one if the log is full. Entries without a time are recorded at the current time.
+func (l *Log) Record(e Entry) {
+	if len(l.entries) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Entries returns the entries matching the filter, the most recent first.
+func (l *Log) Entries(f Filter) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.entries)
+	}
+
+	result := []Entry{}
+	for i := 1; i <= count; i++ {
+		e := l.entries[(l.next-i+len(l.entries))%len(l.entries)]
+		if !f.matches(e) {
+			continue
+		}
+		result = append(result, e)
+		if f.Limit > 0 && len(result) == f.Limit {
+			break
+		}
+	}
+	return result
+}
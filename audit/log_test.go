@@ -0,0 +1,64 @@
+package audit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogEntries(t *testing.T) {
+	l := NewLog(3)
+	assert.Empty(t, l.Entries(Filter{}))
+
+	for i := 0; i < 4; i++ {
+		l.Record(Entry{Type: PolicySkip, UUID: fmt.Sprintf("uuid-%d", i), Policy: []string{"kafka_ingest_content", "kafka_ingest_metadata"}[i%2]})
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{name: "oldest entry is replaced", filter: Filter{}, expected: []string{"uuid-3", "uuid-2", "uuid-1"}},
+		{name: "by uuid", filter: Filter{UUID: "uuid-2"}, expected: []string{"uuid-2"}},
+		{name: "by policy", filter: Filter{Policy: "kafka_ingest_metadata"}, expected: []string{"uuid-3", "uuid-1"}},
+		{name: "by type", filter: Filter{Type: "force-bypass"}, expected: []string{}},
+		{name: "limit", filter: Filter{Limit: 2}, expected: []string{"uuid-3", "uuid-2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uuids := []string{}
+			for _, e := range l.Entries(test.filter) {
+				assert.False(t, e.Time.IsZero())
+				uuids = append(uuids, e.UUID)
+			}
+			assert.Equal(t, test.expected, uuids)
+		})
+	}
+}
+
+func TestLogRecord_Concurrent(t *testing.T) {
+	l := NewLog(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Record(Entry{Type: PolicySkip})
+			l.Entries(Filter{})
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, l.Entries(Filter{}), 10)
+}
+
+func TestLogRecord_Disabled(t *testing.T) {
+	l := NewLog(0)
+	l.Record(Entry{Type: PolicySkip})
+	assert.Empty(t, l.Entries(Filter{}))
+}
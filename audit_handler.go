@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+)
+
+type auditReader interface {
+	Entries(f audit.Filter) []audit.Entry
+}
+
+type auditHandler struct {
+	audit auditReader
+	log   *logger.UPPLogger
+}
+
+func (h *auditHandler) getEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Type:          query.Get("type"),
+		UUID:          query.Get("uuid"),
+		TransactionID: query.Get("transactionId"),
+		Policy:        query.Get("policy"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		filter.Limit = l
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(h.audit.Entries(filter)); err != nil {
+		h.log.WithError(err).Error("Failed to write the audit entries")
+	}
+}
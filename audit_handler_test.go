@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditHandler_GetEntries(t *testing.T) {
+	auditLog := audit.NewLog(10)
+	auditLog.Record(audit.Entry{Type: audit.PolicySkip, UUID: "uuid-1", TransactionID: "tid_1", Policy: "kafka_ingest_content", Reasons: []string{"reason"}})
+	auditLog.Record(audit.Entry{Type: audit.PolicySkip, UUID: "uuid-2", TransactionID: "tid_2", Policy: "kafka_ingest_metadata"})
+	auditLog.Record(audit.Entry{Type: audit.PolicySkip, UUID: "uuid-2", TransactionID: "tid_3", Policy: "kafka_ingest_force"})
+
+	h := &auditHandler{audit: auditLog, log: logger.NewUPPLogger("TEST", "PANIC")}
+
+	tests := []struct {
+		query    string
+		status   int
+		expected []string
+	}{
+		{query: "", status: http.StatusOK, expected: []string{"tid_3", "tid_2", "tid_1"}},
+		{query: "?uuid=uuid-2", status: http.StatusOK, expected: []string{"tid_3", "tid_2"}},
+		{query: "?transactionId=tid_1", status: http.StatusOK, expected: []string{"tid_1"}},
+		{query: "?policy=kafka_ingest_force&type=policy-skip", status: http.StatusOK, expected: []string{"tid_3"}},
+		{query: "?limit=1", status: http.StatusOK, expected: []string{"tid_3"}},
+		{query: "?uuid=unknown", status: http.StatusOK, expected: []string{}},
+		{query: "?limit=many", status: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.getEntries(w, httptest.NewRequest(http.MethodGet, "/__audit"+test.query, nil))
+
+			assert.Equal(t, test.status, w.Code)
+			if test.status != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+			var entries []audit.Entry
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &entries))
+			tids := []string{}
+			for _, e := range entries {
+				tids = append(tids, e.TransactionID)
+			}
+			assert.Equal(t, test.expected, tids)
+		})
+	}
+}
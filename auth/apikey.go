@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+)
+
+const APIKeyHeader = "X-Api-Key"
+
+// APIKeys authenticates the requests with static keys, sent in the X-Api-Key header.
+type APIKeys struct {
+	// keys maps the API keys to the IDs of their callers.
+	keys map[string]string
+}
+
+func NewAPIKeys(keys map[string]string) *APIKeys {
+	return &APIKeys{keys: keys}
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (Caller, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		return Caller{}, ErrNoCredentials
+	}
+
+	// All the keys are compared, so that the time taken doesn't tell how much of a key matched.
+	var caller string
+	for k, id := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			caller = id
+		}
+	}
+	if caller == "" {
+		return Caller{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+
+	return Caller{ID: caller, Method: MethodAPIKey}, nil
+}
@@ -0,0 +1,89 @@
+// Package auth authenticates the callers of the service endpoints and limits the rate of their requests.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+var (
+	// ErrNoCredentials is returned by the authenticators if the request has no credentials of their kind.
+	ErrNoCredentials      = errors.New("no credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrBodyTooLarge is returned if the body of a signed request is too large to check its signature.
+	ErrBodyTooLarge = errors.New("request body too large")
+)
+
+// Caller is an authenticated client of the service.
+type Caller struct {
+	ID string
+	// Method is the authentication method the caller was authenticated with.
+	Method string
+}
+
+// Authentication methods
+const (
+	MethodAPIKey = "api-key"
+	MethodHMAC   = "hmac"
+	MethodJWT    = "jwt"
+)
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (Caller, error)
+}
+
+// Chain tries the authenticators in order, until one finds credentials of its kind in the request.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (Caller, error) {
+	for _, a := range c {
+		caller, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return caller, err
+	}
+	return Caller{}, ErrNoCredentials
+}
+
+type callerKey struct{}
+
+// CallerFromContext returns the caller authenticated by the middleware.
+func CallerFromContext(ctx context.Context) (Caller, bool) {
+	c, ok := ctx.Value(callerKey{}).(Caller)
+	return c, ok
+}
+
+// Middleware rejects the requests of unauthenticated callers with 401, the signed requests with a body too large to be checked with 413,
+// and the requests over the rate limit of the caller with 429.
+// The caller is added to the request context. A nil limiter disables the rate limits.
+func Middleware(a Authenticator, limiter *RateLimiter, log *logger.UPPLogger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			entry := log.WithTransactionID(r.Header.Get("X-Request-Id"))
+
+			caller, err := a.Authenticate(r)
+			if errors.Is(err, ErrBodyTooLarge) {
+				entry.WithError(err).WithField("path", r.URL.Path).Warn("Unauthenticated request")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				entry.WithError(err).WithField("path", r.URL.Path).Warn("Unauthenticated request")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			if limiter != nil && !limiter.Allow(caller.ID) {
+				entry.WithField("caller", caller.ID).Warn("Request over the rate limit of the caller")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), callerKey{}, caller)))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys(t *testing.T) {
+	a := NewAPIKeys(map[string]string{"key-1": "caller-1", "key-2": "caller-2"})
+
+	r := httptest.NewRequest(http.MethodPost, "/uuid", nil)
+	_, err := a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	r.Header.Set(APIKeyHeader, "key-2")
+	caller, err := a.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, Caller{ID: "caller-2", Method: MethodAPIKey}, caller)
+
+	r.Header.Set(APIKeyHeader, "key-3")
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestChain(t *testing.T) {
+	c := Chain{
+		NewHMAC(map[string]string{"hmac-caller": "secret"}),
+		NewAPIKeys(map[string]string{"key-1": "caller-1"}),
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/uuid", nil)
+	_, err := c.Authenticate(r)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+
+	r.Header.Set(APIKeyHeader, "key-1")
+	caller, err := c.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, "caller-1", caller.ID)
+
+	r.Header.Set("Authorization", "HMAC hmac-caller:wrong")
+	_, err = c.Authenticate(r)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "the first authenticator finding credentials decides")
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(1, 2, map[string]int{"unlimited": 0, "slow": 1})
+
+	assert.True(t, l.Allow("caller-1"))
+	assert.True(t, l.Allow("caller-1"))
+	assert.False(t, l.Allow("caller-1"), "the burst is used up")
+	assert.True(t, l.Allow("caller-2"), "the callers have separate limits")
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, l.Allow("unlimited"))
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	a := NewAPIKeys(map[string]string{"key-1": "caller-1"})
+	handler := Middleware(a, NewRateLimiter(60, 1, nil), logger.NewUPPLogger("TEST", "PANIC"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			caller, ok := CallerFromContext(r.Context())
+			require.True(t, ok)
+			_, _ = w.Write([]byte(caller.ID))
+		}),
+	)
+
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		body   string
+	}{
+		{name: "no credentials", status: http.StatusUnauthorized},
+		{name: "invalid credentials", key: "key-2", status: http.StatusUnauthorized},
+		{name: "authenticated", key: "key-1", status: http.StatusOK, body: "caller-1"},
+		{name: "over the rate limit", key: "key-1", status: http.StatusTooManyRequests},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/uuid", nil)
+			if test.key != "" {
+				r.Header.Set(APIKeyHeader, test.key)
+			}
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.body, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	hmacScheme = "HMAC "
+	// TimestampHeader holds the Unix time, in seconds, the request was signed at.
+	TimestampHeader = "X-Request-Timestamp"
+
+	defaultMaxSkew = 5 * time.Minute
+	// maxSignedBodySize limits the body read to check the signature, before the caller is authenticated.
+	// The bodies of the force requests are small JSON options.
+	maxSignedBodySize = 64 << 10
+)
+
+// HMAC authenticates the requests signed with a shared secret. The requests have the headers
+//
+//	Authorization: HMAC <key ID>:<hex encoded HMAC-SHA256 of the string to sign>
+//	X-Request-Timestamp: <Unix time in seconds>
+//
+// where the string to sign is the method, the request URI (the path and the query), the timestamp and the hex encoded SHA-256 of the body,
+// each on its own line. The ID of the caller is the key ID.
+// A signature is accepted once, the requests replaying it while its timestamp is still valid are rejected.
+type HMAC struct {
+	// secrets maps the key IDs to their secrets.
+	secrets map[string]string
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu sync.Mutex
+	// used maps the accepted signatures to the time their timestamp expires.
+	used map[string]time.Time
+}
+
+func NewHMAC(secrets map[string]string) *HMAC {
+	return &HMAC{
+		secrets: secrets,
+		maxSkew: defaultMaxSkew,
+		now:     time.Now,
+		used:    map[string]time.Time{},
+	}
+}
+
+func (a *HMAC) Authenticate(r *http.Request) (Caller, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, hmacScheme) {
+		return Caller{}, ErrNoCredentials
+	}
+
+	keyID, signature, ok := strings.Cut(strings.TrimPrefix(authorization, hmacScheme), ":")
+	if !ok {
+		return Caller{}, fmt.Errorf("%w: malformed HMAC authorization", ErrInvalidCredentials)
+	}
+	secret, ok := a.secrets[keyID]
+	if !ok {
+		return Caller{}, fmt.Errorf("%w: unknown HMAC key %q", ErrInvalidCredentials, keyID)
+	}
+
+	timestamp := r.Header.Get(TimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return Caller{}, fmt.Errorf("%w: invalid %s header", ErrInvalidCredentials, TimestampHeader)
+	}
+	signedAt := time.Unix(seconds, 0)
+	if skew := a.now().Sub(signedAt).Abs(); skew > a.maxSkew {
+		return Caller{}, fmt.Errorf("%w: the request was signed %s away from now", ErrInvalidCredentials, skew.Round(time.Second))
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return Caller{}, err
+	}
+
+	expected := Sign(secret, r.Method, r.URL.RequestURI(), timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return Caller{}, fmt.Errorf("%w: HMAC signature mismatch", ErrInvalidCredentials)
+	}
+	if !a.use(keyID+":"+signature, signedAt.Add(a.maxSkew)) {
+		return Caller{}, fmt.Errorf("%w: the HMAC signature was already used", ErrInvalidCredentials)
+	}
+
+	return Caller{ID: keyID, Method: MethodHMAC}, nil
+}
+
+// use records the signature until it expires. It returns false if the signature is already recorded.
+// The expired signatures are removed, as their timestamps are rejected anyway.
+func (a *HMAC) use(signature string, expires time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.now()
+	for s, e := range a.used {
+		if now.After(e) {
+			delete(a.used, s)
+		}
+	}
+	if _, ok := a.used[signature]; ok {
+		return false
+	}
+	a.used[signature] = expires
+	return true
+}
+
+// Sign returns the hex encoded signature of a request, with the request URI as sent, e.g. "/by-identifier?authority=a&identifierValue=b".
+func Sign(secret, method, requestURI, timestamp string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads the body of the request and replaces it, so that the handlers can read it again.
+// It returns ErrBodyTooLarge if the body is over maxSignedBodySize.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxSignedBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("%w: over %d bytes", ErrBodyTooLarge, tooLarge.Limit)
+		}
+		return nil, fmt.Errorf("error reading the request body: %w", err)
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHMAC(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := NewHMAC(map[string]string{"caller-1": "secret"})
+	a.now = func() time.Time { return now }
+
+	const (
+		body   = `{"topic":"ForcedCombinedPostPublicationEvents"}`
+		target = "/by-identifier?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFTCOM-METHODE&identifierValue=some-id"
+	)
+	signedTargetRequest := func(keyID, secret string, signedAt time.Time, signedTarget, signedBody string) *http.Request {
+		timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+		r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		r.Header.Set(TimestampHeader, timestamp)
+		r.Header.Set("Authorization", "HMAC "+keyID+":"+Sign(secret, http.MethodPost, signedTarget, timestamp, []byte(signedBody)))
+		return r
+	}
+	signedRequest := func(keyID, secret string, signedAt time.Time, signedBody string) *http.Request {
+		return signedTargetRequest(keyID, secret, signedAt, target, signedBody)
+	}
+
+	r := signedRequest("caller-1", "secret", now.Add(-time.Minute), body)
+	caller, err := a.Authenticate(r)
+	require.NoError(t, err)
+	assert.Equal(t, Caller{ID: "caller-1", Method: MethodHMAC}, caller)
+	b, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(b), "the body can be read again")
+
+	_, err = a.Authenticate(signedRequest("caller-1", "secret", now.Add(-time.Minute), body))
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "a signature can't be replayed")
+
+	tests := []struct {
+		name    string
+		request *http.Request
+	}{
+		{name: "unknown key", request: signedRequest("caller-2", "secret", now, body)},
+		{name: "wrong secret", request: signedRequest("caller-1", "other", now, body)},
+		{name: "changed body", request: signedRequest("caller-1", "secret", now, "{}")},
+		{name: "changed query", request: signedTargetRequest("caller-1", "secret", now, "/by-identifier?authority=other&identifierValue=some-id", body)},
+		{name: "path only", request: signedTargetRequest("caller-1", "secret", now, "/by-identifier", body)},
+		{name: "expired signature", request: signedRequest("caller-1", "secret", now.Add(-time.Hour), body)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := a.Authenticate(test.request)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	now = now.Add(10 * time.Minute)
+	_, err = a.Authenticate(signedRequest("caller-1", "secret", now, body))
+	require.NoError(t, err)
+	assert.Len(t, a.used, 1, "the expired signatures are removed")
+
+	large := strings.Repeat(" ", maxSignedBodySize+1)
+	r = signedRequest("caller-1", "secret", now, large)
+	r.Body = io.NopCloser(strings.NewReader(large))
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrBodyTooLarge)
+
+	r = httptest.NewRequest(http.MethodPost, "/some-uuid", nil)
+	r.Header.Set("Authorization", "Bearer token")
+	_, err = a.Authenticate(r)
+	assert.ErrorIs(t, err, ErrNoCredentials)
+}
+
+func TestMiddleware_SignedBodyTooLarge(t *testing.T) {
+	handler := Middleware(NewHMAC(map[string]string{"caller-1": "secret"}), nil, logger.NewUPPLogger("TEST", "PANIC"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("the request isn't authenticated")
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodPost, "/some-uuid", strings.NewReader(strings.Repeat(" ", maxSignedBodySize+1)))
+	r.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	r.Header.Set("Authorization", "HMAC caller-1:signature")
+	w := httptest.NewRecorder()
+
+	handler.ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	bearerScheme = "Bearer "
+	jwtLeeway    = time.Minute
+)
+
+// JWTValidator authenticates the requests with a JWT bearer token, signed by one of the keys of a local JWKS file.
+// The RS256, RS384, RS512, ES256 and ES384 algorithms are supported. The algorithm of a token must be one its key is meant for:
+// the alg of the key if it has one, any RS algorithm for the RSA keys, ES256 for the P-256 keys and ES384 for the P-384 ones.
+// The ID of the caller is the subject of the token.
+type JWTValidator struct {
+	keys     map[string]jwtKey
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// LoadJWTValidator reads the keys from the JWKS file. Empty issuer and audience aren't checked.
+func LoadJWTValidator(jwksFile, issuer, audience string) (*JWTValidator, error) {
+	b, err := os.ReadFile(jwksFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the JWKS file: %w", err)
+	}
+
+	keys, err := parseJWKS(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTValidator{
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		now:      time.Now,
+	}, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwtKey is a public key of the JWKS, with the algorithms the tokens it verifies can be signed with.
+type jwtKey struct {
+	key  crypto.PublicKey
+	algs []string
+}
+
+func parseJWKS(b []byte) (map[string]jwtKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("error parsing the JWKS: %w", err)
+	}
+
+	keys := map[string]jwtKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the JWKS key %q: %w", k.Kid, err)
+		}
+		algs, err := k.algorithms()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing the JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = jwtKey{key: key, algs: algs}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("the JWKS has no signing keys")
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// algorithms returns the algorithms matching the type and the curve of the key, restricted to its alg if it has one.
+func (k jwk) algorithms() ([]string, error) {
+	var algs []string
+	switch k.Kty {
+	case "RSA":
+		algs = []string{"RS256", "RS384", "RS512"}
+	case "EC":
+		algs = []string{map[string]string{"P-256": "ES256", "P-384": "ES384"}[k.Crv]}
+	}
+	if k.Alg == "" {
+		return algs, nil
+	}
+	if !slices.Contains(algs, k.Alg) {
+		return nil, fmt.Errorf("algorithm %q doesn't match the %s key", k.Alg, k.Kty)
+	}
+	return []string{k.Alg}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+}
+
+// jwtAudience is either a single audience or a list of them.
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (v *JWTValidator) Authenticate(r *http.Request) (Caller, error) {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, bearerScheme) {
+		return Caller{}, ErrNoCredentials
+	}
+
+	claims, err := v.validate(strings.TrimPrefix(authorization, bearerScheme))
+	if err != nil {
+		return Caller{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+
+	return Caller{ID: claims.Subject, Method: MethodJWT}, nil
+}
+
+func (v *JWTValidator) validate(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	key, ok := v.keys[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", header.Kid)
+	}
+	// The algorithm is checked before anything else is read from the token, which is still unverified.
+	if !slices.Contains(key.algs, header.Alg) {
+		return nil, fmt.Errorf("algorithm %q doesn't match the key %q", header.Alg, header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+	if err = verifySignature(header.Alg, key.key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if err = v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+func (v *JWTValidator) validateClaims(c *jwtClaims) error {
+	now := v.now()
+	if c.ExpiresAt == nil || now.After(time.Unix(*c.ExpiresAt, 0).Add(jwtLeeway)) {
+		return fmt.Errorf("the token has expired")
+	}
+	if c.NotBefore != nil && now.Before(time.Unix(*c.NotBefore, 0).Add(-jwtLeeway)) {
+		return fmt.Errorf("the token isn't valid yet")
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("the token has no subject")
+	}
+	if v.issuer != "" && c.Issuer != v.issuer {
+		return fmt.Errorf("unexpected issuer %q", c.Issuer)
+	}
+	if v.audience != "" {
+		for _, a := range c.Audience {
+			if a == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("the token isn't meant for %q", v.audience)
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("algorithm %q doesn't match the RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return fmt.Errorf("algorithm %q doesn't match the EC key", alg)
+		}
+		// The signature is the concatenation of r and s, each the size of the curve.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": kid}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, rsaKey *rsa.PublicKey, ecKey *ecdsa.PublicKey) string {
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "rsa-key", "kty": "RSA", "use": "sig", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kid": "ec-key", "kty": "EC", "crv": "P-256", "x": encode(ecKey.X), "y": encode(ecKey.Y)},
+		},
+	}
+
+	b, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	return path
+}
+
+func TestJWTValidator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	v, err := LoadJWTValidator(writeJWKS(t, &rsaKey.PublicKey, &ecKey.PublicKey), "https://issuer", "post-publication-combiner")
+	require.NoError(t, err)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	v.now = func() time.Time { return now }
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "reindexer",
+			"iss": "https://issuer",
+			"aud": []string{"other", "post-publication-combiner"},
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Hour).Unix(),
+		}
+		for k, val := range changes {
+			c[k] = val
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		caller string
+	}{
+		{name: "RS256", token: signRS256(t, rsaKey, "rsa-key", claims(nil)), caller: "reindexer"},
+		{name: "ES256", token: signES256(t, ecKey, "ec-key", claims(map[string]interface{}{"aud": "post-publication-combiner"})), caller: "reindexer"},
+		{name: "unknown key", token: signRS256(t, rsaKey, "other-key", claims(nil))},
+		{name: "wrong signing key", token: signRS256(t, otherKey, "rsa-key", claims(nil))},
+		{name: "algorithm not matching the key", token: signRS256(t, rsaKey, "ec-key", claims(nil))},
+		{name: "expired", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"exp": now.Add(-time.Hour).Unix()}))},
+		{name: "no expiry", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"exp": nil}))},
+		{name: "not valid yet", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"nbf": now.Add(time.Hour).Unix()}))},
+		{name: "other issuer", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"iss": "https://other"}))},
+		{name: "other audience", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"aud": "other"}))},
+		{name: "no subject", token: signRS256(t, rsaKey, "rsa-key", claims(map[string]interface{}{"sub": ""}))},
+		{name: "malformed", token: "not-a-token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/some-uuid", nil)
+			r.Header.Set("Authorization", "Bearer "+test.token)
+
+			caller, err := v.Authenticate(r)
+			if test.caller == "" {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, Caller{ID: test.caller, Method: MethodJWT}, caller)
+		})
+	}
+}
+
+func TestLoadJWTValidator_Errors(t *testing.T) {
+	_, err := LoadJWTValidator(filepath.Join(t.TempDir(), "missing.json"), "", "")
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [{"kid": "enc", "kty": "RSA", "use": "enc"}]}`), 0600))
+	_, err = LoadJWTValidator(path, "", "")
+	assert.EqualError(t, err, "the JWKS has no signing keys")
+}
+
+func TestJWTValidator_KeyAlgorithms(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kid": "rs512-key", "kty": "RSA", "alg": "RS512", "n": encode(rsaKey.N), "e": encode(big.NewInt(int64(rsaKey.E)))},
+			{"kid": "p384-key", "kty": "EC", "crv": "P-384", "x": encode(p384Key.X), "y": encode(p384Key.Y)},
+		},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+
+	v, err := LoadJWTValidator(path, "", "")
+	require.NoError(t, err)
+	claims := map[string]interface{}{"sub": "reindexer", "exp": time.Now().Add(time.Hour).Unix()}
+
+	// ES256 with a P-384 key: the signature is valid for the key, but not for the algorithm of the curve.
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "kid": "p384-key"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, p384Key, digest[:])
+	require.NoError(t, err)
+	token := signed + "." + base64.RawURLEncoding.EncodeToString(append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...))
+
+	tests := map[string]string{
+		"ES256 with a P-384 key":           token,
+		"RS256 with a key meant for RS512": signRS256(t, rsaKey, "rs512-key", claims),
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/some-uuid", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			_, err := v.Authenticate(req)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+			assert.ErrorContains(t, err, "doesn't match the key")
+		})
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys": [{"kid": "ec", "kty": "EC", "crv": "P-256", "alg": "RS256", "x": "AQ", "y": "AQ"}]}`), 0600))
+	_, err = LoadJWTValidator(path, "", "")
+	assert.ErrorContains(t, err, `algorithm "RS256" doesn't match the EC key`)
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// RateLimiter limits the rate of the requests of each caller separately.
+type RateLimiter struct {
+	perMinute int
+	burst     int
+	// overrides maps the IDs of the callers with their own limit to it, in requests per minute.
+	overrides map[string]int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// NewRateLimiter allows perMinute requests per minute to every caller, and up to burst requests at once.
+// A zero limit, either the default or a caller's one, means no limit.
+func NewRateLimiter(perMinute, burst int, overrides map[string]int) *RateLimiter {
+	return &RateLimiter{
+		perMinute: perMinute,
+		burst:     burst,
+		overrides: overrides,
+		limiters:  map[string]*rate.Limiter{},
+	}
+}
+
+// Allow reports whether the caller can make a request now.
+func (l *RateLimiter) Allow(caller string) bool {
+	l.mu.Lock()
+	limiter, ok := l.limiters[caller]
+	if !ok {
+		perMinute := l.perMinute
+		if override, ok := l.overrides[caller]; ok {
+			perMinute = override
+		}
+
+		limit := rate.Inf
+		if perMinute > 0 {
+			limit = rate.Limit(float64(perMinute) / 60)
+		}
+		limiter = rate.NewLimiter(limit, max(l.burst, 1))
+		l.limiters[caller] = limiter
+	}
+	l.mu.Unlock()
+
+	return limiter.Allow()
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/auth"
+)
+
+type authConfig struct {
+	apiKeys     []string
+	hmacSecrets []string
+	jwksFile    string
+	jwtIssuer   string
+	jwtAudience string
+	rateLimit   int
+	rateBurst   int
+	rateLimits  []string
+}
+
+// newAuthMiddleware builds the authentication of the service endpoints.
+// It returns nil if no authentication method is configured.
+func newAuthMiddleware(config authConfig, log *logger.UPPLogger) (func(http.Handler) http.Handler, error) {
+	var chain auth.Chain
+
+	if len(config.apiKeys) > 0 {
+		callers, err := parsePairs(config.apiKeys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid API keys: %w", err)
+		}
+		keys := make(map[string]string, len(callers))
+		for caller, key := range callers {
+			// A shared key couldn't tell its callers apart.
+			if other, ok := keys[key]; ok {
+				return nil, fmt.Errorf("invalid API keys: %s and %s have the same key", min(caller, other), max(caller, other))
+			}
+			keys[key] = caller
+		}
+		chain = append(chain, auth.NewAPIKeys(keys))
+	}
+
+	if len(config.hmacSecrets) > 0 {
+		secrets, err := parsePairs(config.hmacSecrets)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HMAC secrets: %w", err)
+		}
+		chain = append(chain, auth.NewHMAC(secrets))
+	}
+
+	if config.jwksFile != "" {
+		validator, err := auth.LoadJWTValidator(config.jwksFile, config.jwtIssuer, config.jwtAudience)
+		if err != nil {
+			return nil, fmt.Errorf("could not load the JWT validator: %w", err)
+		}
+		chain = append(chain, validator)
+	}
+
+	if len(chain) == 0 {
+		return nil, nil
+	}
+
+	limits, err := parsePairs(config.rateLimits)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rate limits: %w", err)
+	}
+	overrides := make(map[string]int, len(limits))
+	for caller, limit := range limits {
+		if overrides[caller], err = strconv.Atoi(limit); err != nil || overrides[caller] < 0 {
+			return nil, fmt.Errorf("invalid rate limit for %s: %q", caller, limit)
+		}
+	}
+
+	return auth.Middleware(chain, auth.NewRateLimiter(config.rateLimit, config.rateBurst, overrides), log), nil
+}
+
+// parsePairs parses name:value pairs, splitting them at the first colon.
+func parsePairs(pairs []string) (map[string]string, error) {
+	m := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		name, value, ok := strings.Cut(strings.TrimSpace(p), ":")
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("%q is not a name:value pair", p)
+		}
+		if _, ok := m[name]; ok {
+			return nil, fmt.Errorf("%s is given more than once", name)
+		}
+		m[name] = value
+	}
+	return m, nil
+}
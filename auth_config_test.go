@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuthMiddleware(t *testing.T) {
+	log := logger.NewUPPLogger("TEST", "PANIC")
+
+	middleware, err := newAuthMiddleware(authConfig{rateLimit: 60, rateBurst: 10}, log)
+	require.NoError(t, err)
+	assert.Nil(t, middleware, "no authentication method is configured")
+
+	middleware, err = newAuthMiddleware(authConfig{
+		apiKeys:    []string{"reindexer:key-1", "ops:key-2"},
+		rateLimit:  60,
+		rateBurst:  1,
+		rateLimits: []string{"reindexer:0"},
+	}, log)
+	require.NoError(t, err)
+
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, _ := auth.CallerFromContext(r.Context())
+		_, _ = w.Write([]byte(caller.ID))
+	}))
+	request := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/some-uuid", nil)
+		r.Header.Set(auth.APIKeyHeader, key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, "reindexer", request("key-1").Body.String())
+	assert.Equal(t, http.StatusOK, request("key-1").Code, "the reindexer has no rate limit")
+	assert.Equal(t, "ops", request("key-2").Body.String())
+	assert.Equal(t, http.StatusTooManyRequests, request("key-2").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("key-3").Code)
+}
+
+func TestNewAuthMiddleware_Invalid_Config(t *testing.T) {
+	log := logger.NewUPPLogger("TEST", "PANIC")
+
+	tests := map[string]authConfig{
+		"API key without caller":  {apiKeys: []string{"key-1"}},
+		"repeated caller":         {apiKeys: []string{"ops:key-1", "ops:key-2"}},
+		"shared API key":          {apiKeys: []string{"ops:key-1", "editorial:key-1"}},
+		"HMAC secret without key": {hmacSecrets: []string{":secret"}},
+		"missing JWKS file":       {jwksFile: "missing.json"},
+		"invalid rate limit":      {apiKeys: []string{"ops:key-1"}, rateLimits: []string{"ops:fast"}},
+		"negative rate limit":     {apiKeys: []string{"ops:key-1"}, rateLimits: []string{"ops:-1"}},
+	}
+
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newAuthMiddleware(config, log)
+			assert.Error(t, err)
+		})
+	}
+}
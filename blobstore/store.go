@@ -0,0 +1,120 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// validKey restricts the keys to a single path segment, so that they can be safely used as file and object names.
+var validKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+// Store keeps payloads which are too large to be sent through Kafka.
+type Store interface {
+	Put(key string, data []byte) error
+	Get(key string) ([]byte, error)
+}
+
+func ValidateKey(key string) error {
+	if !validKey.MatchString(key) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// FileStore keeps every blob as a file in a local directory.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating blob store directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Put(key string, data []byte) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that readers never see a partially written blob.
+	tmp, err := os.CreateTemp(s.dir, ".tmp-"+key+"-*")
+	if err != nil {
+		return fmt.Errorf("error creating blob %q: %w", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("error writing blob %q: %w", key, err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("error writing blob %q: %w", key, err)
+	}
+
+	if err = os.Rename(tmp.Name(), filepath.Join(s.dir, key)); err != nil {
+		return fmt.Errorf("error storing blob %q: %w", key, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	if err := ValidateKey(key); err != nil {
+		return nil, err
+	}
+
+	b, err := os.ReadFile(filepath.Join(s.dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %q", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("error reading blob %q: %w", key, err)
+	}
+	return b, nil
+}
+
+// DeleteOlderThan removes the blobs stored before the given time, and returns how many were removed.
+// The blobs removed meanwhile, e.g. by another instance sharing the directory, are ignored.
+func (s *FileStore) DeleteOlderThan(t time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("error listing the blobs: %w", err)
+	}
+
+	var deleted int
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		info, err := e.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("error reading blob %q: %w", e.Name(), err)
+		}
+		if !info.ModTime().Before(t) {
+			continue
+		}
+
+		err = os.Remove(filepath.Join(s.dir, e.Name()))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting blob %q: %w", e.Name(), err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
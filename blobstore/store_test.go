@@ -0,0 +1,75 @@
+package blobstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStore_PutGet(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, s.Put("some-key.json", []byte("payload")))
+
+	b, err := s.Get("some-key.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("payload"), b)
+
+	require.NoError(t, s.Put("some-key.json", []byte("new payload")))
+
+	b, err = s.Get("some-key.json")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new payload"), b)
+
+	entries, err := os.ReadDir(s.dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files should be cleaned up")
+}
+
+func TestFileStore_Get_Missing(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = s.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestFileStore_Invalid_Keys(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../secret", "a/b", ".hidden"} {
+		assert.ErrorIs(t, s.Put(key, []byte("payload")), ErrInvalidKey, key)
+
+		_, err = s.Get(key)
+		assert.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
+
+func TestFileStore_DeleteOlderThan(t *testing.T) {
+	s, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, s.Put("old.json", []byte("payload")))
+	require.NoError(t, os.Chtimes(filepath.Join(s.dir, "old.json"), now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	require.NoError(t, s.Put("new.json", []byte("payload")))
+
+	deleted, err := s.DeleteOlderThan(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	_, err = s.Get("old.json")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, err = s.Get("new.json")
+	assert.NoError(t, err)
+
+	deleted, err = s.DeleteOlderThan(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
@@ -0,0 +1,220 @@
+// Package canary publishes synthetic content events through the message processing and measures
+// how long the combined messages take to be forwarded.
+package canary
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/dchest/uniuri"
+)
+
+const (
+	// TransactionIDPrefix identifies the canary events and the combined messages built from them.
+	TransactionIDPrefix = "tid_canary_"
+
+	contentMessageType = "cms-content-published"
+)
+
+var (
+	ErrNotForwarded = errors.New("no combined message was forwarded before the deadline")
+	ErrStopped      = errors.New("the canary was stopped")
+)
+
+type messageProducer interface {
+	SendMessage(message kafka.FTMessage) error
+}
+
+type Config struct {
+	// UUID of the synthetic content.
+	UUID string
+	// Topic the synthetic events pretend to be consumed from.
+	Topic    string
+	Interval time.Duration
+	// Deadline for the combined message to be forwarded.
+	Deadline time.Duration
+}
+
+// Canary periodically sends a synthetic content event to the messages channel of the processor,
+// and waits for the producer of the combined topic to send the combined message.
+type Canary struct {
+	config Config
+	in     chan<- *kafka.FTMessage
+	log    *logger.UPPLogger
+	now    func() time.Time
+
+	forwarded chan string
+
+	mu      sync.RWMutex
+	latency time.Duration
+	err     error
+	lastRun time.Time
+}
+
+func New(config Config, in chan<- *kafka.FTMessage, log *logger.UPPLogger) *Canary {
+	return &Canary{
+		config:    config,
+		in:        in,
+		log:       log,
+		now:       time.Now,
+		forwarded: make(chan string, 1),
+	}
+}
+
+type keyedMessageProducer interface {
+	SendKeyedMessage(key string, message kafka.FTMessage) error
+	SendTombstone(key string) error
+}
+
+// Observe wraps the producer of the combined topic, so that the canary is notified of the combined messages it sends.
+// The wrapper keeps sending keyed messages if the producer does.
+func (c *Canary) Observe(producer messageProducer) messageProducer {
+	observed := &observedProducer{producer: producer, canary: c}
+	if keyed, ok := producer.(keyedMessageProducer); ok {
+		return &observedKeyedProducer{observedProducer: observed, keyed: keyed}
+	}
+	return observed
+}
+
+type observedProducer struct {
+	producer messageProducer
+	canary   *Canary
+}
+
+func (p *observedProducer) SendMessage(message kafka.FTMessage) error {
+	if err := p.producer.SendMessage(message); err != nil {
+		return err
+	}
+	p.observe(message)
+	return nil
+}
+
+func (p *observedProducer) observe(message kafka.FTMessage) {
+	if tid := message.Headers["X-Request-Id"]; strings.HasPrefix(tid, TransactionIDPrefix) {
+		select {
+		case p.canary.forwarded <- tid:
+		default:
+		}
+	}
+}
+
+type observedKeyedProducer struct {
+	*observedProducer
+	keyed keyedMessageProducer
+}
+
+func (p *observedKeyedProducer) SendKeyedMessage(key string, message kafka.FTMessage) error {
+	if err := p.keyed.SendKeyedMessage(key, message); err != nil {
+		return err
+	}
+	p.observe(message)
+	return nil
+}
+
+func (p *observedKeyedProducer) SendTombstone(key string) error {
+	return p.keyed.SendTombstone(key)
+}
+
+// Run publishes a canary straight away and then on every interval, until stop is closed.
+// Run must return before the messages channel is closed.
+func (c *Canary) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		latency, err := c.publish(stop)
+		if errors.Is(err, ErrStopped) {
+			return
+		}
+		c.record(latency, err)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish sends a synthetic event and returns the time it took for its combined message to be forwarded.
+func (c *Canary) publish(stop <-chan struct{}) (time.Duration, error) {
+	tid := TransactionIDPrefix + uniuri.NewLen(10) + "_post_publication_combiner"
+	start := c.now()
+	message := c.event(tid, start)
+
+	deadline := time.NewTimer(c.config.Deadline)
+	defer deadline.Stop()
+
+	select {
+	case c.in <- &message:
+	case <-stop:
+		return 0, ErrStopped
+	case <-deadline.C:
+		return 0, fmt.Errorf("%w: the canary event couldn't be queued for processing", ErrNotForwarded)
+	}
+
+	for {
+		select {
+		case forwarded := <-c.forwarded:
+			// Messages of earlier, timed out canaries are ignored.
+			if forwarded == tid {
+				return c.now().Sub(start), nil
+			}
+		case <-stop:
+			return 0, ErrStopped
+		case <-deadline.C:
+			return 0, fmt.Errorf("%w (%s)", ErrNotForwarded, c.config.Deadline)
+		}
+	}
+}
+
+func (c *Canary) event(tid string, t time.Time) kafka.FTMessage {
+	body := fmt.Sprintf(
+		`{"payload":{"uuid":%q,"type":"Article","title":"Post publication combiner canary","lastModified":%[2]q},"contentUri":"http://post-publication-combiner/canary/%[1]s","lastModified":%[2]q}`,
+		c.config.UUID,
+		t.UTC().Format(time.RFC3339Nano),
+	)
+
+	return kafka.FTMessage{
+		Headers: map[string]string{
+			"X-Request-Id":      tid,
+			"Message-Type":      contentMessageType,
+			"Content-Type":      "application/json",
+			"Origin-System-Id":  "http://cmdb.ft.com/systems/post-publication-combiner",
+			"Message-Timestamp": t.UTC().Format(time.RFC3339Nano),
+		},
+		Body:  body,
+		Topic: c.config.Topic,
+	}
+}
+
+func (c *Canary) record(latency time.Duration, err error) {
+	if err != nil {
+		c.log.WithError(err).WithUUID(c.config.UUID).Error("Canary publication failed")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency = latency
+	c.err = err
+	c.lastRun = c.now()
+}
+
+// Check reports the result of the last canary publication, with its end-to-end latency.
+func (c *Canary) Check() (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lastRun.IsZero() {
+		return "The canary hasn't been published yet", nil
+	}
+	if c.err != nil {
+		return "", c.err
+	}
+	return fmt.Sprintf("OK (latency: %s, age: %s)", c.latency.Round(time.Millisecond), c.now().Sub(c.lastRun).Round(time.Second)), nil
+}
@@ -0,0 +1,158 @@
+package canary
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testUUID = "01e3b5b0-4b33-4a6e-8f6b-0d1a1d1a3a3c"
+
+type recordingProducer struct {
+	messages []kafka.FTMessage
+	err      error
+}
+
+func (p *recordingProducer) SendMessage(m kafka.FTMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.messages = append(p.messages, m)
+	return nil
+}
+
+func testCanary(in chan<- *kafka.FTMessage, deadline time.Duration) *Canary {
+	return New(Config{
+		UUID:     testUUID,
+		Topic:    "PostPublicationEvents",
+		Interval: time.Hour,
+		Deadline: deadline,
+	}, in, logger.NewUPPLogger("TEST", "PANIC"))
+}
+
+// process stands for the message processor, forwarding every message it receives with the given producer.
+func process(in <-chan *kafka.FTMessage, producer messageProducer) {
+	for m := range in {
+		_ = producer.SendMessage(kafka.FTMessage{Headers: map[string]string{"X-Request-Id": m.Headers["X-Request-Id"]}})
+	}
+}
+
+func TestCanary_Forwarded(t *testing.T) {
+	in := make(chan *kafka.FTMessage, 1)
+	c := testCanary(in, time.Second)
+	producer := &recordingProducer{}
+	go process(in, c.Observe(producer))
+	defer close(in)
+
+	output, err := c.Check()
+	require.NoError(t, err)
+	assert.Equal(t, "The canary hasn't been published yet", output)
+
+	latency, err := c.publish(make(chan struct{}))
+	require.NoError(t, err)
+	c.record(latency, err)
+
+	output, err = c.Check()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(output, "OK (latency: "), output)
+	require.Len(t, producer.messages, 1)
+	assert.True(t, strings.HasPrefix(producer.messages[0].Headers["X-Request-Id"], TransactionIDPrefix))
+}
+
+type keyedRecordingProducer struct {
+	recordingProducer
+	keys []string
+}
+
+func (p *keyedRecordingProducer) SendKeyedMessage(key string, m kafka.FTMessage) error {
+	p.keys = append(p.keys, key)
+	return p.SendMessage(m)
+}
+
+func (p *keyedRecordingProducer) SendTombstone(string) error {
+	return nil
+}
+
+func TestCanary_Observe_KeyedProducer(t *testing.T) {
+	in := make(chan *kafka.FTMessage, 1)
+	c := testCanary(in, time.Second)
+
+	_, ok := c.Observe(&recordingProducer{}).(keyedMessageProducer)
+	assert.False(t, ok)
+
+	producer := &keyedRecordingProducer{}
+	observed, ok := c.Observe(producer).(keyedMessageProducer)
+	require.True(t, ok)
+
+	require.NoError(t, observed.SendKeyedMessage(testUUID, kafka.FTMessage{Headers: map[string]string{"X-Request-Id": TransactionIDPrefix + "keyed"}}))
+	assert.Equal(t, []string{testUUID}, producer.keys)
+	assert.Equal(t, TransactionIDPrefix+"keyed", <-c.forwarded)
+}
+
+func TestCanary_Not_Forwarded(t *testing.T) {
+	in := make(chan *kafka.FTMessage, 1)
+	c := testCanary(in, 10*time.Millisecond)
+	go process(in, c.Observe(&recordingProducer{err: errors.New("producer error")}))
+	defer close(in)
+
+	latency, err := c.publish(make(chan struct{}))
+	assert.ErrorIs(t, err, ErrNotForwarded)
+	c.record(latency, err)
+
+	_, err = c.Check()
+	assert.ErrorIs(t, err, ErrNotForwarded)
+}
+
+func TestCanary_Ignores_Earlier_Canaries(t *testing.T) {
+	in := make(chan *kafka.FTMessage, 1)
+	c := testCanary(in, 10*time.Millisecond)
+	c.forwarded <- TransactionIDPrefix + "earlier"
+
+	_, err := c.publish(make(chan struct{}))
+	assert.ErrorIs(t, err, ErrNotForwarded)
+}
+
+func TestCanary_Event(t *testing.T) {
+	c := testCanary(nil, time.Second)
+	m := c.event("tid_canary_test", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	assert.Equal(t, "PostPublicationEvents", m.Topic)
+	assert.Equal(t, "tid_canary_test", m.Headers["X-Request-Id"])
+	assert.Equal(t, "2024-01-01T00:00:00Z", m.Headers["Message-Timestamp"])
+
+	var body struct {
+		Payload map[string]interface{} `json:"payload"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(m.Body), &body))
+	assert.Equal(t, testUUID, body.Payload["uuid"])
+	assert.Equal(t, "Article", body.Payload["type"])
+}
+
+func TestCanary_Run_Stops(t *testing.T) {
+	// Nothing reads the messages, so the canary waits until it's stopped.
+	c := testCanary(make(chan *kafka.FTMessage), time.Hour)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(stop)
+		close(done)
+	}()
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the canary didn't stop")
+	}
+
+	output, err := c.Check()
+	require.NoError(t, err)
+	assert.Equal(t, "The canary hasn't been published yet", output)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/blobstore"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	"github.com/gorilla/mux"
+)
+
+const (
+	refPathVar = "ref"
+
+	// claimCheckSweepInterval is the longest time between the removals of the expired claim checked messages.
+	claimCheckSweepInterval = time.Hour
+)
+
+type blobReader interface {
+	Get(key string) ([]byte, error)
+}
+
+type claimCheckHandler struct {
+	store blobReader
+	log   *logger.UPPLogger
+}
+
+func (h *claimCheckHandler) getMessage(w http.ResponseWriter, r *http.Request) {
+	ref := mux.Vars(r)[refPathVar]
+
+	log := h.log.
+		WithTransactionID(r.Header.Get("X-Request-Id")).
+		WithField("ref", ref)
+
+	b, err := h.store.Get(ref)
+	if err != nil {
+		if errors.Is(err, blobstore.ErrInvalidKey) {
+			log.WithError(err).Error("Invalid claim check reference")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, blobstore.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		log.WithError(err).Error("Failed to read claim checked message")
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", processor.ClaimCheckContentType(ref))
+	if _, err = w.Write(b); err != nil {
+		log.WithError(err).Error("Failed to write claim checked message")
+	}
+}
+
+type blobExpirer interface {
+	DeleteOlderThan(t time.Time) (int, error)
+}
+
+// sweepClaimChecks removes the claim checked messages stored more than retention ago, until stop is closed.
+// The same message stored again is kept for the whole retention from then on.
+func sweepClaimChecks(store blobExpirer, retention time.Duration, stop <-chan struct{}, log *logger.UPPLogger) {
+	interval := min(retention, claimCheckSweepInterval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := store.DeleteOlderThan(time.Now().Add(-retention))
+		if err != nil {
+			log.WithError(err).Error("Could not remove the expired claim checked messages")
+		} else if deleted > 0 {
+			log.Infof("Removed %d expired claim checked messages", deleted)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/blobstore"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GetClaimCheckedMessage(t *testing.T) {
+	tests := []struct {
+		ref         string
+		blob        []byte
+		err         error
+		status      int
+		contentType string
+	}{
+		{
+			ref:         "some_uuid-abc.json",
+			blob:        []byte(`{"uuid":"some_uuid"}`),
+			status:      http.StatusOK,
+			contentType: "application/json",
+		},
+		{
+			ref:         "some_uuid-abc.avro",
+			blob:        []byte{0, 0, 0, 0, 1},
+			status:      http.StatusOK,
+			contentType: "avro/binary",
+		},
+		{
+			ref:    "some_uuid-missing.json",
+			err:    blobstore.ErrNotFound,
+			status: http.StatusNotFound,
+		},
+		{
+			ref:    "..invalid",
+			err:    blobstore.ErrInvalidKey,
+			status: http.StatusBadRequest,
+		},
+		{
+			ref:    "some_uuid-abc.json",
+			err:    fmt.Errorf("some error"),
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.ref, func(t *testing.T) {
+			h := claimCheckHandler{
+				store: &dummyBlobReader{t: t, ref: testCase.ref, blob: testCase.blob, err: testCase.err},
+				log:   logger.NewUPPLogger("TEST", "PANIC"),
+			}
+			router := mux.NewRouter()
+			router.HandleFunc("/claim-check/{ref}", h.getMessage).Methods("GET")
+
+			server := httptest.NewServer(router)
+			defer server.Close()
+
+			resp, err := http.Get(fmt.Sprintf("%s/claim-check/%s", server.URL, testCase.ref))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, testCase.status, resp.StatusCode)
+			if testCase.status == http.StatusOK {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, testCase.blob, body)
+				assert.Equal(t, testCase.contentType, resp.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+type dummyBlobReader struct {
+	t    *testing.T
+	ref  string
+	blob []byte
+	err  error
+}
+
+func (r *dummyBlobReader) Get(key string) ([]byte, error) {
+	assert.Equal(r.t, r.ref, key)
+	return r.blob, r.err
+}
+
+type recordingExpirer struct {
+	mu      sync.Mutex
+	cutoffs []time.Time
+}
+
+func (e *recordingExpirer) DeleteOlderThan(t time.Time) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cutoffs = append(e.cutoffs, t)
+	return 1, nil
+}
+
+func (e *recordingExpirer) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.cutoffs)
+}
+
+func TestSweepClaimChecks(t *testing.T) {
+	expirer := &recordingExpirer{}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		sweepClaimChecks(expirer, 10*time.Millisecond, stop, logger.NewUPPLogger("TEST", "PANIC"))
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return expirer.count() >= 2 }, time.Second, 5*time.Millisecond,
+		"the messages are removed at start and then at every retention period shorter than the sweep interval")
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the sweep did not stop")
+	}
+
+	expirer.mu.Lock()
+	defer expirer.mu.Unlock()
+	assert.WithinDuration(t, time.Now().Add(-10*time.Millisecond), expirer.cutoffs[0], time.Second)
+}
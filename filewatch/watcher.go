@@ -0,0 +1,112 @@
+// Package filewatch detects changes of local files by polling their modification times and sizes.
+// Polling behaves the same on every filesystem, including mounted Kubernetes config maps where inotify events are unreliable.
+// Symbolic links are followed, as the config map files are links through a "..data" link which is swapped on every update.
+package filewatch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+type Watcher struct {
+	paths       []string
+	interval    time.Duration
+	fingerprint string
+	log         *logger.UPPLogger
+}
+
+func NewWatcher(paths []string, interval time.Duration, log *logger.UPPLogger) (*Watcher, error) {
+	fingerprint, err := Fingerprint(paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Watcher{
+		paths:       paths,
+		interval:    interval,
+		fingerprint: fingerprint,
+		log:         log,
+	}, nil
+}
+
+// Run calls onChange every time the watched files change, until stop is closed.
+func (w *Watcher) Run(stop <-chan struct{}, onChange func()) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if w.changed() {
+				onChange()
+			}
+		}
+	}
+}
+
+func (w *Watcher) changed() bool {
+	fingerprint, err := Fingerprint(w.paths...)
+	if err != nil {
+		// Files are often briefly missing while they are being replaced, so keep the last fingerprint and retry on the next tick.
+		w.log.WithError(err).Warn("Could not check the watched files for changes")
+		return false
+	}
+	if fingerprint == w.fingerprint {
+		return false
+	}
+
+	w.fingerprint = fingerprint
+	return true
+}
+
+// Fingerprint summarises the names, sizes and modification times of the files at, or under, the given paths.
+// The names are the ones the links resolve to, so swapping a link changes the fingerprint even if the files are identical.
+func Fingerprint(paths ...string) (string, error) {
+	var entries []string
+	for _, p := range paths {
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				return err
+			}
+			// Unlike d.Info, os.Stat follows the links.
+			info, err := os.Stat(target)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				// Linked directories are not walked, the config map ones are also reached through their real names.
+				return nil
+			}
+			entries = append(entries, fmt.Sprintf("%s:%s:%d:%d", path, target, info.Size(), info.ModTime().UnixNano()))
+			return nil
+		})
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", p, err)
+		}
+	}
+	sort.Strings(entries)
+
+	h := sha256.New()
+	for _, e := range entries {
+		h.Write([]byte(e))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
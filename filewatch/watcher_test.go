@@ -0,0 +1,137 @@
+package filewatch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "policy.rego")
+	require.NoError(t, os.WriteFile(file, []byte("package kafka"), 0600))
+
+	first, err := Fingerprint(dir)
+	require.NoError(t, err)
+
+	same, err := Fingerprint(dir)
+	require.NoError(t, err)
+	assert.Equal(t, first, same)
+
+	require.NoError(t, os.WriteFile(file, []byte("package kafka.ingest"), 0600))
+	changed, err := Fingerprint(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, changed)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.json"), []byte("{}"), 0600))
+	added, err := Fingerprint(dir)
+	require.NoError(t, err)
+	assert.NotEqual(t, changed, added)
+
+	_, err = Fingerprint(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestWatcherRun(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0600))
+
+	w, err := NewWatcher([]string{file}, 10*time.Millisecond, logger.NewUPPLogger("test", "PANIC"))
+	require.NoError(t, err)
+
+	changes := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		w.Run(stop, func() { changes <- struct{}{} })
+		close(done)
+	}()
+
+	require.NoError(t, os.WriteFile(file, []byte(`{"changed": true}`), 0600))
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("the change was not detected")
+	}
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the watcher did not stop")
+	}
+}
+
+// writeConfigMap lays out the files like a mounted config map: every file is a link through the "..data" link to a timestamped directory,
+// and updates swap the "..data" link to a new directory.
+func writeConfigMap(t *testing.T, dir, version string, files map[string]string, modTime time.Time) {
+	t.Helper()
+
+	data := filepath.Join(dir, ".."+version)
+	require.NoError(t, os.Mkdir(data, 0700))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(data, name), []byte(content), 0600))
+		require.NoError(t, os.Chtimes(filepath.Join(data, name), modTime, modTime))
+
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			require.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	require.NoError(t, os.Symlink(".."+version, tmp))
+	require.NoError(t, os.Rename(tmp, filepath.Join(dir, "..data")))
+}
+
+func TestFingerprint_ConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "config.json")
+	modTime := time.Now().Add(-time.Hour)
+	writeConfigMap(t, dir, "2024_01_01", map[string]string{"config.json": "{}"}, modTime)
+
+	first, err := Fingerprint(file)
+	require.NoError(t, err)
+
+	// The same size and modification time, only the link target tells the files apart.
+	writeConfigMap(t, dir, "2024_01_02", map[string]string{"config.json": "[]"}, modTime)
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "..2024_01_01")))
+
+	swapped, err := Fingerprint(file)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, swapped)
+
+	same, err := Fingerprint(file)
+	require.NoError(t, err)
+	assert.Equal(t, swapped, same)
+}
+
+func TestWatcherRun_ConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeConfigMap(t, dir, "2024_01_01", map[string]string{"policy.rego": "package kafka"}, time.Now())
+
+	w, err := NewWatcher([]string{filepath.Join(dir, "policy.rego")}, 10*time.Millisecond, logger.NewUPPLogger("test", "PANIC"))
+	require.NoError(t, err)
+
+	changes := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go w.Run(stop, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+
+	writeConfigMap(t, dir, "2024_01_02", map[string]string{"policy.rego": "package kafka.ingest"}, time.Now())
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("the swap of the config map was not detected")
+	}
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/auth"
 	"github.com/Financial-Times/post-publication-combiner/v2/processor"
 	"github.com/dchest/uniuri"
 	"github.com/google/uuid"
@@ -16,38 +19,197 @@ const (
 )
 
 type requestProcessor interface {
-	ForcePublication(uuid string, tid string) error
+	ForcePublication(uuid string, tid string, opts ...processor.ForceOption) error
+	ForceDeletion(uuid string, tid string, opts ...processor.ForceOption) error
+}
+
+// forceFunc is the processing of a force request, either a publication or a deletion.
+type forceFunc func(uuid string, tid string, opts ...processor.ForceOption) error
+
+type uuidResolver interface {
+	ResolveIdentifier(id processor.Identifier) (string, error)
 }
 
 type requestHandler struct {
 	requestProcessor requestProcessor
-	log              *logger.UPPLogger
+	uuidResolver     uuidResolver
+	// privilegedCallers are the authenticated callers allowed to send force options.
+	privilegedCallers map[string]bool
+	log               *logger.UPPLogger
+}
+
+// forceOptions is the optional body of a force request.
+type forceOptions struct {
+	// Topic is either "forced" (the default) or "live".
+	Topic          string            `json:"topic"`
+	Headers        map[string]string `json:"headers"`
+	OriginSystemID string            `json:"originSystemId"`
+	BypassPolicy   *struct {
+		Reason string `json:"reason"`
+	} `json:"bypassPolicy"`
+}
+
+// readForceOptions reads the force options from the request body. It returns no options for an empty body.
+func readForceOptions(r *http.Request) ([]processor.ForceOption, error) {
+	var o forceOptions
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(&o); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var opts []processor.ForceOption
+	if o.Topic != "" {
+		topic, err := processor.ParseForceTopic(o.Topic)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, processor.ToTopic(topic))
+	}
+	if len(o.Headers) > 0 {
+		opts = append(opts, processor.WithHeaders(o.Headers))
+	}
+	if o.OriginSystemID != "" {
+		opts = append(opts, processor.WithOrigin(o.OriginSystemID))
+	}
+	if o.BypassPolicy != nil {
+		opts = append(opts, processor.BypassingPolicy(o.BypassPolicy.Reason))
+	}
+	return opts, nil
 }
 
 func (h *requestHandler) publishMessage(w http.ResponseWriter, r *http.Request) {
 	uuid := mux.Vars(r)[idPathVar]
-	transactionID := r.Header.Get("X-Request-Id")
 
+	if !isValidUUID(uuid) {
+		h.log.WithTransactionID(r.Header.Get("X-Request-Id")).WithUUID(uuid).Error("Invalid UUID")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.forcePublication(w, r, uuid)
+}
+
+// publishByIdentifier forces the publication of the content with the authority and identifierValue query parameters.
+func (h *requestHandler) publishByIdentifier(w http.ResponseWriter, r *http.Request) {
+	id := processor.Identifier{
+		Authority:       r.URL.Query().Get("authority"),
+		IdentifierValue: r.URL.Query().Get("identifierValue"),
+	}
 	log := h.log.
-		WithTransactionID(transactionID).
-		WithUUID(uuid)
+		WithTransactionID(r.Header.Get("X-Request-Id")).
+		WithField("authority", id.Authority).
+		WithField("identifierValue", id.IdentifierValue)
+
+	if id.Authority == "" || id.IdentifierValue == "" {
+		log.Error("The authority or the identifier value is missing")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	uuid, err := h.uuidResolver.ResolveIdentifier(id)
+	if err != nil {
+		log.WithError(err).Error("Could not resolve the identifier")
+		if errors.Is(err, processor.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	log.WithUUID(uuid).Info("Identifier resolved")
+	h.forcePublication(w, r, uuid)
+}
+
+// publishByContentURI forces the publication of the content with the contentUri query parameter.
+func (h *requestHandler) publishByContentURI(w http.ResponseWriter, r *http.Request) {
+	uuid, err := processor.UUIDFromContentURI(r.URL.Query().Get("contentUri"))
+	if err != nil {
+		h.log.WithTransactionID(r.Header.Get("X-Request-Id")).WithError(err).Error("Invalid content URI")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	h.forcePublication(w, r, uuid)
+}
+
+// deleteMessage forces a deleted message for content which is gone from every source.
+func (h *requestHandler) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	uuid := mux.Vars(r)[idPathVar]
 
 	if !isValidUUID(uuid) {
-		log.Error("Invalid UUID")
+		h.log.WithTransactionID(r.Header.Get("X-Request-Id")).WithUUID(uuid).Error("Invalid UUID")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	h.force(w, r, uuid, h.requestProcessor.ForceDeletion)
+}
+
+func (h *requestHandler) forcePublication(w http.ResponseWriter, r *http.Request, uuid string) {
+	h.force(w, r, uuid, h.requestProcessor.ForcePublication)
+}
+
+func (h *requestHandler) force(w http.ResponseWriter, r *http.Request, uuid string, force forceFunc) {
+	transactionID := r.Header.Get("X-Request-Id")
+
+	log := h.log.
+		WithTransactionID(transactionID).
+		WithUUID(uuid)
+
 	if transactionID == "" {
 		transactionID = "tid_force_publish" + uniuri.NewLen(10) + "_post_publication_combiner"
 		log = log.WithTransactionID(transactionID)
 		log.Info("Transaction ID was not provided. Generated a new one")
 	}
 
-	err := h.requestProcessor.ForcePublication(uuid, transactionID)
+	caller, authenticated := auth.CallerFromContext(r.Context())
+	if authenticated {
+		log = log.WithField("caller", caller.ID)
+	}
+
+	opts, err := readForceOptions(r)
+	if err != nil {
+		log.WithError(err).Error("Invalid force options")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(opts) > 0 && !(authenticated && h.privilegedCallers[caller.ID]) {
+		log.Error("The caller isn't allowed to send force options")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if authenticated {
+		opts = append(opts, processor.ForcedBy(caller.ID))
+	}
+
+	err = force(uuid, transactionID, opts...)
+	if errors.Is(err, processor.ErrHeld) {
+		log.WithError(err).Warn("The force request was sent to the holding topic")
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 	if err != nil {
 		log.WithError(err).Error("Failed message publication")
 
+		if errors.Is(err, processor.ErrInvalidForceTopic) ||
+			errors.Is(err, processor.ErrHeaderNotOverridable) ||
+			errors.Is(err, processor.ErrBypassWithoutReason) ||
+			errors.Is(err, processor.ErrInvalidForceOption) ||
+			errors.Is(err, processor.ErrLiveTopicNotAvailable) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if errors.Is(err, processor.ErrContentExists) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
 		if errors.Is(err, processor.ErrNotFound) {
 			w.WriteHeader(http.StatusNotFound)
 			return
@@ -58,6 +220,12 @@ func (h *requestHandler) publishMessage(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
+		var skipErr *processor.PolicySkipError
+		if errors.As(err, &skipErr) {
+			writePolicySkip(w, skipErr, log)
+			return
+		}
+
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -66,6 +234,31 @@ func (h *requestHandler) publishMessage(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 }
 
+type policySkipResponse struct {
+	Message    string   `json:"message"`
+	Policy     string   `json:"policy"`
+	Reasons    []string `json:"reasons"`
+	DecisionID string   `json:"decisionId,omitempty"`
+}
+
+func writePolicySkip(w http.ResponseWriter, err *processor.PolicySkipError, log *logger.LogEntry) {
+	reasons := err.Reasons
+	if reasons == nil {
+		reasons = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	if encErr := json.NewEncoder(w).Encode(policySkipResponse{
+		Message:    "The publication was skipped by policy",
+		Policy:     err.Policy.String(),
+		Reasons:    reasons,
+		DecisionID: err.DecisionID,
+	}); encErr != nil {
+		log.WithError(encErr).Error("Failed to write the policy skip response")
+	}
+}
+
 func isValidUUID(id string) bool {
 	_, err := uuid.Parse(id)
 	return err == nil
@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/auth"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 	"github.com/Financial-Times/post-publication-combiner/v2/processor"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
@@ -19,6 +23,7 @@ func Test_PublishMessage(t *testing.T) {
 		tid    string
 		err    error
 		status int
+		body   string
 	}{
 		{
 			uuid:   "a78cf3ea-b221-46f8-8cbc-a61e5e454e88",
@@ -52,6 +57,30 @@ func Test_PublishMessage(t *testing.T) {
 			err:    processor.ErrInvalidContentType,
 			status: 422,
 		},
+		{
+			uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88",
+			tid:  "tid_1",
+			err: fmt.Errorf("wrapped: %w", &processor.PolicySkipError{
+				Policy:     policy.KafkaIngestForce,
+				Reasons:    []string{"editorialDesk: /FT/Professional/Central Banking not allowed"},
+				DecisionID: "1e58b3bf-995c-473e-90e9-ab1f10af74ab",
+			}),
+			status: 409,
+			body:   `{"message":"The publication was skipped by policy","policy":"kafka_ingest_force","reasons":["editorialDesk: /FT/Professional/Central Banking not allowed"],"decisionId":"1e58b3bf-995c-473e-90e9-ab1f10af74ab"}`,
+		},
+		{
+			uuid:   "a78cf3ea-b221-46f8-8cbc-a61e5e454e88",
+			tid:    "tid_1",
+			err:    &processor.PolicySkipError{Policy: policy.KafkaIngestForce},
+			status: 409,
+			body:   `{"message":"The publication was skipped by policy","policy":"kafka_ingest_force","reasons":[]}`,
+		},
+		{
+			uuid:   "a78cf3ea-b221-46f8-8cbc-a61e5e454e88",
+			tid:    "tid_1",
+			err:    processor.ErrHeld,
+			status: 202,
+		},
 	}
 
 	requestProcessor := &DummyRequestProcessor{t: t}
@@ -82,20 +111,171 @@ func Test_PublishMessage(t *testing.T) {
 
 		resp, err := http.DefaultClient.Do(req)
 		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
 		assert.NoError(t, resp.Body.Close())
 
 		assert.Equal(t, testCase.status, resp.StatusCode)
+		if testCase.body != "" {
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			assert.JSONEq(t, testCase.body, string(body))
+		}
+	}
+}
+
+func Test_PublishMessage_Caller_And_Force_Options(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		body   string
+		err    error
+		status int
+		opts   int
+	}{
+		{name: "unauthenticated", status: http.StatusOK},
+		{name: "caller is passed on as the forcing party", key: "some-key", status: http.StatusOK, opts: 1},
+		{name: "options of a privileged caller", key: "privileged-key", body: `{"topic":"live","headers":{"X-Reindex":"true"},"originSystemId":"http://cmdb.ft.com/systems/pac","bypassPolicy":{"reason":"approved"}}`, status: http.StatusOK, opts: 5},
+		{name: "options of an unprivileged caller", key: "some-key", body: `{"topic":"live"}`, status: http.StatusForbidden},
+		{name: "options of an unauthenticated caller", body: `{"topic":"live"}`, status: http.StatusForbidden},
+		{name: "empty options", key: "some-key", body: `{}`, status: http.StatusOK, opts: 1},
+		{name: "invalid topic", key: "privileged-key", body: `{"topic":"quarantine"}`, status: http.StatusBadRequest},
+		{name: "unknown option", key: "privileged-key", body: `{"priority":"high"}`, status: http.StatusBadRequest},
+		{name: "malformed options", key: "privileged-key", body: `{"topic":`, status: http.StatusBadRequest},
+		{name: "rejected options", key: "privileged-key", body: `{"headers":{"X-Request-Id":"tid_2"}}`, err: processor.ErrHeaderNotOverridable, status: http.StatusBadRequest, opts: 2},
+	}
+
+	authenticate := auth.Middleware(
+		auth.NewAPIKeys(map[string]string{"some-key": "reindexer", "privileged-key": "ops"}),
+		nil,
+		logger.NewUPPLogger("TEST", "PANIC"),
+	)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestProcessor := &DummyRequestProcessor{t: t, uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88", tid: "tid_1", err: test.err}
+			rh := requestHandler{
+				requestProcessor:  requestProcessor,
+				privilegedCallers: map[string]bool{"ops": true},
+				log:               logger.NewUPPLogger("TEST", "PANIC"),
+			}
+			var handler http.Handler = http.HandlerFunc(rh.publishMessage)
+			if test.key != "" {
+				handler = authenticate(handler)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/a78cf3ea-b221-46f8-8cbc-a61e5e454e88", strings.NewReader(test.body))
+			r.Header.Set("X-Request-Id", "tid_1")
+			r.Header.Set(auth.APIKeyHeader, test.key)
+			r = mux.SetURLVars(r, map[string]string{idPathVar: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88"})
+			w := httptest.NewRecorder()
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Len(t, requestProcessor.opts, test.opts)
+		})
+	}
+}
+
+func Test_PublishByIdentifier_And_ContentURI(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{name: "identifier", path: "/by-identifier?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFTCOM-METHODE&identifierValue=methode-id", status: http.StatusOK},
+		{name: "unknown identifier", path: "/by-identifier?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFTCOM-METHODE&identifierValue=other-id", status: http.StatusNotFound},
+		{name: "identifier resolution failing", path: "/by-identifier?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFTCOM-METHODE&identifierValue=broken", status: http.StatusInternalServerError},
+		{name: "missing identifier value", path: "/by-identifier?authority=http%3A%2F%2Fapi.ft.com%2Fsystem%2FFTCOM-METHODE", status: http.StatusBadRequest},
+		{name: "content URI", path: "/by-uri?contentUri=http%3A%2F%2Fapi.ft.com%2Fcontent%2Fa78cf3ea-b221-46f8-8cbc-a61e5e454e88", status: http.StatusOK},
+		{name: "content URI without UUID", path: "/by-uri?contentUri=http%3A%2F%2Fapi.ft.com%2Fcontent%2Fsome-id", status: http.StatusBadRequest},
+		{name: "missing content URI", path: "/by-uri", status: http.StatusBadRequest},
+	}
+
+	requestProcessor := &DummyRequestProcessor{t: t, uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88"}
+	rh := requestHandler{
+		requestProcessor: requestProcessor,
+		uuidResolver: dummyUUIDResolver{
+			"http://api.ft.com/system/FTCOM-METHODE:methode-id": "a78cf3ea-b221-46f8-8cbc-a61e5e454e88",
+		},
+		log: logger.NewUPPLogger("TEST", "PANIC"),
+	}
+	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/by-identifier", rh.publishByIdentifier).Methods("POST")
+	servicesRouter.HandleFunc("/by-uri", rh.publishByContentURI).Methods("POST")
+	servicesRouter.HandleFunc("/{id}", rh.publishMessage).Methods("POST")
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			servicesRouter.ServeHTTP(w, httptest.NewRequest(http.MethodPost, test.path, nil))
+			assert.Equal(t, test.status, w.Code)
+		})
 	}
 }
 
+func Test_DeleteMessage(t *testing.T) {
+	tests := []struct {
+		name   string
+		uuid   string
+		err    error
+		status int
+	}{
+		{name: "deleted", uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88", status: http.StatusOK},
+		{name: "content still exists", uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88", err: fmt.Errorf("%w in document-store", processor.ErrContentExists), status: http.StatusConflict},
+		{name: "invalid uuid", uuid: "not-a-uuid", status: http.StatusBadRequest},
+		{name: "sources can't be checked", uuid: "a78cf3ea-b221-46f8-8cbc-a61e5e454e88", err: fmt.Errorf("error checking document-store"), status: http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requestProcessor := &DummyRequestProcessor{t: t, uuid: test.uuid, err: test.err}
+			rh := requestHandler{
+				requestProcessor: requestProcessor,
+				log:              logger.NewUPPLogger("TEST", "PANIC"),
+			}
+			servicesRouter := mux.NewRouter()
+			servicesRouter.HandleFunc("/{id}", rh.publishMessage).Methods("POST")
+			servicesRouter.HandleFunc("/{id}", rh.deleteMessage).Methods("DELETE")
+
+			w := httptest.NewRecorder()
+			servicesRouter.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/"+test.uuid, nil))
+
+			assert.Equal(t, test.status, w.Code)
+			assert.Equal(t, test.status != http.StatusBadRequest, requestProcessor.deleted)
+		})
+	}
+}
+
+type dummyUUIDResolver map[string]string
+
+func (r dummyUUIDResolver) ResolveIdentifier(id processor.Identifier) (string, error) {
+	if id.IdentifierValue == "broken" {
+		return "", fmt.Errorf("document-store-api is unavailable")
+	}
+	uuid, ok := r[id.Authority+":"+id.IdentifierValue]
+	if !ok {
+		return "", processor.ErrNotFound
+	}
+	return uuid, nil
+}
+
 type DummyRequestProcessor struct {
-	t    *testing.T
-	uuid string
-	tid  string
-	err  error
+	t       *testing.T
+	uuid    string
+	tid     string
+	err     error
+	opts    []processor.ForceOption
+	deleted bool
+}
+
+func (p *DummyRequestProcessor) ForceDeletion(uuid, tid string, opts ...processor.ForceOption) error {
+	p.deleted = true
+	return p.ForcePublication(uuid, tid, opts...)
 }
 
-func (p *DummyRequestProcessor) ForcePublication(uuid, tid string) error {
+func (p *DummyRequestProcessor) ForcePublication(uuid, tid string, opts ...processor.ForceOption) error {
+	p.opts = opts
 	assert.Equal(p.t, p.uuid, uuid)
 	if p.tid == "" {
 		assert.NotEmpty(p.t, tid)
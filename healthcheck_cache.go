@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	health "github.com/Financial-Times/go-fthealth/v1_1"
+	"github.com/Financial-Times/service-status-go/gtg"
+)
+
+var (
+	errNotChecked = errors.New("not checked yet")
+	errStale      = errors.New("the result is stale, the background checks are stuck")
+)
+
+type healthChecker interface {
+	Checks() []health.Check
+	GTG() gtg.Status
+}
+
+// checkResult is the last evaluation of a check.
+type checkResult struct {
+	output    string
+	err       error
+	latency   time.Duration
+	checkedAt time.Time
+
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// CachedHealthcheck evaluates the checks in the background and serves their last results,
+// so that /__health and /__gtg don't call the dependencies on every request.
+type CachedHealthcheck struct {
+	checks   []health.Check
+	interval time.Duration
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	results map[string]checkResult
+}
+
+func NewCachedHealthcheck(checks []health.Check, interval time.Duration) *CachedHealthcheck {
+	return &CachedHealthcheck{
+		checks:   checks,
+		interval: interval,
+		now:      time.Now,
+		results:  make(map[string]checkResult, len(checks)),
+	}
+}
+
+// Run evaluates the checks straight away and then on every interval, until stop is closed.
+func (c *CachedHealthcheck) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		c.refresh()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh evaluates all the checks in parallel.
+func (c *CachedHealthcheck) refresh() {
+	var wg sync.WaitGroup
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check health.Check) {
+			defer wg.Done()
+
+			start := c.now()
+			output, err := check.Checker()
+			c.store(check.Name, output, err, c.now().Sub(start), start)
+		}(check)
+	}
+	wg.Wait()
+}
+
+func (c *CachedHealthcheck) store(name, output string, err error, latency time.Duration, checkedAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r := c.results[name]
+	r.output = output
+	r.err = err
+	r.latency = latency
+	r.checkedAt = checkedAt
+	if err != nil {
+		r.lastErr = err
+		r.lastErrAt = checkedAt
+	}
+	c.results[name] = r
+}
+
+// Checks returns the checks with their checkers replaced by the cached results.
+func (c *CachedHealthcheck) Checks() []health.Check {
+	checks := make([]health.Check, 0, len(c.checks))
+	for _, check := range c.checks {
+		name := check.Name
+		check.Checker = func() (string, error) {
+			return c.result(name)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (c *CachedHealthcheck) GTG() gtg.Status {
+	for _, check := range c.checks {
+		if _, err := c.result(check.Name); err != nil {
+			return gtg.Status{GoodToGo: false, Message: err.Error()}
+		}
+	}
+	return gtg.Status{GoodToGo: true}
+}
+
+// result returns the cached output of the check, with the latency and age of the result, and the last error, if there was one.
+// Results older than three intervals are reported as failures, as the background checks should have replaced them.
+func (c *CachedHealthcheck) result(name string) (string, error) {
+	c.mu.RLock()
+	r, ok := c.results[name]
+	c.mu.RUnlock()
+	if !ok {
+		return "", errNotChecked
+	}
+
+	age := c.now().Sub(r.checkedAt).Round(time.Millisecond)
+	details := fmt.Sprintf("latency: %s, age: %s", r.latency.Round(time.Millisecond), age)
+
+	if r.err != nil {
+		return "", fmt.Errorf("%w (%s)", r.err, details)
+	}
+	if age > 3*c.interval {
+		return "", fmt.Errorf("%w (%s)", errStale, details)
+	}
+	if r.lastErr != nil {
+		details += fmt.Sprintf(", last error %s ago: %v", c.now().Sub(r.lastErrAt).Round(time.Second), r.lastErr)
+	}
+	return fmt.Sprintf("%s (%s)", r.output, details), nil
+}
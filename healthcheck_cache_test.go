@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	health "github.com/Financial-Times/go-fthealth/v1_1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedHealthcheck(t *testing.T) {
+	calls := 0
+	var checkErr error
+	checks := []health.Check{
+		{
+			Name: "dependency",
+			Checker: func() (string, error) {
+				calls++
+				if checkErr != nil {
+					return "", checkErr
+				}
+				return ResponseOK, nil
+			},
+		},
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	c := NewCachedHealthcheck(checks, time.Minute)
+	c.now = func() time.Time { return now }
+
+	_, err := c.Checks()[0].Checker()
+	assert.ErrorIs(t, err, errNotChecked)
+	assert.False(t, c.GTG().GoodToGo)
+
+	c.refresh()
+	now = start.Add(10 * time.Second)
+
+	output, err := c.Checks()[0].Checker()
+	require.NoError(t, err)
+	assert.Equal(t, "OK (latency: 0s, age: 10s)", output)
+	assert.True(t, c.GTG().GoodToGo)
+	assert.Equal(t, 1, calls, "the results are served from the cache")
+
+	checkErr = errors.New("dependency unavailable")
+	c.refresh()
+
+	_, err = c.Checks()[0].Checker()
+	assert.ErrorIs(t, err, checkErr)
+	assert.EqualError(t, err, "dependency unavailable (latency: 0s, age: 0s)")
+	status := c.GTG()
+	assert.False(t, status.GoodToGo)
+	assert.Equal(t, "dependency unavailable (latency: 0s, age: 0s)", status.Message)
+
+	checkErr = nil
+	now = start.Add(time.Minute)
+	c.refresh()
+
+	output, err = c.Checks()[0].Checker()
+	require.NoError(t, err)
+	assert.Equal(t, "OK (latency: 0s, age: 0s, last error 50s ago: dependency unavailable)", output)
+
+	now = start.Add(5 * time.Minute)
+	_, err = c.Checks()[0].Checker()
+	assert.ErrorIs(t, err, errStale)
+	assert.False(t, c.GTG().GoodToGo)
+}
+
+func TestCachedHealthcheck_Run(t *testing.T) {
+	checked := make(chan struct{}, 10)
+	checks := []health.Check{
+		{
+			Name: "dependency",
+			Checker: func() (string, error) {
+				checked <- struct{}{}
+				return ResponseOK, nil
+			},
+		},
+	}
+
+	c := NewCachedHealthcheck(checks, time.Millisecond)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		c.Run(stop)
+		close(done)
+	}()
+
+	<-checked
+	<-checked
+	close(stop)
+	<-done
+
+	assert.True(t, c.GTG().GoodToGo)
+}
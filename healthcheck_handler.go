@@ -6,12 +6,15 @@ import (
 	health "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/Financial-Times/post-publication-combiner/v2/httputils"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
 	"github.com/Financial-Times/service-status-go/gtg"
 )
 
 const (
 	GTGEndpoint = "/__gtg"
 	ResponseOK  = "OK"
+	// OPAHealthEndpoint only succeeds once the agent has activated its bundles.
+	OPAHealthEndpoint = "/health?bundles"
 )
 
 type messageProducer interface {
@@ -23,26 +26,72 @@ type messageConsumer interface {
 	MonitorCheck() error
 }
 
+type messageProcessor interface {
+	ProcessingLoopCheck() error
+	ForwardingCheck() (string, error)
+}
+
+type canaryChecker interface {
+	Check() (string, error)
+}
+
 type HealthcheckHandler struct {
 	httpClient                httputils.Client
 	log                       *logger.UPPLogger
 	producer                  messageProducer
 	consumer                  messageConsumer
+	processor                 messageProcessor
 	docStoreAPIBaseURL        string
 	internalContentAPIBaseURL string
+	contentCollectionRWURL    string
+	// settings replace the base URLs of the upstreams with the reloadable ones, if set.
+	settings *processor.SettingsStore
+	// openPolicyAgentURL is empty if the policies aren't evaluated by the sidecar.
+	openPolicyAgentURL string
 }
 
-func NewCombinerHealthcheck(log *logger.UPPLogger, p messageProducer, c messageConsumer, client httputils.Client, docStoreAPIURL string, internalContentAPIURL string) *HealthcheckHandler {
+func NewCombinerHealthcheck(
+	log *logger.UPPLogger,
+	p messageProducer,
+	c messageConsumer,
+	mp messageProcessor,
+	client httputils.Client,
+	docStoreAPIURL string,
+	internalContentAPIURL string,
+	contentCollectionRWURL string,
+	openPolicyAgentURL string,
+) *HealthcheckHandler {
 	return &HealthcheckHandler{
 		httpClient:                client,
 		log:                       log,
 		producer:                  p,
 		consumer:                  c,
+		processor:                 mp,
 		docStoreAPIBaseURL:        docStoreAPIURL,
 		internalContentAPIBaseURL: internalContentAPIURL,
+		contentCollectionRWURL:    contentCollectionRWURL,
+		openPolicyAgentURL:        openPolicyAgentURL,
 	}
 }
 
+// Checks returns the checks of the dependencies, leaving out the policy agent sidecar if it isn't used.
+func (h *HealthcheckHandler) Checks() []health.Check {
+	checks := []health.Check{
+		checkKafkaProducerConnectivity(h),
+		checkKafkaConsumerConnectivity(h),
+		monitorKafkaConsumers(h),
+		checkMessageProcessingLoop(h),
+		checkMessageForwarding(h),
+		checkDocumentStoreAPIHealthcheck(h),
+		checkInternalContentAPIHealthcheck(h),
+		checkContentCollectionRWHealthcheck(h),
+	}
+	if h.openPolicyAgentURL != "" {
+		checks = append(checks, checkOpenPolicyAgentHealthcheck(h))
+	}
+	return checks
+}
+
 func checkKafkaProducerConnectivity(h *HealthcheckHandler) health.Check {
 	return health.Check{
 		BusinessImpact:   "Can't write CombinedPostPublicationEvents and ForcedCombinedPostPublicationEvents messages to queue. Indexing for search won't work.",
@@ -76,6 +125,29 @@ func monitorKafkaConsumers(h *HealthcheckHandler) health.Check {
 	}
 }
 
+func checkMessageProcessingLoop(h *HealthcheckHandler) health.Check {
+	return health.Check{
+		BusinessImpact:   "PostPublicationEvents and PostConceptAnnotations messages are not processed. Indexing for search won't work.",
+		Name:             "Check message processing loop",
+		PanicGuide:       fmt.Sprintf("https://runbooks.ftops.tech/%s", systemCode),
+		Severity:         2,
+		TechnicalSummary: "The message processing loop has stopped or is stuck on a single message. Check the logs for recovered panics and restart the service.",
+		Checker:          h.checkIfProcessingLoopIsAlive,
+	}
+}
+
+// checkMessageForwarding isn't part of the GTG, like checkCanary.
+func checkMessageForwarding(h *HealthcheckHandler) health.Check {
+	return health.Check{
+		BusinessImpact:   "PostPublicationEvents and PostConceptAnnotations messages are received, but no CombinedPostPublicationEvents messages are produced. Indexing for search won't work.",
+		Name:             "Check message forwarding",
+		PanicGuide:       fmt.Sprintf("https://runbooks.ftops.tech/%s", systemCode),
+		Severity:         2,
+		TechnicalSummary: "No combined message was forwarded for the configured time, while messages which weren't skipped on purpose kept being received. Check the logs for policy skips, failing dependencies and producer errors. The output lists the received and forwarded messages per topic.",
+		Checker:          h.checkIfMessagesAreForwarded,
+	}
+}
+
 func checkDocumentStoreAPIHealthcheck(h *HealthcheckHandler) health.Check {
 	return health.Check{
 		BusinessImpact:   "CombinedPostPublication messages can't be constructed. Indexing for content search won't work.",
@@ -98,6 +170,40 @@ func checkInternalContentAPIHealthcheck(h *HealthcheckHandler) health.Check {
 	}
 }
 
+func checkContentCollectionRWHealthcheck(h *HealthcheckHandler) health.Check {
+	return health.Check{
+		BusinessImpact:   "CombinedPostPublication messages of content packages can't be constructed. Content collections won't be updated in search.",
+		Name:             "Check connectivity to content-collection-rw-neo4j",
+		PanicGuide:       "https://runbooks.ftops.tech/content-collection-rw-neo4j",
+		Severity:         3,
+		TechnicalSummary: "Content-collection-rw-neo4j is not reachable. Messages of content packages can't be successfully constructed, neither forwarded.",
+		Checker:          h.checkIfContentCollectionRWIsReachable,
+	}
+}
+
+func checkOpenPolicyAgentHealthcheck(h *HealthcheckHandler) health.Check {
+	return health.Check{
+		BusinessImpact:   "The policies can't be evaluated. Depending on the policy error modes, messages are dropped, held or forwarded unchecked, and force requests fail.",
+		Name:             "Check the open policy agent sidecar",
+		PanicGuide:       fmt.Sprintf("https://runbooks.ftops.tech/%s", systemCode),
+		Severity:         2,
+		TechnicalSummary: "The open policy agent sidecar is not reachable or its policy bundles aren't activated. Check the logs of the open-policy-agent container.",
+		Checker:          h.checkIfOpenPolicyAgentIsHealthy,
+	}
+}
+
+// checkCanary isn't part of the GTG, a broken pipeline isn't fixed by taking the instances out of service.
+func checkCanary(c canaryChecker) health.Check {
+	return health.Check{
+		BusinessImpact:   "Published content may not reach the CombinedPostPublicationEvents queue. Indexing for search may not work.",
+		Name:             "Check end-to-end canary publication",
+		PanicGuide:       fmt.Sprintf("https://runbooks.ftops.tech/%s", systemCode),
+		Severity:         2,
+		TechnicalSummary: "A synthetic content event wasn't combined and forwarded to the combined topic before the deadline. Check the logs of the canary transaction for policy skips, quarantined messages and producer errors.",
+		Checker:          c.Check,
+	}
+}
+
 func (h *HealthcheckHandler) GTG() gtg.Status {
 	consumerCheck := func() gtg.Status {
 		return gtgCheck(h.checkIfKafkaIsReachableFromConsumer)
@@ -114,14 +220,29 @@ func (h *HealthcheckHandler) GTG() gtg.Status {
 	internalContentAPICheck := func() gtg.Status {
 		return gtgCheck(h.checkIfInternalContentAPIIsReachable)
 	}
+	processingLoopCheck := func() gtg.Status {
+		return gtgCheck(h.checkIfProcessingLoopIsAlive)
+	}
+	contentCollectionRWCheck := func() gtg.Status {
+		return gtgCheck(h.checkIfContentCollectionRWIsReachable)
+	}
 
-	return gtg.FailFastParallelCheck([]gtg.StatusChecker{
+	checks := []gtg.StatusChecker{
 		consumerCheck,
 		consumerMonitorCheck,
 		producerCheck,
 		docStoreCheck,
 		internalContentAPICheck,
-	})()
+		processingLoopCheck,
+		contentCollectionRWCheck,
+	}
+	if h.openPolicyAgentURL != "" {
+		checks = append(checks, func() gtg.Status {
+			return gtgCheck(h.checkIfOpenPolicyAgentIsHealthy)
+		})
+	}
+
+	return gtg.FailFastParallelCheck(checks)()
 }
 
 func gtgCheck(handler func() (string, error)) gtg.Status {
@@ -131,8 +252,20 @@ func gtgCheck(handler func() (string, error)) gtg.Status {
 	return gtg.Status{GoodToGo: true}
 }
 
+// upstreams returns the base URLs of the upstreams, read from the current settings if there are any.
+func (h *HealthcheckHandler) upstreams() processor.Upstreams {
+	if h.settings != nil {
+		return h.settings.Load().Upstreams
+	}
+	return processor.Upstreams{
+		DocumentStoreBaseURL:     h.docStoreAPIBaseURL,
+		InternalContentBaseURL:   h.internalContentAPIBaseURL,
+		ContentCollectionBaseURL: h.contentCollectionRWURL,
+	}
+}
+
 func (h *HealthcheckHandler) checkIfDocumentStoreIsReachable() (string, error) {
-	_, err := httputils.ExecuteRequest(h.docStoreAPIBaseURL+GTGEndpoint, h.httpClient)
+	_, err := httputils.ExecuteRequest(h.upstreams().DocumentStoreBaseURL+GTGEndpoint, h.httpClient)
 	if err != nil {
 		h.log.WithError(err).Error("Healthcheck error")
 		return "", err
@@ -141,7 +274,25 @@ func (h *HealthcheckHandler) checkIfDocumentStoreIsReachable() (string, error) {
 }
 
 func (h *HealthcheckHandler) checkIfInternalContentAPIIsReachable() (string, error) {
-	_, err := httputils.ExecuteRequest(h.internalContentAPIBaseURL+GTGEndpoint, h.httpClient)
+	_, err := httputils.ExecuteRequest(h.upstreams().InternalContentBaseURL+GTGEndpoint, h.httpClient)
+	if err != nil {
+		h.log.WithError(err).Error("Healthcheck error")
+		return "", err
+	}
+	return ResponseOK, nil
+}
+
+func (h *HealthcheckHandler) checkIfContentCollectionRWIsReachable() (string, error) {
+	_, err := httputils.ExecuteRequest(h.upstreams().ContentCollectionBaseURL+GTGEndpoint, h.httpClient)
+	if err != nil {
+		h.log.WithError(err).Error("Healthcheck error")
+		return "", err
+	}
+	return ResponseOK, nil
+}
+
+func (h *HealthcheckHandler) checkIfOpenPolicyAgentIsHealthy() (string, error) {
+	_, err := httputils.ExecuteRequest(h.openPolicyAgentURL+OPAHealthEndpoint, h.httpClient)
 	if err != nil {
 		h.log.WithError(err).Error("Healthcheck error")
 		return "", err
@@ -172,3 +323,15 @@ func (h *HealthcheckHandler) checkIfKafkaIsReachableFromProducer() (string, erro
 	}
 	return ResponseOK, nil
 }
+
+func (h *HealthcheckHandler) checkIfProcessingLoopIsAlive() (string, error) {
+	err := h.processor.ProcessingLoopCheck()
+	if err != nil {
+		return "", err
+	}
+	return ResponseOK, nil
+}
+
+func (h *HealthcheckHandler) checkIfMessagesAreForwarded() (string, error) {
+	return h.processor.ForwardingCheck()
+}
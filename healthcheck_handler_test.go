@@ -10,12 +10,16 @@ import (
 
 	"github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
-	DocStoreAPIPath        = "/doc-store-api"
-	InternalContentAPIPath = "/internal-content-api"
+	DocStoreAPIPath         = "/doc-store-api"
+	InternalContentAPIPath  = "/internal-content-api"
+	ContentCollectionRWPath = "/content-collection-rw"
+	OpenPolicyAgentPath     = "/open-policy-agent"
 )
 
 func TestCheckIfDocumentStoreIsReachable_Errors(t *testing.T) {
@@ -49,6 +53,44 @@ func TestCheckIfDocumentStoreIsReachable_Succeeds(t *testing.T) {
 	assert.Equal(t, ResponseOK, resp)
 }
 
+func TestCheckIfUpstreamsAreReachable_ReloadedUpstreams(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path)
+	}))
+	defer server.Close()
+
+	settings := processor.NewSettingsStore(processor.Settings{Upstreams: processor.Upstreams{
+		DocumentStoreBaseURL:     server.URL + "/old-document-store",
+		InternalContentBaseURL:   server.URL + "/internal-content",
+		ContentCollectionBaseURL: server.URL + "/content-collection",
+	}})
+	h := NewCombinerHealthcheck(logger.NewUPPLogger("TEST", "PANIC"), nil, nil, nil, server.Client(), "doc-store-base-url", "internal-content-api-base-url", "content-collection-rw-base-url", "")
+	h.settings = settings
+
+	_, err := h.checkIfDocumentStoreIsReachable()
+	require.NoError(t, err)
+
+	u := settings.Load().Upstreams
+	u.DocumentStoreBaseURL = server.URL + "/document-store"
+	settings.Store(processor.Settings{Upstreams: u})
+
+	for _, check := range []func() (string, error){
+		h.checkIfDocumentStoreIsReachable,
+		h.checkIfInternalContentAPIIsReachable,
+		h.checkIfContentCollectionRWIsReachable,
+	} {
+		_, err = check()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"/old-document-store/__gtg",
+		"/document-store/__gtg",
+		"/internal-content/__gtg",
+		"/content-collection/__gtg",
+	}, requested)
+}
+
 func TestCheckIfInternalContentAPIIsReachable_Errors(t *testing.T) {
 	expError := fmt.Errorf("some error")
 	dc := dummyClient{
@@ -92,6 +134,7 @@ func TestAllHealthChecks(t *testing.T) {
 			isConnectionHealthy: true,
 			isNotLagging:        true,
 		},
+		processor: &mockProcessor{},
 	}
 	testCases := []struct {
 		description      string
@@ -113,6 +156,16 @@ func TestAllHealthChecks(t *testing.T) {
 			healthcheckFunc:  monitorKafkaConsumers,
 			expectedResponse: ResponseOK,
 		},
+		{
+			description:      "Message processing loop is alive",
+			healthcheckFunc:  checkMessageProcessingLoop,
+			expectedResponse: ResponseOK,
+		},
+		{
+			description:      "Messages are forwarded",
+			healthcheckFunc:  checkMessageForwarding,
+			expectedResponse: ResponseOK,
+		},
 		{
 			description:      "Document-store-api is reachable",
 			healthcheckFunc:  checkDocumentStoreAPIHealthcheck,
@@ -123,6 +176,16 @@ func TestAllHealthChecks(t *testing.T) {
 			healthcheckFunc:  checkInternalContentAPIHealthcheck,
 			expectedResponse: ResponseOK,
 		},
+		{
+			description:      "Content-collection-rw is reachable",
+			healthcheckFunc:  checkContentCollectionRWHealthcheck,
+			expectedResponse: ResponseOK,
+		},
+		{
+			description:      "Open policy agent is healthy",
+			healthcheckFunc:  checkOpenPolicyAgentHealthcheck,
+			expectedResponse: ResponseOK,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -145,8 +208,11 @@ func TestGTG_Good(t *testing.T) {
 			isConnectionHealthy: true,
 			isNotLagging:        true,
 		},
+		processor:                 &mockProcessor{},
 		docStoreAPIBaseURL:        "doc-store-base-url",
 		internalContentAPIBaseURL: "internal-content-api-base-url",
+		contentCollectionRWURL:    "content-collection-rw-base-url",
+		openPolicyAgentURL:        "open-policy-agent-url",
 	}
 
 	status := h.GTG()
@@ -154,48 +220,113 @@ func TestGTG_Good(t *testing.T) {
 	assert.Empty(t, status.Message)
 }
 
+func TestGTG_IgnoresMessageForwarding(t *testing.T) {
+	h := HealthcheckHandler{
+		httpClient: &dummyClient{statusCode: http.StatusOK},
+		producer:   &mockProducer{isConnectionHealthy: true},
+		consumer: &mockConsumer{
+			isConnectionHealthy: true,
+			isNotLagging:        true,
+		},
+		processor:                 &mockProcessor{forwardingErr: fmt.Errorf("messages are received, but none was forwarded")},
+		docStoreAPIBaseURL:        "doc-store-base-url",
+		internalContentAPIBaseURL: "internal-content-api-base-url",
+		contentCollectionRWURL:    "content-collection-rw-base-url",
+	}
+
+	assert.True(t, h.GTG().GoodToGo)
+}
+
 func TestGTG_Bad(t *testing.T) {
 	testCases := []struct {
-		description              string
-		producer                 messageProducer
-		consumer                 messageConsumer
-		docStoreAPIStatus        int
-		internalContentAPIStatus int
+		description               string
+		producer                  messageProducer
+		consumer                  messageConsumer
+		processor                 messageProcessor
+		docStoreAPIStatus         int
+		internalContentAPIStatus  int
+		contentCollectionRWStatus int
+		openPolicyAgentStatus     int
 	}{
 		{
-			description:              "Producer KafkaProxy GTG endpoint returns 503",
-			producer:                 &mockProducer{isConnectionHealthy: false},
-			consumer:                 &mockConsumer{isConnectionHealthy: true},
-			docStoreAPIStatus:        200,
-			internalContentAPIStatus: 200,
+			description:               "Producer KafkaProxy GTG endpoint returns 503",
+			producer:                  &mockProducer{isConnectionHealthy: false},
+			consumer:                  &mockConsumer{isConnectionHealthy: true},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
 		},
 		{
-			description:              "Consumer KafkaProxy GTG endpoint returns 503",
-			producer:                 &mockProducer{isConnectionHealthy: true},
-			consumer:                 &mockConsumer{isConnectionHealthy: false},
-			docStoreAPIStatus:        200,
-			internalContentAPIStatus: 200,
+			description:               "Consumer KafkaProxy GTG endpoint returns 503",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: false},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
 		},
 		{
-			description:              "Consumer is lagging",
-			producer:                 &mockProducer{isConnectionHealthy: true},
-			consumer:                 &mockConsumer{isNotLagging: false},
-			docStoreAPIStatus:        200,
-			internalContentAPIStatus: 200,
+			description:               "Consumer is lagging",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isNotLagging: false},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
 		},
 		{
-			description:              "DocumentStoreApi GTG endpoint returns 503",
-			producer:                 &mockProducer{isConnectionHealthy: true},
-			consumer:                 &mockConsumer{isConnectionHealthy: true},
-			docStoreAPIStatus:        503,
-			internalContentAPIStatus: 200,
+			description:               "DocumentStoreApi GTG endpoint returns 503",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: true},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         503,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
 		},
 		{
-			description:              "InternalContentAPI GTG endpoint returns 503",
-			producer:                 &mockProducer{isConnectionHealthy: true},
-			consumer:                 &mockConsumer{isConnectionHealthy: true},
-			docStoreAPIStatus:        200,
-			internalContentAPIStatus: 503,
+			description:               "InternalContentAPI GTG endpoint returns 503",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: true},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  503,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
+		},
+		{
+			description:               "Message processing loop is not running",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: true, isNotLagging: true},
+			processor:                 &mockProcessor{err: fmt.Errorf("message processing loop is not running")},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     200,
+		},
+		{
+			description:               "ContentCollectionRW GTG endpoint returns 503",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: true, isNotLagging: true},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 503,
+			openPolicyAgentStatus:     200,
+		},
+		{
+			description:               "OpenPolicyAgent health endpoint returns 500",
+			producer:                  &mockProducer{isConnectionHealthy: true},
+			consumer:                  &mockConsumer{isConnectionHealthy: true, isNotLagging: true},
+			processor:                 &mockProcessor{},
+			docStoreAPIStatus:         200,
+			internalContentAPIStatus:  200,
+			contentCollectionRWStatus: 200,
+			openPolicyAgentStatus:     500,
 		},
 	}
 
@@ -203,9 +334,19 @@ func TestGTG_Bad(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
-			server := getMockedServer(tc.docStoreAPIStatus, tc.internalContentAPIStatus)
+			server := getMockedServer(tc.docStoreAPIStatus, tc.internalContentAPIStatus, tc.contentCollectionRWStatus, tc.openPolicyAgentStatus)
 			defer server.Close()
-			h := NewCombinerHealthcheck(log, tc.producer, tc.consumer, http.DefaultClient, server.URL+DocStoreAPIPath, server.URL+InternalContentAPIPath)
+			h := NewCombinerHealthcheck(
+				log,
+				tc.producer,
+				tc.consumer,
+				tc.processor,
+				http.DefaultClient,
+				server.URL+DocStoreAPIPath,
+				server.URL+InternalContentAPIPath,
+				server.URL+ContentCollectionRWPath,
+				server.URL+OpenPolicyAgentPath,
+			)
 
 			status := h.GTG()
 			assert.False(t, status.GoodToGo)
@@ -213,7 +354,7 @@ func TestGTG_Bad(t *testing.T) {
 	}
 }
 
-func getMockedServer(docStoreAPIStatus, internalContentAPIStatus int) *httptest.Server {
+func getMockedServer(docStoreAPIStatus, internalContentAPIStatus, contentCollectionRWStatus, openPolicyAgentStatus int) *httptest.Server {
 	mux := http.NewServeMux()
 	server := httptest.NewServer(mux)
 	mux.HandleFunc(DocStoreAPIPath+GTGEndpoint, func(w http.ResponseWriter, r *http.Request) {
@@ -222,6 +363,16 @@ func getMockedServer(docStoreAPIStatus, internalContentAPIStatus int) *httptest.
 	mux.HandleFunc(InternalContentAPIPath+GTGEndpoint, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(internalContentAPIStatus)
 	})
+	mux.HandleFunc(ContentCollectionRWPath+GTGEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(contentCollectionRWStatus)
+	})
+	mux.HandleFunc(OpenPolicyAgentPath+"/health", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["bundles"]; !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(openPolicyAgentStatus)
+	})
 	return server
 }
 
@@ -270,3 +421,29 @@ func (p *mockConsumer) ConnectivityCheck() error {
 
 	return fmt.Errorf("error connecting to the queue")
 }
+
+type mockProcessor struct {
+	err           error
+	forwardingErr error
+}
+
+func (p *mockProcessor) ProcessingLoopCheck() error {
+	return p.err
+}
+
+func (p *mockProcessor) ForwardingCheck() (string, error) {
+	if p.forwardingErr != nil {
+		return "", p.forwardingErr
+	}
+	return ResponseOK, nil
+}
+
+func TestChecks_Without_OpenPolicyAgent(t *testing.T) {
+	h := NewCombinerHealthcheck(nil, nil, nil, nil, nil, "doc-store-base-url", "internal-content-api-base-url", "content-collection-rw-base-url", "")
+	for _, c := range h.Checks() {
+		assert.NotEqual(t, "Check the open policy agent sidecar", c.Name)
+	}
+
+	h = NewCombinerHealthcheck(nil, nil, nil, nil, nil, "doc-store-base-url", "internal-content-api-base-url", "content-collection-rw-base-url", "open-policy-agent-url")
+	assert.Equal(t, "Check the open policy agent sidecar", h.Checks()[len(h.Checks())-1].Name)
+}
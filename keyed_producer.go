@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/IBM/sarama"
+)
+
+// topicProducer sends the messages of a topic, keyed or not.
+type topicProducer interface {
+	SendMessage(message kafka.FTMessage) error
+	ConnectivityCheck() error
+	Close() error
+}
+
+func newTopicProducer(config kafka.ProducerConfig, keyed bool) (topicProducer, error) {
+	if keyed {
+		return newKeyedProducer(config)
+	}
+	return kafka.NewProducer(config)
+}
+
+// keyedProducer sends the messages with a key, which the kafka client doesn't support,
+// and the tombstones removing the messages of a key from the compacted topics.
+// It keeps the client producer for the connectivity checks.
+type keyedProducer struct {
+	*kafka.Producer
+	topic    string
+	producer sarama.SyncProducer
+}
+
+func newKeyedProducer(config kafka.ProducerConfig) (*keyedProducer, error) {
+	p, err := kafka.NewProducer(config)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer(strings.Split(config.BrokersConnectionString, ","), config.Options)
+	if err != nil {
+		_ = p.Close()
+		return nil, fmt.Errorf("creating keyed producer: %w", err)
+	}
+
+	return &keyedProducer{
+		Producer: p,
+		topic:    config.Topic,
+		producer: producer,
+	}, nil
+}
+
+func (p *keyedProducer) SendKeyedMessage(key string, message kafka.FTMessage) error {
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.StringEncoder(message.Build()),
+	})
+	return err
+}
+
+func (p *keyedProducer) SendTombstone(key string) error {
+	_, _, err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: p.topic,
+		Key:   sarama.StringEncoder(key),
+	})
+	return err
+}
+
+func (p *keyedProducer) Close() error {
+	return errors.Join(p.producer.Close(), p.Producer.Close())
+}
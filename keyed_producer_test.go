@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedProducer(t *testing.T) {
+	var sent []*sarama.ProducerMessage
+	record := func(m *sarama.ProducerMessage) error {
+		sent = append(sent, m)
+		return nil
+	}
+
+	mock := mocks.NewSyncProducer(t, nil)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	mock.ExpectSendMessageWithMessageCheckerFunctionAndSucceed(record)
+	p := &keyedProducer{topic: "ForcedCombinedPostPublicationEvents", producer: mock}
+
+	require.NoError(t, p.SendKeyedMessage("some_uuid", kafka.FTMessage{Headers: map[string]string{"X-Request-Id": "some-tid"}, Body: `{"deleted":true}`}))
+	require.NoError(t, p.SendTombstone("some_uuid"))
+	require.NoError(t, mock.Close())
+
+	require.Len(t, sent, 2)
+	for _, m := range sent {
+		assert.Equal(t, "ForcedCombinedPostPublicationEvents", m.Topic)
+		assert.Equal(t, sarama.StringEncoder("some_uuid"), m.Key)
+	}
+	assert.Equal(t, sarama.StringEncoder("FTMSG/1.0\r\nX-Request-Id: some-tid\r\n\r\n{\"deleted\":true}"), sent[0].Value)
+	assert.Nil(t, sent[1].Value, "a tombstone has no value")
+}
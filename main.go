@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 	"time"
 
@@ -14,18 +16,29 @@ import (
 	"github.com/Financial-Times/http-handlers-go/v2/httphandlers"
 	"github.com/Financial-Times/kafka-client-go/v4"
 	"github.com/Financial-Times/opa-client-go"
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/Financial-Times/post-publication-combiner/v2/blobstore"
+	"github.com/Financial-Times/post-publication-combiner/v2/canary"
 	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	"github.com/Financial-Times/post-publication-combiner/v2/schemaregistry"
 	status "github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	cli "github.com/jawher/mow.cli"
 	"github.com/rcrowley/go-metrics"
+	"github.com/rcrowley/go-metrics/exp"
 )
 
 const (
 	serviceName = "post-publication-combiner"
 	systemCode  = "post-publication-combiner"
+
+	encodingJSON = "json"
+	encodingAvro = "avro"
+
+	policyAgentSidecar = "sidecar"
+	policyAgentLocal   = "local"
 )
 
 func main() {
@@ -66,6 +79,78 @@ func main() {
 		Value:  "ForcedCombinedPostPublicationEvents",
 		EnvVar: "KAFKA_FORCED_COMBINED_TOPIC_NAME",
 	})
+	combinedTopicEncoding := app.String(cli.StringOpt{
+		Name:   "combinedTopicEncoding",
+		Value:  encodingJSON,
+		Desc:   "Encoding (json or avro) of the messages sent to the combined topic. Avro requires schema version 2.",
+		EnvVar: "KAFKA_COMBINED_TOPIC_ENCODING",
+	})
+	forcedCombinedTopicEncoding := app.String(cli.StringOpt{
+		Name:   "forcedCombinedTopicEncoding",
+		Value:  encodingJSON,
+		Desc:   "Encoding (json or avro) of the messages sent to the forced combined topic. Avro requires schema version 2.",
+		EnvVar: "KAFKA_FORCED_COMBINED_TOPIC_ENCODING",
+	})
+	schemaRegistryURL := app.String(cli.StringOpt{
+		Name:   "schemaRegistryURL",
+		Value:  "",
+		Desc:   "The address of the schema registry holding the Avro schemas of the combined messages.",
+		EnvVar: "SCHEMA_REGISTRY_URL",
+	})
+	schemaRegistryFile := app.String(cli.StringOpt{
+		Name:   "schemaRegistryFile",
+		Value:  "",
+		Desc:   "Index file of a local schema registry, used instead of schemaRegistryURL for tests and local runs.",
+		EnvVar: "SCHEMA_REGISTRY_FILE",
+	})
+	claimCheckDir := app.String(cli.StringOpt{
+		Name:   "claimCheckDir",
+		Value:  "",
+		Desc:   "Directory for storing combined messages larger than claimCheckThreshold. If empty, the claim check is disabled.",
+		EnvVar: "CLAIM_CHECK_DIR",
+	})
+	claimCheckThreshold := app.Int(cli.IntOpt{
+		Name:   "claimCheckThreshold",
+		Value:  900000,
+		Desc:   "Size in bytes above which combined messages are stored and a reference to them is forwarded instead.",
+		EnvVar: "CLAIM_CHECK_THRESHOLD",
+	})
+	claimCheckRetention := app.Int(cli.IntOpt{
+		Name:   "claimCheckRetention",
+		Value:  604800,
+		Desc:   "Time in seconds the messages stored in claimCheckDir are kept for. 0 keeps them forever.",
+		EnvVar: "CLAIM_CHECK_RETENTION",
+	})
+	claimCheckBaseURL := app.String(cli.StringOpt{
+		Name:   "claimCheckBaseURL",
+		Value:  "",
+		Desc:   "The address at which consumers can reach this service, used to build the URLs of the stored messages.",
+		EnvVar: "CLAIM_CHECK_BASE_URL",
+	})
+	transformConfigFile := app.String(cli.StringOpt{
+		Name:   "transformConfigFile",
+		Value:  "",
+		Desc:   "JSON file describing the transformations (projections, renames, body stripping) applied to the combined messages before forwarding. If empty, messages are forwarded as combined.",
+		EnvVar: "TRANSFORM_CONFIG_FILE",
+	})
+	quarantineTopic := app.String(cli.StringOpt{
+		Name:   "quarantineTopic",
+		Value:  "",
+		Desc:   "Topic for messages which could not be processed because of a panic. If empty, such messages are dropped.",
+		EnvVar: "KAFKA_QUARANTINE_TOPIC_NAME",
+	})
+	combinedTopicSchemaVersion := app.Int(cli.IntOpt{
+		Name:   "combinedTopicSchemaVersion",
+		Value:  1,
+		Desc:   "Schema version (1 or 2) of the messages sent to the combined topic.",
+		EnvVar: "KAFKA_COMBINED_TOPIC_SCHEMA_VERSION",
+	})
+	forcedCombinedTopicSchemaVersion := app.Int(cli.IntOpt{
+		Name:   "forcedCombinedTopicSchemaVersion",
+		Value:  1,
+		Desc:   "Schema version (1 or 2) of the messages sent to the forced combined topic.",
+		EnvVar: "KAFKA_FORCED_COMBINED_TOPIC_SCHEMA_VERSION",
+	})
 	kafkaConsumerGroupID := app.String(cli.StringOpt{
 		Name:   "kafkaConsumerGroupID",
 		Value:  "content-post-publication-combiner",
@@ -90,6 +175,12 @@ func main() {
 		Desc:   "The endpoint used for content retrieval.",
 		EnvVar: "DOCUMENT_STORE_API_ENDPOINT",
 	})
+	docStoreAPIIdentifierEndpoint := app.String(cli.StringOpt{
+		Name:   "docStoreApiIdentifierEndpoint",
+		Value:  "/content-query?identifierAuthority={authority}&identifierValue={identifierValue}",
+		Desc:   "The endpoint used for finding content by its identifiers, for the force requests.",
+		EnvVar: "DOCUMENT_STORE_API_IDENTIFIER_ENDPOINT",
+	})
 	internalContentAPIBaseURL := app.String(cli.StringOpt{
 		Name:   "internalContentApiBaseURL",
 		Value:  "http://localhost:8080/__internal-content-api",
@@ -120,15 +211,45 @@ func main() {
 			"http://cmdb.ft.com/systems/pac",
 			"http://cmdb.ft.com/systems/next-video-editor",
 		},
-		Desc:   "Origin-System-Ids that are supported to be processed from the PostPublicationEvents queue.",
+		Desc:   "Origin-System-Ids, matched exactly, that are supported to be processed from the PostPublicationEvents queue.",
 		EnvVar: "WHITELISTED_METADATA_ORIGIN_SYSTEM_HEADERS",
 	})
 	whitelistedContentTypes := app.Strings(cli.StringsOpt{
 		Name:   "whitelistedContentTypes",
 		Value:  []string{"Article", "Video", "MediaResource", "Audio", ""},
-		Desc:   "Space separated list with content types - to identify accepted content types.",
+		Desc:   "Space separated list with content types - to identify accepted content types. Glob patterns like LiveBlog* are allowed.",
 		EnvVar: "WHITELISTED_CONTENT_TYPES",
 	})
+	unknownContentTypes := app.String(cli.StringOpt{
+		Name:   "unknownContentTypes",
+		Value:  "",
+		Desc:   "What happens to the content without a type: allow, reject, or empty to forward it only if an empty content type is whitelisted.",
+		EnvVar: "UNKNOWN_CONTENT_TYPES",
+	})
+	inferContentTypes := app.Bool(cli.BoolOpt{
+		Name:   "inferContentTypes",
+		Value:  false,
+		Desc:   "Whether the type of the internal content is used for the content without a type.",
+		EnvVar: "INFER_CONTENT_TYPES",
+	})
+	contentURITypes := app.Strings(cli.StringsOpt{
+		Name:   "contentURITypes",
+		Value:  []string{},
+		Desc:   "Comma separated type:pattern pairs inferring the type of the content without one from its content URI, e.g. Video:*/video/model/*. The first matching pattern is used.",
+		EnvVar: "CONTENT_URI_TYPES",
+	})
+	processingStallTimeout := app.Int(cli.IntOpt{
+		Name:   "processingStallTimeout",
+		Value:  300,
+		Desc:   "Time in seconds a single message is allowed to be processed for, before the processing loop is reported as stalled. 0 disables the check.",
+		EnvVar: "PROCESSING_STALL_TIMEOUT",
+	})
+	forwardingTimeout := app.Int(cli.IntOpt{
+		Name:   "forwardingTimeout",
+		Value:  900,
+		Desc:   "Time in seconds messages can be received for without any combined message being forwarded, before the processing is reported as not forwarding. 0 disables the check.",
+		EnvVar: "FORWARDING_TIMEOUT",
+	})
 	kafkaAddress := app.String(cli.StringOpt{
 		Name:   "kafkaAddress",
 		Value:  "kafka:9092",
@@ -141,6 +262,12 @@ func main() {
 		Desc:   "Kafka cluster arn",
 		EnvVar: "KAFKA_CLUSTER_ARN",
 	})
+	kafkaMessageKeys := app.Bool(cli.BoolOpt{
+		Name:   "kafkaMessageKeys",
+		Value:  false,
+		Desc:   "Whether the messages of the combined, forced combined and routing topics are keyed with the UUID of their content. The forced deletions are followed by a tombstone.",
+		EnvVar: "KAFKA_MESSAGE_KEYS",
+	})
 	openPolicyAgentAddress := app.String(cli.StringOpt{
 		Name:   "openPolicyAgentAddress",
 		Desc:   "Open policy agent sidecar address",
@@ -156,9 +283,205 @@ func main() {
 		Desc:   "The path, inside the agent, to the policy for Kafka ingestion of metadata (annotations).",
 		EnvVar: "OPEN_POLICY_AGENT_KAFKA_INGEST_METADATA_PATH",
 	})
+	opaKafkaIngestForcePolicyPath := app.String(cli.StringOpt{
+		Name:   "opaKafkaIngestForcePolicyPath",
+		Desc:   "The path, inside the agent, to the policy for the force requests.",
+		EnvVar: "OPEN_POLICY_AGENT_KAFKA_INGEST_FORCE_PATH",
+	})
+	opaKafkaIngestContentErrorMode := app.String(cli.StringOpt{
+		Name:   "opaKafkaIngestContentErrorMode",
+		Value:  string(processor.PolicyErrorSkip),
+		Desc:   "What happens to content messages when their policy can't be evaluated: skip (drop the message), allow (forward it with a warning header) or hold (send it to policyHoldTopic).",
+		EnvVar: "OPEN_POLICY_AGENT_KAFKA_INGEST_CONTENT_ERROR_MODE",
+	})
+	opaKafkaIngestMetadataErrorMode := app.String(cli.StringOpt{
+		Name:   "opaKafkaIngestMetadataErrorMode",
+		Value:  string(processor.PolicyErrorSkip),
+		Desc:   "What happens to metadata messages when their policy can't be evaluated: skip (drop the message), allow (forward it with a warning header) or hold (send it to policyHoldTopic).",
+		EnvVar: "OPEN_POLICY_AGENT_KAFKA_INGEST_METADATA_ERROR_MODE",
+	})
+	opaKafkaIngestForceErrorMode := app.String(cli.StringOpt{
+		Name:   "opaKafkaIngestForceErrorMode",
+		Value:  string(processor.PolicyErrorSkip),
+		Desc:   "What happens to force requests when their policy can't be evaluated: skip (fail the request), allow (publish with a warning header) or hold (send the request to policyHoldTopic).",
+		EnvVar: "OPEN_POLICY_AGENT_KAFKA_INGEST_FORCE_ERROR_MODE",
+	})
+	policyHoldTopic := app.String(cli.StringOpt{
+		Name:   "policyHoldTopic",
+		Value:  "",
+		Desc:   "Topic for messages whose policies couldn't be evaluated, when their policy is in hold mode.",
+		EnvVar: "KAFKA_POLICY_HOLD_TOPIC_NAME",
+	})
+	auditLogSize := app.Int(cli.IntOpt{
+		Name:   "auditLogSize",
+		Value:  1000,
+		Desc:   "Number of the most recent policy skip decisions kept in memory and exposed on /__audit. 0 disables the audit log.",
+		EnvVar: "AUDIT_LOG_SIZE",
+	})
+	canaryUUID := app.String(cli.StringOpt{
+		Name:   "canaryUUID",
+		Desc:   "UUID of the synthetic content periodically published through the processing to check the pipeline end to end. Empty disables the canary.",
+		EnvVar: "CANARY_UUID",
+	})
+	canaryInterval := app.Int(cli.IntOpt{
+		Name:   "canaryInterval",
+		Value:  60,
+		Desc:   "Time in seconds between the canary publications.",
+		EnvVar: "CANARY_INTERVAL",
+	})
+	canaryDeadline := app.Int(cli.IntOpt{
+		Name:   "canaryDeadline",
+		Value:  30,
+		Desc:   "Time in seconds the combined message of a canary publication has to be forwarded in.",
+		EnvVar: "CANARY_DEADLINE",
+	})
+	shutdownTimeout := app.Int(cli.IntOpt{
+		Name:   "shutdownTimeout",
+		Value:  25,
+		Desc:   "Time in seconds the in-flight requests and the buffered messages are waited for on shutdown.",
+		EnvVar: "SHUTDOWN_TIMEOUT",
+	})
+	healthcheckInterval := app.Int(cli.IntOpt{
+		Name:   "healthcheckInterval",
+		Value:  15,
+		Desc:   "Time in seconds between the background evaluations of the healthchecks, whose results are served by /__health and /__gtg. 0 evaluates them on every request.",
+		EnvVar: "HEALTHCHECK_INTERVAL",
+	})
+	authAPIKeys := app.Strings(cli.StringsOpt{
+		Name:   "authAPIKeys",
+		Value:  []string{},
+		Desc:   "API keys of the callers of the service endpoints, as caller:key pairs. The key is sent in the X-Api-Key header.",
+		EnvVar: "AUTH_API_KEYS",
+	})
+	authHMACSecrets := app.Strings(cli.StringsOpt{
+		Name:   "authHMACSecrets",
+		Value:  []string{},
+		Desc:   "Secrets the callers of the service endpoints sign their requests with, as keyId:secret pairs. The key ID is the caller.",
+		EnvVar: "AUTH_HMAC_SECRETS",
+	})
+	authJWKSFile := app.String(cli.StringOpt{
+		Name:   "authJWKSFile",
+		Value:  "",
+		Desc:   "JWKS file with the keys the bearer tokens of the callers of the service endpoints are verified with.",
+		EnvVar: "AUTH_JWKS_FILE",
+	})
+	authJWTIssuer := app.String(cli.StringOpt{
+		Name:   "authJWTIssuer",
+		Value:  "",
+		Desc:   "Issuer the bearer tokens must have. Not checked if empty.",
+		EnvVar: "AUTH_JWT_ISSUER",
+	})
+	authJWTAudience := app.String(cli.StringOpt{
+		Name:   "authJWTAudience",
+		Value:  "",
+		Desc:   "Audience the bearer tokens must have. Not checked if empty.",
+		EnvVar: "AUTH_JWT_AUDIENCE",
+	})
+	authRateLimit := app.Int(cli.IntOpt{
+		Name:   "authRateLimit",
+		Value:  60,
+		Desc:   "Requests per minute each authenticated caller can make to the service endpoints. 0 means no limit.",
+		EnvVar: "AUTH_RATE_LIMIT",
+	})
+	authRateLimitBurst := app.Int(cli.IntOpt{
+		Name:   "authRateLimitBurst",
+		Value:  10,
+		Desc:   "Requests each authenticated caller can make at once, above the rate limit.",
+		EnvVar: "AUTH_RATE_LIMIT_BURST",
+	})
+	authRateLimits := app.Strings(cli.StringsOpt{
+		Name:   "authRateLimits",
+		Value:  []string{},
+		Desc:   "Rate limits of particular callers, as caller:perMinute pairs. 0 means no limit.",
+		EnvVar: "AUTH_RATE_LIMITS",
+	})
+	forcePrivilegedCallers := app.Strings(cli.StringsOpt{
+		Name:   "forcePrivilegedCallers",
+		Value:  []string{},
+		Desc:   "Authenticated callers allowed to choose the topic, the headers and the origin of the forced messages, and to bypass the force policy.",
+		EnvVar: "FORCE_PRIVILEGED_CALLERS",
+	})
+	fanOutEnabled := app.Bool(cli.BoolOpt{
+		Name:   "fanOutEnabled",
+		Value:  false,
+		Desc:   "Whether the members of the forwarded packages are recombined on the forced combined topic.",
+		EnvVar: "PACKAGE_FAN_OUT_ENABLED",
+	})
+	fanOutContentTypes := app.Strings(cli.StringsOpt{
+		Name:   "fanOutContentTypes",
+		Value:  []string{"ContentPackage", "LiveBlogPackage"},
+		Desc:   "Content types, or glob patterns of them, of the packages whose members are recombined.",
+		EnvVar: "PACKAGE_FAN_OUT_CONTENT_TYPES",
+	})
+	fanOutMaxMembers := app.Int(cli.IntOpt{
+		Name:   "fanOutMaxMembers",
+		Value:  100,
+		Desc:   "Number of members recombined per package. The others are skipped.",
+		EnvVar: "PACKAGE_FAN_OUT_MAX_MEMBERS",
+	})
+	fanOutQueueSize := app.Int(cli.IntOpt{
+		Name:   "fanOutQueueSize",
+		Value:  1000,
+		Desc:   "Number of package members waiting to be recombined. Members are dropped while the queue is full.",
+		EnvVar: "PACKAGE_FAN_OUT_QUEUE_SIZE",
+	})
+	fanOutCooldown := app.Int(cli.IntOpt{
+		Name:   "fanOutCooldown",
+		Value:  300,
+		Desc:   "Time in seconds a recombined package member isn't recombined again for.",
+		EnvVar: "PACKAGE_FAN_OUT_COOLDOWN",
+	})
+	runtimeConfigFile := app.String(cli.StringOpt{
+		Name:   "runtimeConfigFile",
+		Value:  "",
+		Desc:   "JSON file overriding the whitelisted content types and origin systems, the routing topics and the upstream URLs. It is reloaded every time it changes.",
+		EnvVar: "RUNTIME_CONFIG_FILE",
+	})
+	runtimeConfigReloadInterval := app.Int(cli.IntOpt{
+		Name:   "runtimeConfigReloadInterval",
+		Value:  30,
+		Desc:   "Time in seconds between checks of runtimeConfigFile for changes. 0 disables the reloading.",
+		EnvVar: "RUNTIME_CONFIG_RELOAD_INTERVAL",
+	})
+	policyRoutingTopics := app.Strings(cli.StringsOpt{
+		Name:   "policyRoutingTopics",
+		Value:  []string{},
+		Desc:   "Topics the policy decisions are allowed to route combined messages to, instead of the combined or forced combined topic.",
+		EnvVar: "KAFKA_POLICY_ROUTING_TOPICS",
+	})
+	policyInputMode := app.String(cli.StringOpt{
+		Name:   "policyInputMode",
+		Value:  string(processor.PolicyInputEvent),
+		Desc:   "What the policies are evaluated against: event (the content event body, or the combined content for metadata and force requests) or combined (the whole combined message and the event headers).",
+		EnvVar: "POLICY_INPUT_MODE",
+	})
+	policyAgentMode := app.String(cli.StringOpt{
+		Name:   "policyAgentMode",
+		Value:  policyAgentSidecar,
+		Desc:   "Where the policies are evaluated: sidecar (the Open policy agent at openPolicyAgentAddress) or local (in-process, from policyFiles).",
+		EnvVar: "POLICY_AGENT_MODE",
+	})
+	policyFiles := app.Strings(cli.StringsOpt{
+		Name:   "policyFiles",
+		Value:  []string{},
+		Desc:   "Rego files, data files, directories holding them, or bundles (.tar.gz) the policies are loaded from in local mode.",
+		EnvVar: "POLICY_FILES",
+	})
+	policyReloadInterval := app.Int(cli.IntOpt{
+		Name:   "policyReloadInterval",
+		Value:  30,
+		Desc:   "Time in seconds between checks of policyFiles for changes in local mode. 0 disables the reloading.",
+		EnvVar: "POLICY_RELOAD_INTERVAL",
+	})
 
 	log := logger.NewUPPLogger(serviceName, *logLevel)
 
+	app.Command(
+		"policy-regression",
+		"Reports which recorded events the policies would skip, and the differences from a baseline version of the policies",
+		policyRegressionCmd(opaKafkaIngestContentPolicyPath, opaKafkaIngestMetadataPolicyPath, policyInputMode),
+	)
+
 	app.Action = func() {
 		client := &http.Client{
 			Transport: &http.Transport{
@@ -173,14 +496,91 @@ func main() {
 			},
 		}
 
+		combinedSchemaVersion, err := processor.ParseSchemaVersion(*combinedTopicSchemaVersion)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid schema version for the combined topic")
+		}
+		forcedCombinedSchemaVersion, err := processor.ParseSchemaVersion(*forcedCombinedTopicSchemaVersion)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid schema version for the forced combined topic")
+		}
+
+		var registry schemaregistry.Registry
+		if *schemaRegistryFile != "" {
+			registry, err = schemaregistry.NewFileRegistry(*schemaRegistryFile)
+			if err != nil {
+				log.WithError(err).Fatal("Could not load the local schema registry")
+			}
+		} else if *schemaRegistryURL != "" {
+			registry = schemaregistry.NewClient(*schemaRegistryURL, client)
+		}
+
+		var claimCheck *processor.ClaimCheckConfig
+		var claimCheckReqHandler *claimCheckHandler
+		if *claimCheckDir != "" {
+			store, err := blobstore.NewFileStore(*claimCheckDir)
+			if err != nil {
+				log.WithError(err).Fatal("Could not create the claim check store")
+			}
+
+			claimCheck = &processor.ClaimCheckConfig{
+				Store:     store,
+				Threshold: *claimCheckThreshold,
+				BaseURL:   *claimCheckBaseURL,
+			}
+			claimCheckReqHandler = &claimCheckHandler{
+				store: store,
+				log:   log,
+			}
+
+			if *claimCheckRetention < 0 {
+				log.Fatal("CLAIM_CHECK_RETENTION must not be negative")
+			}
+			if *claimCheckRetention > 0 {
+				stopSweeping := make(chan struct{})
+				defer close(stopSweeping)
+				go sweepClaimChecks(store, time.Duration(*claimCheckRetention)*time.Second, stopSweeping, log)
+			}
+		}
+
+		var transforms *processor.TransformPipeline
+		if *transformConfigFile != "" {
+			transforms, err = processor.LoadTransformPipeline(*transformConfigFile)
+			if err != nil {
+				log.WithError(err).Fatal("Could not load the transformation pipeline")
+			}
+		}
+
+		combinedForwarderConfig, err := newForwarderConfig(
+			*whitelistedContentTypes,
+			combinedSchemaVersion,
+			*combinedTopicEncoding,
+			registry,
+			*combinedTopic,
+		)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid forwarding configuration for the combined topic")
+		}
+		forcedCombinedForwarderConfig, err := newForwarderConfig(
+			*whitelistedContentTypes,
+			forcedCombinedSchemaVersion,
+			*forcedCombinedTopicEncoding,
+			registry,
+			*forcedCombinedTopic,
+		)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid forwarding configuration for the forced combined topic")
+		}
+		combinedForwarderConfig.ClaimCheck = claimCheck
+		forcedCombinedForwarderConfig.ClaimCheck = claimCheck
+		combinedForwarderConfig.Transforms = transforms
+		forcedCombinedForwarderConfig.Transforms = transforms
+
+		shutdown := newGracefulShutdown(log, time.Duration(*shutdownTimeout)*time.Second)
+
 		// create channel for holding the post publication content and metadata messages
+		// It is closed by the shutdown, once nothing can send to it anymore.
 		messagesCh := make(chan *kafka.FTMessage, 100)
-		// Please keep in mind that defer function are executed in LIFO order.
-		// And deferring the channel must be after deferring the consumers
-		defer func() {
-			log.Infof("Closing messages channel")
-			close(messagesCh)
-		}()
 
 		// consume messages from content queue
 		consumerConfig := kafka.ConsumerConfig{
@@ -205,23 +605,6 @@ func main() {
 			messagesCh <- &message
 		}
 		go consumer.Start(messageHandler)
-		defer func(consumer *kafka.Consumer) {
-			log.Infof("Closing consumer")
-			if err = consumer.Close(); err != nil {
-				log.WithError(err).Error("Consumer could not stop")
-			}
-		}(consumer)
-
-		// process and forward messages
-		docStoreURL := *docStoreAPIBaseURL + *docStoreAPIEndpoint
-		internalContentURL := *internalContentAPIBaseURL + *internalContentAPIEndpoint
-		contentCollectionURL := *contentCollectionRWBaseURL + *contentCollectionRWEndpoint
-		dataCombiner := processor.NewDataCombiner(
-			docStoreURL,
-			internalContentURL,
-			contentCollectionURL,
-			client,
-		)
 
 		producerConfig := kafka.ProducerConfig{
 			BrokersConnectionString: *kafkaAddress,
@@ -232,42 +615,210 @@ func main() {
 			producerConfig.ClusterArn = kafkaClusterArn
 		}
 
-		producer, err := kafka.NewProducer(producerConfig)
+		producer, err := newTopicProducer(producerConfig, *kafkaMessageKeys)
 		if err != nil {
 			log.WithError(err).Fatal("Could not create message producer")
 		}
-		defer func(messageProducer *kafka.Producer) {
-			log.Infof("Closing message producer")
-			if err = messageProducer.Close(); err != nil {
-				log.WithError(err).Error("Message producer could not stop")
-			}
-		}(producer)
+		shutdown.closeOnExit("message producer", producer)
 
 		policyPaths := map[string]string{
 			policy.KafkaIngestContent.String():  *opaKafkaIngestContentPolicyPath,
 			policy.KafkaIngestMetadata.String(): *opaKafkaIngestMetadataPolicyPath,
+			policy.KafkaIngestForce.String():    *opaKafkaIngestForcePolicyPath,
 		}
 
-		opaClient := opa.NewOpenPolicyAgentClient(
-			*openPolicyAgentAddress,
-			policyPaths,
-			opa.WithLogger(log),
-		)
-		opaAgent := policy.NewOpenPolicyAgent(opaClient, log)
+		var opaAgent policy.Agent
+		// The sidecar is only checked if the policies are evaluated there.
+		var opaHealthURL string
+		switch *policyAgentMode {
+		case policyAgentSidecar:
+			opaHealthURL = *openPolicyAgentAddress
+			opaClient := opa.NewOpenPolicyAgentClient(
+				*openPolicyAgentAddress,
+				policyPaths,
+				opa.WithLogger(log),
+			)
+			opaAgent = policy.NewOpenPolicyAgent(opaClient, log)
+		case policyAgentLocal:
+			localAgent, err := policy.NewLocalAgent(*policyFiles, policyPaths, log)
+			if err != nil {
+				log.WithError(err).Fatal("Could not load the policies")
+			}
+			if *policyReloadInterval > 0 {
+				stopWatching := make(chan struct{})
+				defer close(stopWatching)
+				go func() {
+					if err := localAgent.Watch(stopWatching, time.Duration(*policyReloadInterval)*time.Second); err != nil {
+						log.WithError(err).Error("Could not watch the policy files for changes")
+					}
+				}()
+			}
+			opaAgent = localAgent
+		default:
+			log.Fatalf("Unknown policy agent mode %q", *policyAgentMode)
+		}
+
+		var processorOpts []processor.MsgProcessorOption
+		if *quarantineTopic != "" {
+			quarantineProducerConfig := kafka.ProducerConfig{
+				BrokersConnectionString: *kafkaAddress,
+				Topic:                   *quarantineTopic,
+				Options:                 kafka.DefaultProducerOptions(),
+			}
+			if *kafkaClusterArn != "" {
+				quarantineProducerConfig.ClusterArn = kafkaClusterArn
+			}
+
+			quarantineProducer, err := kafka.NewProducer(quarantineProducerConfig)
+			if err != nil {
+				log.WithError(err).Fatal("Could not create quarantine message producer")
+			}
+			shutdown.closeOnExit("quarantine message producer", quarantineProducer)
+
+			processorOpts = append(processorOpts, processor.WithQuarantine(quarantineProducer))
+		}
+
+		policyErrors := processor.PolicyErrorConfig{
+			Modes: map[policy.Policy]processor.PolicyErrorMode{},
+		}
+		for p, mode := range map[policy.Policy]string{
+			policy.KafkaIngestContent:  *opaKafkaIngestContentErrorMode,
+			policy.KafkaIngestMetadata: *opaKafkaIngestMetadataErrorMode,
+			policy.KafkaIngestForce:    *opaKafkaIngestForceErrorMode,
+		} {
+			policyErrors.Modes[p], err = processor.ParsePolicyErrorMode(mode)
+			if err != nil {
+				log.WithError(err).Fatalf("Invalid error mode for the %s policy", p)
+			}
+		}
+		if *policyHoldTopic != "" {
+			holdProducerConfig := kafka.ProducerConfig{
+				BrokersConnectionString: *kafkaAddress,
+				Topic:                   *policyHoldTopic,
+				Options:                 kafka.DefaultProducerOptions(),
+			}
+			if *kafkaClusterArn != "" {
+				holdProducerConfig.ClusterArn = kafkaClusterArn
+			}
+
+			holdProducer, err := kafka.NewProducer(holdProducerConfig)
+			if err != nil {
+				log.WithError(err).Fatal("Could not create policy hold message producer")
+			}
+			shutdown.closeOnExit("policy hold message producer", holdProducer)
+
+			policyErrors.Hold = holdProducer
+		}
+		if err = policyErrors.Validate(); err != nil {
+			log.WithError(err).Fatal("Invalid policy error configuration")
+		}
+		processorOpts = append(processorOpts, processor.WithPolicyErrors(policyErrors))
+
+		routes := &routeProducers{
+			create: func(topic string) (messageSender, error) {
+				routeProducerConfig := kafka.ProducerConfig{
+					BrokersConnectionString: *kafkaAddress,
+					Topic:                   topic,
+					Options:                 kafka.DefaultProducerOptions(),
+				}
+				if *kafkaClusterArn != "" {
+					routeProducerConfig.ClusterArn = kafkaClusterArn
+				}
+
+				routeProducer, err := newTopicProducer(routeProducerConfig, *kafkaMessageKeys)
+				if err != nil {
+					return nil, err
+				}
+				shutdown.closeOnExit(topic+" message producer", routeProducer)
+				return routeProducer, nil
+			},
+			producers: processor.TopicProducers{},
+		}
+
+		unknownTypes, err := processor.ParseUnknownContentTypes(*unknownContentTypes)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid UNKNOWN_CONTENT_TYPES")
+		}
+		uriTypes, err := parseContentURITypes(*contentURITypes)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid CONTENT_URI_TYPES")
+		}
+
+		// The runtime configuration file overrides the environment variables, and is reloaded every time it changes.
+		settings := processor.NewSettingsStore(processor.Settings{})
+		configReloader := &configReloader{
+			path: *runtimeConfigFile,
+			defaults: runtimeConfig{
+				WhitelistedContentTypes: *whitelistedContentTypes,
+				ContentTypes: processor.ContentTypeConfig{
+					Unknown:                  unknownTypes,
+					InferFromInternalContent: *inferContentTypes,
+					URITypes:                 uriTypes,
+				},
+				WhitelistedMetadataOriginSystemHeaders: *whitelistedMetadataOriginSystemHeaders,
+				RoutingTopics:                          *policyRoutingTopics,
+				Upstreams: runtimeUpstreams{
+					DocumentStore:     *docStoreAPIBaseURL,
+					InternalContent:   *internalContentAPIBaseURL,
+					ContentCollection: *contentCollectionRWBaseURL,
+				},
+				endpoints: upstreamEndpoints{
+					DocumentStore:           *docStoreAPIEndpoint,
+					DocumentStoreIdentifier: *docStoreAPIIdentifierEndpoint,
+					InternalContent:         *internalContentAPIEndpoint,
+					ContentCollection:       *contentCollectionRWEndpoint,
+				},
+			},
+			settings: settings,
+			routes:   routes,
+			log:      log,
+		}
+		if err = configReloader.reload(); err != nil {
+			log.WithError(err).Fatal("Invalid runtime configuration")
+		}
+		if *runtimeConfigFile != "" && *runtimeConfigReloadInterval > 0 {
+			stopWatching := make(chan struct{})
+			defer close(stopWatching)
+			go func() {
+				if err := configReloader.watch(stopWatching, time.Duration(*runtimeConfigReloadInterval)*time.Second); err != nil {
+					log.WithError(err).Error("Could not watch the runtime configuration file for changes")
+				}
+			}()
+		}
+		combinedForwarderConfig.Settings = settings
+		forcedCombinedForwarderConfig.Settings = settings
+
+		// process and forward messages
+		dataCombiner := processor.NewReloadableDataCombiner(settings, client)
+
+		policyInput, err := processor.ParsePolicyInputMode(*policyInputMode)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid policy input mode")
+		}
+		processorOpts = append(processorOpts, processor.WithPolicyInput(policyInput))
+
+		if *auditLogSize < 0 {
+			log.Fatal("AUDIT_LOG_SIZE must not be negative")
+		}
+		auditLog := audit.NewLog(*auditLogSize)
+		processorOpts = append(processorOpts, processor.WithAudit(auditLog))
 
 		processorConf := processor.NewMsgProcessorConfig(
 			*whitelistedMetadataOriginSystemHeaders,
+			time.Duration(*processingStallTimeout)*time.Second,
+			time.Duration(*forwardingTimeout)*time.Second,
 		)
-		msgProcessor := processor.NewMsgProcessor(
-			log,
-			messagesCh,
-			processorConf,
-			dataCombiner,
-			producer,
-			opaAgent,
-			*whitelistedContentTypes,
-		)
-		go msgProcessor.ProcessMessages()
+		var combinedProducer messageSender = producer
+		var canaryPublisher *canary.Canary
+		if *canaryUUID != "" {
+			canaryPublisher = canary.New(canary.Config{
+				UUID:     *canaryUUID,
+				Topic:    *contentTopic,
+				Interval: time.Duration(*canaryInterval) * time.Second,
+				Deadline: time.Duration(*canaryDeadline) * time.Second,
+			}, messagesCh, log)
+			combinedProducer = canaryPublisher.Observe(producer)
+		}
 
 		// process requested messages - used for re-indexing and forced requests
 		forcedProducerConfig := kafka.ProducerConfig{
@@ -279,29 +830,79 @@ func main() {
 			forcedProducerConfig.ClusterArn = kafkaClusterArn
 		}
 
-		forcedMessageProducer, err := kafka.NewProducer(forcedProducerConfig)
+		forcedMessageProducer, err := newTopicProducer(forcedProducerConfig, *kafkaMessageKeys)
 		if err != nil {
 			log.WithError(err).Fatal("Could not create force message producer")
 		}
-
-		defer func(forcedMessageProducer *kafka.Producer) {
-			log.Infof("Closing force messages producer")
-			if err = forcedMessageProducer.Close(); err != nil {
-				log.WithError(err).Error("Force message producer could not stop")
-			}
-		}(forcedMessageProducer)
+		shutdown.closeOnExit("force messages producer", forcedMessageProducer)
 
 		proc := processor.NewRequestProcessor(
 			dataCombiner,
 			forcedMessageProducer,
-			*whitelistedContentTypes,
+			forcedCombinedForwarderConfig,
 			log,
 			opaAgent,
+			processor.WithRequestPolicyErrors(policyErrors),
+			processor.WithRequestPolicyInput(policyInput),
+			processor.WithRequestAudit(auditLog),
+			processor.WithLiveForwarding(producer, combinedForwarderConfig),
+		)
+
+		stopFanOut := make(chan struct{})
+		fanOutStopped := make(chan struct{})
+		if *fanOutEnabled {
+			if *fanOutMaxMembers < 1 || *fanOutQueueSize < 1 {
+				log.Fatal("PACKAGE_FAN_OUT_MAX_MEMBERS and PACKAGE_FAN_OUT_QUEUE_SIZE must be positive")
+			}
+			fanOut := processor.NewFanOut(proc, processor.FanOutConfig{
+				ContentTypes: *fanOutContentTypes,
+				MaxMembers:   *fanOutMaxMembers,
+				QueueSize:    *fanOutQueueSize,
+				Cooldown:     time.Duration(*fanOutCooldown) * time.Second,
+			}, log)
+			processorOpts = append(processorOpts, processor.WithFanOut(fanOut))
+			go func() {
+				fanOut.Run(stopFanOut)
+				close(fanOutStopped)
+			}()
+		}
+
+		msgProcessor := processor.NewMsgProcessor(
+			log,
+			messagesCh,
+			processorConf,
+			dataCombiner,
+			combinedProducer,
+			opaAgent,
+			combinedForwarderConfig,
+			processorOpts...,
 		)
+		processingDone := make(chan struct{})
+		go func() {
+			msgProcessor.ProcessMessages()
+			close(processingDone)
+		}()
 
+		var additionalChecks []health.Check
+		stopCanary := make(chan struct{})
+		canaryStopped := make(chan struct{})
+		if canaryPublisher != nil {
+			go func() {
+				canaryPublisher.Run(stopCanary)
+				close(canaryStopped)
+			}()
+			additionalChecks = append(additionalChecks, checkCanary(canaryPublisher))
+		}
+
+		privilegedCallers := map[string]bool{}
+		for _, caller := range *forcePrivilegedCallers {
+			privilegedCallers[caller] = true
+		}
 		reqHandler := &requestHandler{
-			requestProcessor: proc,
-			log:              log,
+			requestProcessor:  proc,
+			uuidResolver:      processor.NewReloadableUUIDResolver(settings, client),
+			privilegedCallers: privilegedCallers,
+			log:               log,
 		}
 
 		// Since the health check for all producers and consumers just checks /topics for a response, we pick a producer and a consumer at random
@@ -309,12 +910,79 @@ func main() {
 			log,
 			producer,
 			consumer,
+			msgProcessor,
 			client,
 			*docStoreAPIBaseURL,
 			*internalContentAPIBaseURL,
+			*contentCollectionRWBaseURL,
+			opaHealthURL,
 		)
+		healthcheckHandler.settings = settings
+
+		var healthService healthChecker = healthcheckHandler
+		if *healthcheckInterval > 0 {
+			cachedHealthcheck := NewCachedHealthcheck(healthcheckHandler.Checks(), time.Duration(*healthcheckInterval)*time.Second)
+			stopHealthchecks := make(chan struct{})
+			defer close(stopHealthchecks)
+			go cachedHealthcheck.Run(stopHealthchecks)
+			healthService = cachedHealthcheck
+		}
+
+		auditReqHandler := &auditHandler{
+			audit: auditLog,
+			log:   log,
+		}
+
+		authenticate, err := newAuthMiddleware(authConfig{
+			apiKeys:     *authAPIKeys,
+			hmacSecrets: *authHMACSecrets,
+			jwksFile:    *authJWKSFile,
+			jwtIssuer:   *authJWTIssuer,
+			jwtAudience: *authJWTAudience,
+			rateLimit:   *authRateLimit,
+			rateBurst:   *authRateLimitBurst,
+			rateLimits:  *authRateLimits,
+		}, log)
+		if err != nil {
+			log.WithError(err).Fatal("Invalid authentication configuration")
+		}
+		if authenticate == nil {
+			log.Warn("No authentication is configured, the service endpoints are open to everyone")
+		}
+
+		server := routeRequests(log, port, reqHandler, claimCheckReqHandler, auditReqHandler, configReloader, healthService, additionalChecks, authenticate)
+
+		shutdown.add("Stopping the HTTP server and waiting for the in-flight requests", server.Shutdown)
+		if canaryPublisher != nil {
+			// The canary sends to the messages channel, so it must have stopped before the channel is closed.
+			shutdown.add("Stopping the canary", func(context.Context) error {
+				close(stopCanary)
+				<-canaryStopped
+				return nil
+			})
+		}
+		// The consumer must have stopped before the messages channel is closed, as it sends to it too.
+		shutdown.add("Stopping the consumer", func(context.Context) error {
+			return consumer.Close()
+		})
+		shutdown.add("Processing the buffered messages", func(ctx context.Context) error {
+			log.Infof("[Shutdown] %d messages are buffered", len(messagesCh))
+			close(messagesCh)
+			if err := waitFor(ctx, processingDone); err != nil {
+				return fmt.Errorf("%d buffered messages weren't processed: %w", len(messagesCh), err)
+			}
+			return nil
+		})
+		if *fanOutEnabled {
+			shutdown.add("Stopping the package fan-out", func(ctx context.Context) error {
+				close(stopFanOut)
+				return waitFor(ctx, fanOutStopped)
+			})
+		}
+		shutdown.add("Closing the producers", shutdown.closeProducers)
 
-		routeRequests(log, port, reqHandler, healthcheckHandler)
+		waitForSignal()
+		shutdown.run()
 	}
 
 	log.Infof("PostPublicationCombiner is starting with args %v", os.Args)
@@ -324,42 +992,85 @@ func main() {
 	}
 }
 
+func newForwarderConfig(
+	contentTypes []string,
+	version processor.SchemaVersion,
+	encoding string,
+	registry schemaregistry.Registry,
+	topic string,
+) (processor.ForwarderConfig, error) {
+	config := processor.ForwarderConfig{
+		SupportedContentTypes: contentTypes,
+		SchemaVersion:         version,
+	}
+
+	switch encoding {
+	case encodingJSON:
+		return config, nil
+	case encodingAvro:
+		if version != processor.SchemaV2 {
+			return config, fmt.Errorf("avro encoding requires schema version %s", processor.SchemaV2)
+		}
+		if registry == nil {
+			return config, errors.New("avro encoding requires a schema registry")
+		}
+
+		encoder, err := processor.NewAvroEncoder(registry, schemaregistry.TopicSubject(topic))
+		if err != nil {
+			return config, err
+		}
+		config.Encoder = encoder
+		return config, nil
+	}
+
+	return config, fmt.Errorf("unsupported encoding: %q", encoding)
+}
+
 func routeRequests(
 	log *logger.UPPLogger,
 	port *string,
 	requestHandler *requestHandler,
-	healthService *HealthcheckHandler,
-) {
+	claimCheckHandler *claimCheckHandler,
+	auditHandler *auditHandler,
+	configReloader *configReloader,
+	healthService healthChecker,
+	additionalChecks []health.Check,
+	authenticate func(http.Handler) http.Handler,
+) *http.Server {
 	r := http.NewServeMux()
 
 	r.HandleFunc(status.BuildInfoPath, status.BuildInfoHandler)
 	r.HandleFunc(status.PingPath, status.PingHandler)
 	r.HandleFunc(status.GTGPath, status.NewGoodToGoHandler(healthService.GTG))
 
-	checks := []health.Check{
-		checkKafkaProducerConnectivity(healthService),
-		checkKafkaConsumerConnectivity(healthService),
-		monitorKafkaConsumers(healthService),
-		checkDocumentStoreAPIHealthcheck(healthService),
-		checkInternalContentAPIHealthcheck(healthService),
-	}
-
 	hc := health.TimedHealthCheck{
 		HealthCheck: health.HealthCheck{
 			SystemCode:  systemCode,
 			Name:        "post-publication-combiner",
-			Description: "Checks for service dependencies: document-store, internal-content-api, kafka proxy and the presence of related topics",
-			Checks:      checks,
+			Description: "Checks for service dependencies: document-store, internal-content-api, content-collection-rw, the open policy agent, kafka proxy and the presence of related topics",
+			Checks:      append(healthService.Checks(), additionalChecks...),
 		},
 		Timeout: 10 * time.Second,
 	}
 
 	r.Handle("/__health", handlers.MethodHandler{"GET": http.HandlerFunc(health.Handler(hc))})
+	r.Handle("/__metrics", handlers.MethodHandler{"GET": exp.ExpHandler(metrics.DefaultRegistry)})
+	r.Handle("/__audit", handlers.MethodHandler{"GET": http.HandlerFunc(auditHandler.getEntries)})
+	r.Handle("/__config", handlers.MethodHandler{"GET": http.HandlerFunc(configReloader.getConfig)})
 
 	servicesRouter := mux.NewRouter()
+	servicesRouter.HandleFunc("/by-identifier", requestHandler.publishByIdentifier).Methods("POST")
+	servicesRouter.HandleFunc("/by-uri", requestHandler.publishByContentURI).Methods("POST")
 	servicesRouter.HandleFunc("/{id}", requestHandler.publishMessage).Methods("POST")
+	servicesRouter.HandleFunc("/{id}", requestHandler.deleteMessage).Methods("DELETE")
+	if claimCheckHandler != nil {
+		servicesRouter.HandleFunc(processor.ClaimCheckPath+"{ref}", claimCheckHandler.getMessage).Methods("GET")
+	}
 
 	var monitoringRouter http.Handler = servicesRouter
+	if authenticate != nil {
+		monitoringRouter = authenticate(monitoringRouter)
+	}
 	monitoringRouter = httphandlers.TransactionAwareRequestLoggingHandler(log, monitoringRouter)
 	monitoringRouter = httphandlers.HTTPMetricsHandler(metrics.DefaultRegistry, monitoringRouter)
 
@@ -367,24 +1078,13 @@ func routeRequests(
 
 	server := &http.Server{Addr: ":" + *port, Handler: r}
 
-	wg := sync.WaitGroup{}
-
-	wg.Add(1)
 	go func() {
 		if err := server.ListenAndServe(); err != nil {
 			log.Infof("HTTP server closing with message: %v", err)
 		}
-		wg.Done()
 	}()
 
-	waitForSignal()
-	log.Infof("[Shutdown] PostPublicationCombiner is shutting down")
-
-	if err := server.Close(); err != nil {
-		log.WithError(err).Error("Unable to stop http server")
-	}
-
-	wg.Wait()
+	return server
 }
 
 func waitForSignal() {
@@ -15,6 +15,7 @@ type Policy int
 const (
 	KafkaIngestContent Policy = iota
 	KafkaIngestMetadata
+	KafkaIngestForce
 )
 
 func (p Policy) String() string {
@@ -23,6 +24,8 @@ func (p Policy) String() string {
 		return "kafka_ingest_content"
 	case KafkaIngestMetadata:
 		return "kafka_ingest_metadata"
+	case KafkaIngestForce:
+		return "kafka_ingest_force"
 	}
 
 	return ""
@@ -31,6 +34,14 @@ func (p Policy) String() string {
 type ContentPolicyResult struct {
 	Skip    bool     `json:"skip"`
 	Reasons []string `json:"reasons"`
+	// Topic the message is forwarded to, instead of the default one.
+	Topic string `json:"topic,omitempty"`
+	// Headers added to the forwarded message.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Redact lists the paths of the fields removed from the forwarded message, e.g. "internalContent.bodyXML".
+	Redact []string `json:"redact,omitempty"`
+	// DecisionID identifies the decision in the decision logs of the agent. It is set by the agent, not by the policy.
+	DecisionID string `json:"-"`
 }
 
 type Agent interface {
@@ -59,6 +70,7 @@ func (o *OpenPolicyAgent) EvaluateKafkaIngestPolicy(
 	if err != nil {
 		return nil, fmt.Errorf("%w: Content Policy: %w", ErrEvaluatePolicy, err)
 	}
+	r.DecisionID = decisionID
 
 	o.log.Infof(
 		"Evaluated Kafka Ingest Policy: %s: decisionID: %q, result: %v",
@@ -48,8 +48,9 @@ func TestAgent_EvaluateContentPolicy(t *testing.T) {
 			},
 			policy: KafkaIngestContent,
 			expectedResult: &ContentPolicyResult{
-				Skip:    true,
-				Reasons: []string{errMsgЕditorialDeskCB},
+				Skip:       true,
+				Reasons:    []string{errMsgЕditorialDeskCB},
+				DecisionID: testDecisionID,
 			},
 			expectedError: nil,
 		},
@@ -64,7 +65,8 @@ func TestAgent_EvaluateContentPolicy(t *testing.T) {
 			},
 			policy: KafkaIngestContent,
 			expectedResult: &ContentPolicyResult{
-				Skip: false,
+				Skip:       false,
+				DecisionID: testDecisionID,
 			},
 			expectedError: nil,
 		},
@@ -83,8 +85,9 @@ func TestAgent_EvaluateContentPolicy(t *testing.T) {
 			},
 			policy: KafkaIngestMetadata,
 			expectedResult: &ContentPolicyResult{
-				Skip:    true,
-				Reasons: []string{errMsgЕditorialDeskCB},
+				Skip:       true,
+				Reasons:    []string{errMsgЕditorialDeskCB},
+				DecisionID: testDecisionID,
 			},
 			expectedError: nil,
 		},
@@ -99,7 +102,8 @@ func TestAgent_EvaluateContentPolicy(t *testing.T) {
 			},
 			policy: KafkaIngestMetadata,
 			expectedResult: &ContentPolicyResult{
-				Skip: false,
+				Skip:       false,
+				DecisionID: testDecisionID,
 			},
 			expectedError: nil,
 		},
@@ -0,0 +1,143 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/filewatch"
+	"github.com/google/uuid"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const bundleExtension = ".tar.gz"
+
+// LocalAgent evaluates the policies in-process, with the Rego files and bundles loaded from the local filesystem.
+type LocalAgent struct {
+	files       []string
+	policyPaths map[string]string
+	log         *logger.UPPLogger
+
+	mu      sync.RWMutex
+	queries map[string]rego.PreparedEvalQuery
+}
+
+// NewLocalAgent loads the policies from files, which can be Rego or data files, directories holding them, or bundles (.tar.gz).
+// The policy paths are the same as the ones used by the OPA sidecar, e.g. "kafka/ingest_content".
+func NewLocalAgent(files []string, policyPaths map[string]string, l *logger.UPPLogger) (*LocalAgent, error) {
+	a := &LocalAgent{
+		files:       files,
+		policyPaths: policyPaths,
+		log:         l,
+	}
+
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Reload loads and compiles the policies again. The current ones are kept if this fails.
+func (a *LocalAgent) Reload() error {
+	queries := make(map[string]rego.PreparedEvalQuery, len(a.policyPaths))
+	for name, path := range a.policyPaths {
+		options := []func(*rego.Rego){rego.Query(dataQuery(path))}
+		var files []string
+		for _, f := range a.files {
+			if strings.HasSuffix(f, bundleExtension) {
+				options = append(options, rego.LoadBundle(f))
+			} else {
+				files = append(files, f)
+			}
+		}
+		if len(files) > 0 {
+			options = append(options, rego.Load(files, nil))
+		}
+
+		q, err := rego.New(options...).PrepareForEval(context.Background())
+		if err != nil {
+			return fmt.Errorf("error preparing policy %s: %w", name, err)
+		}
+		queries[name] = q
+	}
+
+	a.mu.Lock()
+	a.queries = queries
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *LocalAgent) EvaluateKafkaIngestPolicy(
+	q map[string]interface{},
+	p Policy,
+) (*ContentPolicyResult, error) {
+	a.mu.RLock()
+	query, ok := a.queries[p.String()]
+	a.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: Content Policy: no path configured for %s", ErrEvaluatePolicy, p)
+	}
+
+	rs, err := query.Eval(context.Background(), rego.EvalInput(q))
+	if err != nil {
+		return nil, fmt.Errorf("%w: Content Policy: %w", ErrEvaluatePolicy, err)
+	}
+	if len(rs) == 0 || len(rs[0].Expressions) == 0 {
+		return nil, fmt.Errorf("%w: Content Policy: %s is undefined", ErrEvaluatePolicy, p)
+	}
+
+	// The decision is a generic JSON value, decode it the same way as the sidecar responses.
+	b, err := json.Marshal(rs[0].Expressions[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: Content Policy: %w", ErrEvaluatePolicy, err)
+	}
+	r := &ContentPolicyResult{}
+	if err = json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("%w: Content Policy: %w", ErrEvaluatePolicy, err)
+	}
+	// There are no decision logs in local mode, the ID only correlates the service logs, headers and audit entries.
+	r.DecisionID = uuid.NewString()
+
+	a.log.Infof(
+		"Evaluated Kafka Ingest Policy locally: %s: decisionID: %q, result: %v",
+		p.String(),
+		r.DecisionID,
+		r,
+	)
+
+	return r, nil
+}
+
+// Watch reloads the policies every time their files change, until stop is closed.
+func (a *LocalAgent) Watch(stop <-chan struct{}, interval time.Duration) error {
+	w, err := filewatch.NewWatcher(a.files, interval, a.log)
+	if err != nil {
+		return err
+	}
+
+	w.Run(stop, func() {
+		if err := a.Reload(); err != nil {
+			a.log.WithError(err).Error("Could not reload the policies, the previous ones are still in use")
+			return
+		}
+		a.log.Info("Reloaded the policies")
+	})
+	return nil
+}
+
+// dataQuery turns a sidecar path like "kafka/ingest_content" into the query data["kafka"]["ingest_content"].
+func dataQuery(path string) string {
+	var sb strings.Builder
+	sb.WriteString("data")
+	for _, s := range strings.Split(strings.Trim(path, "/"), "/") {
+		sb.WriteString("[" + strconv.Quote(s) + "]")
+	}
+	return sb.String()
+}
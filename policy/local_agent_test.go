@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var localPolicyPaths = map[string]string{
+	KafkaIngestContent.String():  "kafka/ingest_content",
+	KafkaIngestMetadata.String(): "kafka/ingest_metadata",
+	KafkaIngestForce.String():    "kafka/ingest_force",
+}
+
+func TestLocalAgent_EvaluateKafkaIngestPolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          map[string]interface{}
+		policy         Policy
+		expectedResult *ContentPolicyResult
+	}{
+		{
+			name:   "Evaluate a Skipping Kafka Ingest Content Policy Decision",
+			query:  map[string]interface{}{"editorialDesk": "/FT/Professional/Central Banking"},
+			policy: KafkaIngestContent,
+			expectedResult: &ContentPolicyResult{
+				Skip:    true,
+				Reasons: []string{"editorialDesk: /FT/Professional/Central Banking not allowed"},
+			},
+		},
+		{
+			name:           "Evaluate a Non-Skipping Kafka Ingest Content Policy Decision",
+			query:          map[string]interface{}{"editorialDesk": "/FT/Pink"},
+			policy:         KafkaIngestContent,
+			expectedResult: &ContentPolicyResult{Skip: false},
+		},
+		{
+			name:   "Evaluate a Skipping Kafka Ingest Metadata Policy Decision",
+			query:  map[string]interface{}{"editorialDesk": "/FT/Professional/Central Banking"},
+			policy: KafkaIngestMetadata,
+			expectedResult: &ContentPolicyResult{
+				Skip:    true,
+				Reasons: []string{"editorialDesk: /FT/Professional/Central Banking not allowed"},
+			},
+		},
+		{
+			name:           "Evaluate a Non-Skipping Kafka Ingest Metadata Policy Decision",
+			query:          map[string]interface{}{},
+			policy:         KafkaIngestMetadata,
+			expectedResult: &ContentPolicyResult{Skip: false},
+		},
+		{
+			name:   "Evaluate a Skipping Kafka Ingest Force Policy Decision",
+			query:  map[string]interface{}{"editorialDesk": "/FT/Professional/Central Banking"},
+			policy: KafkaIngestForce,
+			expectedResult: &ContentPolicyResult{
+				Skip:    true,
+				Reasons: []string{"editorialDesk: /FT/Professional/Central Banking not allowed"},
+			},
+		},
+	}
+
+	a, err := NewLocalAgent([]string{"testdata"}, localPolicyPaths, testLogger())
+	require.NoError(t, err)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := a.EvaluateKafkaIngestPolicy(test.query, test.policy)
+			require.NoError(t, err)
+			assert.NotEmpty(t, result.DecisionID)
+			result.DecisionID = ""
+			assert.Equal(t, test.expectedResult, result)
+		})
+	}
+}
+
+func TestLocalAgent_Errors(t *testing.T) {
+	_, err := NewLocalAgent([]string{"missing"}, localPolicyPaths, testLogger())
+	assert.Error(t, err)
+
+	a, err := NewLocalAgent([]string{"testdata"}, map[string]string{
+		KafkaIngestContent.String(): "kafka/undefined",
+	}, testLogger())
+	require.NoError(t, err)
+
+	_, err = a.EvaluateKafkaIngestPolicy(map[string]interface{}{}, KafkaIngestContent)
+	assert.True(t, errors.Is(err, ErrEvaluatePolicy), "undefined decision")
+
+	_, err = a.EvaluateKafkaIngestPolicy(map[string]interface{}{}, KafkaIngestMetadata)
+	assert.True(t, errors.Is(err, ErrEvaluatePolicy), "policy without path")
+}
+
+func TestLocalAgent_Bundle(t *testing.T) {
+	bundle := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	writeBundle(t, bundle, map[string]string{
+		"/kafka.rego": "package kafka\n\ningest_content := {\"skip\": true, \"reasons\": [\"bundled\"]}\n",
+	})
+
+	a, err := NewLocalAgent([]string{bundle}, localPolicyPaths, testLogger())
+	require.NoError(t, err)
+
+	result, err := a.EvaluateKafkaIngestPolicy(map[string]interface{}{}, KafkaIngestContent)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bundled"}, result.Reasons)
+	assert.True(t, result.Skip)
+}
+
+func TestLocalAgent_Watch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "kafka.rego")
+	writePolicy := func(skip string) {
+		require.NoError(t, os.WriteFile(file, []byte("package kafka\n\ningest_content := {\"skip\": "+skip+"}\n"), 0600))
+	}
+	writePolicy("false")
+
+	a, err := NewLocalAgent([]string{dir}, map[string]string{
+		KafkaIngestContent.String(): "kafka/ingest_content",
+	}, testLogger())
+	require.NoError(t, err)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		assert.NoError(t, a.Watch(stop, 10*time.Millisecond))
+	}()
+
+	// an invalid policy is not loaded
+	require.NoError(t, os.WriteFile(file, []byte("package kafka\n\ningest_content := {"), 0600))
+	time.Sleep(50 * time.Millisecond)
+	result, err := a.EvaluateKafkaIngestPolicy(map[string]interface{}{}, KafkaIngestContent)
+	require.NoError(t, err)
+	assert.False(t, result.Skip)
+
+	writePolicy("true")
+	assert.Eventually(t, func() bool {
+		result, err := a.EvaluateKafkaIngestPolicy(map[string]interface{}{}, KafkaIngestContent)
+		return err == nil && result.Skip
+	}, time.Second, 10*time.Millisecond)
+}
+
+func writeBundle(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}))
+		_, err = tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+}
+
+func testLogger() *logger.UPPLogger {
+	return logger.NewUPPLogger("post-publication-combiner", "PANIC")
+}
@@ -0,0 +1,28 @@
+package kafka
+
+import future.keywords.contains
+import future.keywords.if
+
+default ingest_content := {"skip": false}
+
+ingest_content := {"skip": true, "reasons": reasons} if {
+	count(reasons) > 0
+}
+
+default ingest_metadata := {"skip": false}
+
+ingest_metadata := {"skip": true, "reasons": reasons} if {
+	count(reasons) > 0
+}
+
+reasons contains msg if {
+	desk := input.editorialDesk
+	desk == data.kafka.restricted_desks[_]
+	msg := sprintf("editorialDesk: %s not allowed", [desk])
+}
+
+default ingest_force := {"skip": false}
+
+ingest_force := {"skip": true, "reasons": reasons} if {
+	count(reasons) > 0
+}
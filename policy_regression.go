@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	cli "github.com/jawher/mow.cli"
+)
+
+const (
+	decisionForward = "forward"
+	decisionSkip    = "skip"
+	decisionError   = "error"
+)
+
+// policyRegressionCmd reports which recorded events the policies would skip, and the differences from a baseline version of the policies.
+// The policy paths and input mode are the ones of the service, with the paths defaulting to the ones of the deployment.
+func policyRegressionCmd(contentPolicyPath, metadataPolicyPath, inputMode *string) cli.CmdInitializer {
+	return func(cmd *cli.Cmd) {
+		events := cmd.String(cli.StringOpt{
+			Name: "events",
+			Desc: "Directory of the recorded content and annotations event bodies, in the format of processor/testData.",
+		})
+		policyFiles := cmd.Strings(cli.StringsOpt{
+			Name:  "policies",
+			Value: []string{},
+			Desc:  "Rego files, data files, directories holding them, or bundles (.tar.gz) of the policies under test.",
+		})
+		baselineFiles := cmd.Strings(cli.StringsOpt{
+			Name:  "baseline",
+			Value: []string{},
+			Desc:  "Rego files, data files, directories holding them, or bundles (.tar.gz) of the policies the results are compared to.",
+		})
+
+		cmd.Action = func() {
+			log := logger.NewUPPLogger(serviceName, "WARN")
+			if *events == "" || len(*policyFiles) == 0 {
+				log.Fatal("Both the events and the policies are required")
+			}
+
+			mode, err := processor.ParsePolicyInputMode(*inputMode)
+			if err != nil {
+				log.WithError(err).Fatal("Invalid policy input mode")
+			}
+
+			policyPaths := map[string]string{
+				policy.KafkaIngestContent.String():  valueOrDefault(*contentPolicyPath, "kafka/ingest_content"),
+				policy.KafkaIngestMetadata.String(): valueOrDefault(*metadataPolicyPath, "kafka/ingest_metadata"),
+			}
+			candidate, err := policy.NewLocalAgent(*policyFiles, policyPaths, log)
+			if err != nil {
+				log.WithError(err).Fatal("Could not load the policies")
+			}
+			var baseline policy.Agent
+			if len(*baselineFiles) > 0 {
+				if baseline, err = policy.NewLocalAgent(*baselineFiles, policyPaths, log); err != nil {
+					log.WithError(err).Fatal("Could not load the baseline policies")
+				}
+			}
+
+			recorded, err := processor.LoadRecordedEvents(*events)
+			if err != nil {
+				log.WithError(err).Fatal("Could not read the recorded events")
+			}
+			cases, failed := processor.BuildPolicyCases(recorded, mode)
+
+			results := runPolicyRegression(cases, candidate, baseline)
+			if changed := writeRegressionReport(os.Stdout, results, failed); changed > 0 {
+				cli.Exit(1)
+			}
+		}
+	}
+}
+
+func valueOrDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+type regressionOutcome struct {
+	Decision string
+	Reasons  []string
+}
+
+func (o regressionOutcome) String() string {
+	if len(o.Reasons) == 0 {
+		return o.Decision
+	}
+	return o.Decision + ": " + strings.Join(o.Reasons, "; ")
+}
+
+func (o regressionOutcome) equal(other regressionOutcome) bool {
+	if o.Decision != other.Decision || len(o.Reasons) != len(other.Reasons) {
+		return false
+	}
+	for i := range o.Reasons {
+		if o.Reasons[i] != other.Reasons[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type regressionResult struct {
+	Event     string
+	UUID      string
+	Policy    policy.Policy
+	Candidate regressionOutcome
+	// Baseline is nil if there are no baseline policies.
+	Baseline *regressionOutcome
+}
+
+func (r regressionResult) changed() bool {
+	return r.Baseline != nil && !r.Candidate.equal(*r.Baseline)
+}
+
+func runPolicyRegression(cases []processor.PolicyCase, candidate, baseline policy.Agent) []regressionResult {
+	results := make([]regressionResult, 0, len(cases))
+	for _, c := range cases {
+		r := regressionResult{
+			Event:     c.Event,
+			UUID:      c.UUID,
+			Policy:    c.Policy,
+			Candidate: evaluateRegressionCase(candidate, c),
+		}
+		if baseline != nil {
+			o := evaluateRegressionCase(baseline, c)
+			r.Baseline = &o
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func evaluateRegressionCase(agent policy.Agent, c processor.PolicyCase) regressionOutcome {
+	result, err := agent.EvaluateKafkaIngestPolicy(c.Input, c.Policy)
+	if err != nil {
+		return regressionOutcome{Decision: decisionError, Reasons: []string{err.Error()}}
+	}
+	if !result.Skip {
+		return regressionOutcome{Decision: decisionForward}
+	}
+
+	reasons := append([]string{}, result.Reasons...)
+	sort.Strings(reasons)
+	return regressionOutcome{Decision: decisionSkip, Reasons: reasons}
+}
+
+// writeRegressionReport writes a line per evaluated event, the events which couldn't be evaluated and a summary.
+// It returns the number of results which changed from the baseline.
+func writeRegressionReport(w io.Writer, results []regressionResult, failed map[string]error) int {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	withBaseline := len(results) > 0 && results[0].Baseline != nil
+	if withBaseline {
+		fmt.Fprintln(tw, "EVENT\tUUID\tPOLICY\tDECISION\tBASELINE\tCHANGED")
+	} else {
+		fmt.Fprintln(tw, "EVENT\tUUID\tPOLICY\tDECISION")
+	}
+
+	var skipped, changed int
+	for _, r := range results {
+		if r.Candidate.Decision == decisionSkip {
+			skipped++
+		}
+		if !withBaseline {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Event, r.UUID, r.Policy, r.Candidate)
+			continue
+		}
+
+		mark := ""
+		if r.changed() {
+			changed++
+			mark = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Event, r.UUID, r.Policy, r.Candidate, r.Baseline, mark)
+	}
+	tw.Flush()
+
+	if len(failed) > 0 {
+		names := make([]string, 0, len(failed))
+		for name := range failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(w, "\nNot evaluated:")
+		for _, name := range names {
+			fmt.Fprintf(w, "%s: %v\n", name, failed[name])
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d evaluated, %d skipped, %d not evaluated", len(results), skipped, len(failed))
+	if withBaseline {
+		fmt.Fprintf(w, ", %d changed from the baseline", changed)
+	}
+	fmt.Fprintln(w)
+
+	return changed
+}
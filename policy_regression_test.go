@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyRegression(t *testing.T) {
+	log := logger.NewUPPLogger("TEST", "PANIC")
+	policyPaths := map[string]string{
+		policy.KafkaIngestContent.String():  "kafka/ingest_content",
+		policy.KafkaIngestMetadata.String(): "kafka/ingest_metadata",
+	}
+
+	candidate, err := policy.NewLocalAgent([]string{"policy/testdata"}, policyPaths, log)
+	require.NoError(t, err)
+
+	// The baseline doesn't restrict any desk.
+	dir := t.TempDir()
+	rego, err := os.ReadFile("policy/testdata/kafka.rego")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "kafka.rego"), rego, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "data.json"), []byte(`{"kafka": {"restricted_desks": []}}`), 0600))
+	baseline, err := policy.NewLocalAgent([]string{dir}, policyPaths, log)
+	require.NoError(t, err)
+
+	events := []processor.RecordedEvent{
+		{Name: "content.json", Body: `{"payload": {"uuid": "uuid-1", "type": "Article"}}`},
+		{Name: "restricted.json", Body: `{"payload": {"uuid": "uuid-2", "type": "Article", "editorialDesk": "/FT/Professional/Central Banking"}}`},
+		{Name: "annotations.json", Body: `{"payload": {"uuid": "uuid-2", "annotations": []}}`},
+		{Name: "invalid.json", Body: `{`},
+	}
+	cases, failed := processor.BuildPolicyCases(events, processor.PolicyInputEvent)
+
+	results := runPolicyRegression(cases, candidate, baseline)
+	require.Len(t, results, 3)
+
+	// The test policy reads the desk at the top level of the input, which is the content for the metadata policy.
+	restricted := regressionOutcome{Decision: decisionSkip, Reasons: []string{"editorialDesk: /FT/Professional/Central Banking not allowed"}}
+	assert.Equal(t, regressionOutcome{Decision: decisionForward}, results[0].Candidate)
+	assert.False(t, results[0].changed())
+	assert.Equal(t, regressionOutcome{Decision: decisionForward}, results[1].Candidate)
+	assert.False(t, results[1].changed())
+	assert.Equal(t, policy.KafkaIngestMetadata, results[2].Policy)
+	assert.Equal(t, restricted, results[2].Candidate)
+	assert.Equal(t, &regressionOutcome{Decision: decisionForward}, results[2].Baseline)
+	assert.True(t, results[2].changed())
+
+	var out bytes.Buffer
+	changed := writeRegressionReport(&out, results, failed)
+
+	assert.Equal(t, 1, changed)
+	assert.Contains(t, out.String(), "skip: editorialDesk: /FT/Professional/Central Banking not allowed  forward   yes")
+	assert.Contains(t, out.String(), "invalid.json: ")
+	assert.Contains(t, out.String(), "3 evaluated, 1 skipped, 1 not evaluated, 1 changed from the baseline")
+}
+
+func TestPolicyRegression_Without_Baseline(t *testing.T) {
+	candidate, err := policy.NewLocalAgent(
+		[]string{"policy/testdata"},
+		map[string]string{
+			policy.KafkaIngestContent.String():  "kafka/ingest_content",
+			policy.KafkaIngestMetadata.String(): "kafka/ingest_metadata",
+		},
+		logger.NewUPPLogger("TEST", "PANIC"),
+	)
+	require.NoError(t, err)
+
+	recorded, err := processor.LoadRecordedEvents("processor/testData")
+	require.NoError(t, err)
+	cases, failed := processor.BuildPolicyCases(recorded, processor.PolicyInputEvent)
+
+	results := runPolicyRegression(cases, candidate, nil)
+
+	var out bytes.Buffer
+	assert.Equal(t, 0, writeRegressionReport(&out, results, failed))
+	assert.NotContains(t, out.String(), "BASELINE")
+	assert.Contains(t, out.String(), "content-with-centralBanking-editorialDesk.json")
+	assert.NotContains(t, out.String(), decisionError)
+	assert.Contains(t, out.String(), "7 evaluated, 0 skipped, 0 not evaluated\n")
+}
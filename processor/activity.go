@@ -0,0 +1,137 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNothingForwarded = errors.New("messages are received, but none was forwarded")
+
+// topicActivity counts the messages received from a topic, the ones skipped on purpose
+// and the combined messages forwarded for them.
+type topicActivity struct {
+	received      int64
+	skipped       int64
+	forwarded     int64
+	lastReceived  time.Time
+	lastForwarded time.Time
+}
+
+// activityTracker follows the messages going through the processor, one at a time. Its zero value is ready to use.
+type activityTracker struct {
+	mu     sync.Mutex
+	topics map[string]*topicActivity
+	// current is the time the message being processed was received, zero once it is forwarded or skipped.
+	current time.Time
+	// unforwardedSince is the time the first message neither forwarded nor skipped was received after the last forwarded one,
+	// and lastUnforwarded the time the latest one was received. They are zero if there is none.
+	unforwardedSince time.Time
+	lastUnforwarded  time.Time
+}
+
+func (t *activityTracker) topic(name string) *topicActivity {
+	if t.topics == nil {
+		t.topics = map[string]*topicActivity{}
+	}
+	a, ok := t.topics[name]
+	if !ok {
+		a = &topicActivity{}
+		t.topics[name] = a
+	}
+	return a
+}
+
+func (t *activityTracker) received(topic string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := t.topic(topic)
+	a.received++
+	a.lastReceived = now
+	t.current = now
+}
+
+// skipped marks the message being processed as skipped on purpose, e.g. by the policy, so it isn't an unforwarded one.
+func (t *activityTracker) skipped(topic string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.topic(topic).skipped++
+	t.current = time.Time{}
+}
+
+func (t *activityTracker) forwarded(topic string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	a := t.topic(topic)
+	a.forwarded++
+	a.lastForwarded = now
+	t.current = time.Time{}
+	t.unforwardedSince = time.Time{}
+	t.lastUnforwarded = time.Time{}
+}
+
+// done ends the processing of the message, which is an unforwarded one if it was neither forwarded nor skipped.
+func (t *activityTracker) done() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.current.IsZero() {
+		return
+	}
+	if t.unforwardedSince.IsZero() {
+		t.unforwardedSince = t.current
+	}
+	t.lastUnforwarded = t.current
+	t.current = time.Time{}
+}
+
+// check fails if messages have been received for longer than the timeout without any being forwarded,
+// and they still are: the last unforwarded one was received within the timeout.
+// A zero timeout only reports the activity.
+func (t *activityTracker) check(timeout time.Duration, now time.Time) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summary := t.summary(now)
+	if timeout > 0 && !t.unforwardedSince.IsZero() && now.Sub(t.lastUnforwarded) <= timeout {
+		if elapsed := now.Sub(t.unforwardedSince); elapsed > timeout {
+			return "", fmt.Errorf("%w for %s: %s", ErrNothingForwarded, elapsed.Round(time.Second), summary)
+		}
+	}
+	return summary, nil
+}
+
+func (t *activityTracker) summary(now time.Time) string {
+	if len(t.topics) == 0 {
+		return "No messages received yet"
+	}
+
+	names := make([]string, 0, len(t.topics))
+	for name := range t.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		a := t.topics[name]
+		lines = append(lines, fmt.Sprintf(
+			"%s: %d received (last %s), %d skipped, %d forwarded (last %s)",
+			name, a.received, since(a.lastReceived, now), a.skipped, a.forwarded, since(a.lastForwarded, now),
+		))
+	}
+	return strings.Join(lines, "; ")
+}
+
+func since(t time.Time, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return now.Sub(t).Round(time.Second).String() + " ago"
+}
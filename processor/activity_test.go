@@ -0,0 +1,103 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActivityTracker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var a activityTracker
+
+	summary, err := a.check(time.Minute, start)
+	require.NoError(t, err)
+	assert.Equal(t, "No messages received yet", summary)
+
+	a.received("PostPublicationEvents", start)
+	a.forwarded("PostPublicationEvents", start.Add(time.Second))
+	a.done()
+	a.received("PostConceptAnnotations", start.Add(2*time.Second))
+	a.done()
+
+	summary, err = a.check(time.Minute, start.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "PostConceptAnnotations: 1 received (last 58s ago), 0 skipped, 0 forwarded (last never); "+
+		"PostPublicationEvents: 1 received (last 1m0s ago), 0 skipped, 1 forwarded (last 59s ago)", summary)
+
+	a.received("PostConceptAnnotations", start.Add(90*time.Second))
+	a.done()
+	_, err = a.check(time.Minute, start.Add(2*time.Minute))
+	assert.ErrorIs(t, err, ErrNothingForwarded)
+	assert.ErrorContains(t, err, "for 1m58s: PostConceptAnnotations: 2 received")
+
+	_, err = a.check(0, start.Add(2*time.Minute))
+	assert.NoError(t, err, "a zero timeout only reports the activity")
+
+	_, err = a.check(time.Minute, start.Add(3*time.Minute))
+	assert.NoError(t, err, "nothing was received within the timeout")
+
+	a.received("PostConceptAnnotations", start.Add(3*time.Minute))
+	a.skipped("PostConceptAnnotations")
+	a.done()
+	_, err = a.check(time.Minute, start.Add(3*time.Minute))
+	assert.NoError(t, err, "the skipped messages aren't unforwarded ones")
+
+	a.received("PostConceptAnnotations", start.Add(4*time.Minute))
+	a.forwarded("PostConceptAnnotations", start.Add(4*time.Minute))
+	a.done()
+	summary, err = a.check(time.Minute, start.Add(4*time.Minute))
+	assert.NoError(t, err, "a message was forwarded")
+	assert.Contains(t, summary, "PostConceptAnnotations: 4 received (last 0s ago), 1 skipped, 1 forwarded (last 0s ago)")
+}
+
+func TestMsgProcessor_ForwardingCheck(t *testing.T) {
+	m, err := createMessage(map[string]string{"X-Request-Id": "some-tid1"}, "./testData/content.json")
+	require.NoError(t, err)
+	m.Topic = "PostPublicationEvents"
+
+	cm := &ContentMessage{}
+	require.NoError(t, json.Unmarshal([]byte(m.Body), cm))
+
+	log, _ := testLogger()
+	newProcessor := func(contentTypes []string) *MsgProcessor {
+		return &MsgProcessor{
+			config: NewMsgProcessorConfig(nil, 0, time.Nanosecond),
+			dataCombiner: DummyDataCombiner{
+				t:               t,
+				expectedContent: cm.ContentModel,
+				data:            CombinedModel{UUID: "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", Content: cm.ContentModel},
+			},
+			forwarder: newForwarder(&recordingProducer{}, ForwarderConfig{SupportedContentTypes: contentTypes}),
+			log:       log,
+			opaAgent:  mockOpaAgent{returnResult: &policy.ContentPolicyResult{}},
+		}
+	}
+
+	p := newProcessor([]string{"Article"})
+	p.processMessage(m)
+	summary, err := p.ForwardingCheck()
+	require.NoError(t, err)
+	assert.Contains(t, summary, "PostPublicationEvents: 1 received (last 0s ago), 0 skipped, 1 forwarded (last 0s ago)")
+
+	p = newProcessor([]string{"Video"})
+	p.processMessage(m)
+	time.Sleep(time.Millisecond)
+	summary, err = p.ForwardingCheck()
+	require.NoError(t, err, "the content type isn't whitelisted, so the message is skipped on purpose")
+	assert.Contains(t, summary, "PostPublicationEvents: 1 received (last 0s ago), 1 skipped, 0 forwarded (last never)")
+
+	p = newProcessor([]string{"Article"})
+	p.config.ForwardingTimeout = 50 * time.Millisecond
+	p.dataCombiner = DummyDataCombiner{t: t, expectedContent: cm.ContentModel, err: errors.New("document-store-api is unavailable")}
+	p.processMessage(m)
+	time.Sleep(60 * time.Millisecond)
+	p.processMessage(m)
+	_, err = p.ForwardingCheck()
+	assert.ErrorIs(t, err, ErrNothingForwarded, "the message couldn't be combined, so nothing is forwarded")
+}
@@ -0,0 +1,26 @@
+package processor
+
+import (
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+)
+
+type auditRecorder interface {
+	Record(e audit.Entry)
+}
+
+// recordSkip adds the decision of a policy to skip a message to the audit log, if there is one.
+func recordSkip(r auditRecorder, p policy.Policy, decision *policy.ContentPolicyResult, uuid, tid string) {
+	if r == nil || decision == nil || !decision.Skip {
+		return
+	}
+
+	r.Record(audit.Entry{
+		Type:          audit.PolicySkip,
+		UUID:          uuid,
+		TransactionID: tid,
+		Policy:        p.String(),
+		Reasons:       decision.Reasons,
+		DecisionID:    decision.DecisionID,
+	})
+}
@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDecisionID = "1e58b3bf-995c-473e-90e9-ab1f10af74ab"
+
+func TestProcessContentMsg_Audits_Skip_Decisions(t *testing.T) {
+	m, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+
+	log, _ := testLogger()
+	auditLog := audit.NewLog(10)
+	p := &MsgProcessor{
+		log: log,
+		opaAgent: mockOpaAgent{
+			returnResult: &policy.ContentPolicyResult{Skip: true, Reasons: []string{"reason"}, DecisionID: testDecisionID},
+		},
+		audit: auditLog,
+	}
+
+	p.processContentMsg(m)
+
+	entries := auditLog.Entries(audit.Filter{})
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.PolicySkip, entries[0].Type)
+	assert.Equal(t, "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", entries[0].UUID)
+	assert.Equal(t, "some-tid1", entries[0].TransactionID)
+	assert.Equal(t, "kafka_ingest_content", entries[0].Policy)
+	assert.Equal(t, []string{"reason"}, entries[0].Reasons)
+	assert.Equal(t, testDecisionID, entries[0].DecisionID)
+}
+
+func TestProcessContentMsg_Forwards_DecisionID(t *testing.T) {
+	m, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+
+	cm := &ContentMessage{}
+	require.NoError(t, json.Unmarshal([]byte(m.Body), cm))
+
+	log, _ := testLogger()
+	auditLog := audit.NewLog(10)
+	producer := &recordingProducer{}
+	p := &MsgProcessor{
+		dataCombiner: DummyDataCombiner{
+			t:               t,
+			expectedContent: cm.ContentModel,
+			data:            CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+		},
+		forwarder: newForwarder(producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}),
+		log:       log,
+		opaAgent: mockOpaAgent{
+			returnResult: &policy.ContentPolicyResult{DecisionID: testDecisionID},
+		},
+		audit: auditLog,
+	}
+
+	p.processContentMsg(m)
+
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, testDecisionID, producer.messages[0].Headers[DecisionIDHeader])
+	assert.Empty(t, auditLog.Entries(audit.Filter{}))
+}
+
+func TestForcePublication_Audits_Skip_Decisions(t *testing.T) {
+	log, _ := testLogger()
+	auditLog := audit.NewLog(10)
+	p := NewRequestProcessor(
+		DummyDataCombiner{
+			t:            t,
+			expectedUUID: "some_uuid",
+			data:         CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+		},
+		&recordingProducer{},
+		ForwarderConfig{SupportedContentTypes: []string{"Article"}},
+		log,
+		mockOpaAgent{
+			returnResult: &policy.ContentPolicyResult{Skip: true, Reasons: []string{"reason"}, DecisionID: testDecisionID},
+		},
+		WithRequestAudit(auditLog),
+	)
+
+	err := p.ForcePublication("some_uuid", "some-tid")
+
+	var skipErr *PolicySkipError
+	require.ErrorAs(t, err, &skipErr)
+	assert.Equal(t, testDecisionID, skipErr.DecisionID)
+
+	entries := auditLog.Entries(audit.Filter{Policy: "kafka_ingest_force"})
+	require.Len(t, entries, 1)
+	assert.Equal(t, "some_uuid", entries[0].UUID)
+	assert.Equal(t, "some-tid", entries[0].TransactionID)
+}
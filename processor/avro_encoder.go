@@ -0,0 +1,292 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/schemaregistry"
+	"github.com/linkedin/goavro/v2"
+)
+
+const AvroContentType = "avro/binary"
+
+// AvroEncoder serialises the combined message envelope with the latest schema registered for a subject,
+// using the schema registry wire format.
+// The content and the internal content have no fixed structure, so they are carried as JSON encoded strings.
+type AvroEncoder struct {
+	schemaID int
+	codec    *goavro.Codec
+}
+
+func NewAvroEncoder(registry schemaregistry.Registry, subject string) (*AvroEncoder, error) {
+	schema, err := registry.LatestSchema(subject)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema for subject %q: %w", subject, err)
+	}
+
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema %d: %w", schema.ID, err)
+	}
+
+	e := &AvroEncoder{
+		schemaID: schema.ID,
+		codec:    codec,
+	}
+
+	// Fail early if the registered schema is not compatible with the envelope produced by the service.
+	if _, err = e.Encode(&CombinedModelV2{SchemaVersion: SchemaV2}); err != nil {
+		return nil, fmt.Errorf("schema %d is not compatible with the combined message: %w", schema.ID, err)
+	}
+
+	return e, nil
+}
+
+func (e *AvroEncoder) Encode(envelope *CombinedModelV2) ([]byte, error) {
+	native, err := envelopeToAvro(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := e.codec.BinaryFromNative(nil, native)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding combined message: %w", err)
+	}
+
+	return schemaregistry.EncodeWireFormat(e.schemaID, b), nil
+}
+
+func (e *AvroEncoder) ContentType() string {
+	return AvroContentType
+}
+
+// DecodeAvro reads a combined message envelope encoded by an AvroEncoder,
+// using the writer schema referenced in the message.
+func DecodeAvro(registry schemaregistry.Registry, b []byte) (*CombinedModelV2, error) {
+	id, payload, err := schemaregistry.DecodeWireFormat(b)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := registry.SchemaByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema %d: %w", id, err)
+	}
+
+	codec, err := goavro.NewCodec(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema %d: %w", id, err)
+	}
+
+	native, _, err := codec.NativeFromBinary(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding combined message: %w", err)
+	}
+
+	// The native form mirrors the JSON representation of the envelope,
+	// apart from the unions and the JSON encoded content fields.
+	record, ok := native.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected combined message type: %T", native)
+	}
+	return envelopeFromAvro(record)
+}
+
+func envelopeToAvro(envelope *CombinedModelV2) (map[string]interface{}, error) {
+	content, err := contentToAvro(envelope.Content)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding content: %w", err)
+	}
+	internalContent, err := contentToAvro(envelope.InternalContent)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding internal content: %w", err)
+	}
+
+	sourceEvents := make([]interface{}, 0, len(envelope.SourceEvents))
+	for _, s := range envelope.SourceEvents {
+		sourceEvents = append(sourceEvents, map[string]interface{}{
+			"topic":          s.Topic,
+			"transactionId":  s.TransactionID,
+			"originSystemId": s.OriginSystemID,
+			"messageType":    s.MessageType,
+			"timestamp":      s.Timestamp,
+		})
+	}
+
+	var metadata interface{}
+	if envelope.Metadata != nil {
+		annotations := make([]interface{}, 0, len(envelope.Metadata))
+		for _, a := range envelope.Metadata {
+			annotations = append(annotations, thingToAvro(a.Thing))
+		}
+		metadata = goavro.Union("array", annotations)
+	}
+
+	return map[string]interface{}{
+		"schemaVersion":   int32(envelope.SchemaVersion),
+		"trigger":         string(envelope.Trigger),
+		"eventTimestamp":  envelope.EventTimestamp,
+		"sourceEvents":    sourceEvents,
+		"uuid":            envelope.UUID,
+		"contentUri":      envelope.ContentURI,
+		"lastModified":    envelope.LastModified,
+		"deleted":         envelope.Deleted,
+		"content":         content,
+		"internalContent": internalContent,
+		"metadata":        metadata,
+	}, nil
+}
+
+func contentToAvro(c ContentModel) (interface{}, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return goavro.Union("string", string(b)), nil
+}
+
+func thingToAvro(t Thing) map[string]interface{} {
+	types := make([]interface{}, 0, len(t.Types))
+	for _, typ := range t.Types {
+		types = append(types, typ)
+	}
+
+	naics := make([]interface{}, 0, len(t.NAICS))
+	for _, n := range t.NAICS {
+		naics = append(naics, map[string]interface{}{
+			"identifier": n.Identifier,
+			"prefLabel":  n.PrefLabel,
+			"rank":       int32(n.Rank),
+		})
+	}
+
+	return map[string]interface{}{
+		"id":           t.ID,
+		"prefLabel":    t.PrefLabel,
+		"types":        types,
+		"predicate":    t.Predicate,
+		"apiUrl":       t.APIURL,
+		"directType":   t.DirectType,
+		"type":         t.Type,
+		"leiCode":      t.LeiCode,
+		"FIGI":         t.FIGI,
+		"NAICS":        naics,
+		"isDeprecated": t.IsDeprecated,
+	}
+}
+
+func envelopeFromAvro(record map[string]interface{}) (*CombinedModelV2, error) {
+	content, err := contentFromAvro(record["content"])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding content: %w", err)
+	}
+	internalContent, err := contentFromAvro(record["internalContent"])
+	if err != nil {
+		return nil, fmt.Errorf("error decoding internal content: %w", err)
+	}
+
+	sourceEvents := []SourceEvent{}
+	for _, s := range asSlice(record["sourceEvents"]) {
+		m := asMap(s)
+		sourceEvents = append(sourceEvents, SourceEvent{
+			Topic:          asString(m["topic"]),
+			TransactionID:  asString(m["transactionId"]),
+			OriginSystemID: asString(m["originSystemId"]),
+			MessageType:    asString(m["messageType"]),
+			Timestamp:      asString(m["timestamp"]),
+		})
+	}
+
+	var metadata []Annotation
+	if union := asMap(record["metadata"]); union != nil {
+		metadata = []Annotation{}
+		for _, a := range asSlice(union["array"]) {
+			metadata = append(metadata, Annotation{Thing: thingFromAvro(asMap(a))})
+		}
+	}
+
+	version, _ := record["schemaVersion"].(int32)
+	deleted, _ := record["deleted"].(bool)
+
+	return &CombinedModelV2{
+		SchemaVersion:  SchemaVersion(version),
+		Trigger:        TriggerType(asString(record["trigger"])),
+		EventTimestamp: asString(record["eventTimestamp"]),
+		SourceEvents:   sourceEvents,
+		CombinedModel: CombinedModel{
+			UUID:            asString(record["uuid"]),
+			Content:         content,
+			InternalContent: internalContent,
+			Metadata:        metadata,
+			ContentURI:      asString(record["contentUri"]),
+			LastModified:    asString(record["lastModified"]),
+			Deleted:         deleted,
+		},
+	}, nil
+}
+
+func contentFromAvro(v interface{}) (ContentModel, error) {
+	union := asMap(v)
+	if union == nil {
+		return nil, nil
+	}
+
+	var c ContentModel
+	if err := json.Unmarshal([]byte(asString(union["string"])), &c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func thingFromAvro(m map[string]interface{}) Thing {
+	var types []string
+	for _, t := range asSlice(m["types"]) {
+		types = append(types, asString(t))
+	}
+
+	var naics []IndustryClassification
+	for _, n := range asSlice(m["NAICS"]) {
+		ic := asMap(n)
+		rank, _ := ic["rank"].(int32)
+		naics = append(naics, IndustryClassification{
+			Identifier: asString(ic["identifier"]),
+			PrefLabel:  asString(ic["prefLabel"]),
+			Rank:       int(rank),
+		})
+	}
+
+	deprecated, _ := m["isDeprecated"].(bool)
+
+	return Thing{
+		ID:           asString(m["id"]),
+		PrefLabel:    asString(m["prefLabel"]),
+		Types:        types,
+		Predicate:    asString(m["predicate"]),
+		APIURL:       asString(m["apiUrl"]),
+		DirectType:   asString(m["directType"]),
+		Type:         asString(m["type"]),
+		LeiCode:      asString(m["leiCode"]),
+		FIGI:         asString(m["FIGI"]),
+		NAICS:        naics,
+		IsDeprecated: deprecated,
+	}
+}
+
+func asMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func asSlice(v interface{}) []interface{} {
+	s, _ := v.([]interface{})
+	return s
+}
+
+func asString(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
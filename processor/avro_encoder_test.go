@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/schemaregistry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchemaRegistryIndex = "../schemaregistry/schemas/registry.json"
+
+func TestAvroEncoder_RoundTrip(t *testing.T) {
+	registry, err := schemaregistry.NewFileRegistry(testSchemaRegistryIndex)
+	require.NoError(t, err)
+
+	encoder, err := NewAvroEncoder(registry, schemaregistry.TopicSubject("CombinedPostPublicationEvents"))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		envelope CombinedModelV2
+	}{
+		{
+			name: "Full message",
+			envelope: CombinedModelV2{
+				SchemaVersion:  SchemaV2,
+				Trigger:        MetadataTrigger,
+				EventTimestamp: "2017-03-30T13:09:06.480Z",
+				SourceEvents: []SourceEvent{
+					{
+						Topic:          "PostConceptAnnotations",
+						TransactionID:  "some-tid1",
+						OriginSystemID: "http://cmdb.ft.com/systems/pac",
+						MessageType:    "concept-annotation",
+					},
+				},
+				CombinedModel: CombinedModel{
+					UUID:            "some_uuid",
+					Content:         ContentModel{"uuid": "some_uuid", "type": "Article", "standout": map[string]interface{}{"scoop": true}},
+					InternalContent: ContentModel{"uuid": "some_uuid", "type": "Article"},
+					Metadata: []Annotation{
+						{
+							Thing: Thing{
+								ID:        "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995",
+								PrefLabel: "Barclays",
+								Types:     []string{"http://base-url/core/Thing", "http://base-url/company/PublicCompany"},
+								Predicate: "http://base-url/about",
+								NAICS: []IndustryClassification{
+									{Identifier: "522110", PrefLabel: "Commercial Banking", Rank: 1},
+								},
+							},
+						},
+					},
+					ContentURI:   "http://methode-article-mapper.svc.ft.com/content/some_uuid",
+					LastModified: "2017-03-30T13:09:06.48Z",
+				},
+			},
+		},
+		{
+			name: "Deleted message",
+			envelope: CombinedModelV2{
+				SchemaVersion: SchemaV2,
+				Trigger:       ContentTrigger,
+				SourceEvents:  []SourceEvent{},
+				CombinedModel: CombinedModel{
+					UUID:    "some_uuid",
+					Deleted: true,
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b, err := encoder.Encode(&test.envelope)
+			require.NoError(t, err)
+
+			id, _, err := schemaregistry.DecodeWireFormat(b)
+			require.NoError(t, err)
+			assert.Equal(t, 1, id)
+
+			decoded, err := DecodeAvro(registry, b)
+			require.NoError(t, err)
+			assert.Equal(t, test.envelope, *decoded)
+		})
+	}
+}
+
+func TestNewAvroEncoder_Unknown_Subject(t *testing.T) {
+	registry, err := schemaregistry.NewFileRegistry(testSchemaRegistryIndex)
+	require.NoError(t, err)
+
+	_, err = NewAvroEncoder(registry, "unknown-value")
+	assert.ErrorIs(t, err, schemaregistry.ErrSchemaNotFound)
+}
+
+func TestForwardMsg_Avro(t *testing.T) {
+	registry, err := schemaregistry.NewFileRegistry(testSchemaRegistryIndex)
+	require.NoError(t, err)
+
+	encoder, err := NewAvroEncoder(registry, schemaregistry.TopicSubject("ForcedCombinedPostPublicationEvents"))
+	require.NoError(t, err)
+
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{SchemaVersion: SchemaV2, Encoder: encoder})
+
+	model := CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}}
+	err = f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ForcedTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	m := producer.messages[0]
+	assert.Equal(t, AvroContentType, m.Headers["Content-Type"])
+	assert.Equal(t, "2", m.Headers[SchemaVersionHeader])
+
+	decoded, err := DecodeAvro(registry, []byte(m.Body))
+	require.NoError(t, err)
+	assert.Equal(t, ForcedTrigger, decoded.Trigger)
+	assert.Equal(t, model, decoded.CombinedModel)
+}
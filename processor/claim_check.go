@@ -0,0 +1,96 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/blobstore"
+)
+
+const (
+	ClaimCheckHeader = "Claim-Check"
+	ClaimCheckPath   = "/claim-check/"
+)
+
+// ClaimCheckConfig enables storing combined messages larger than Threshold bytes in Store,
+// and forwarding a ClaimCheckMessage referencing them instead.
+type ClaimCheckConfig struct {
+	Store     blobstore.Store
+	Threshold int
+	// BaseURL is the address at which the service serves the stored messages to consumers.
+	// If set, the claim check carries the full URL of the stored message.
+	BaseURL string
+}
+
+// ClaimCheckMessage is forwarded, always JSON encoded, in place of a combined message which is too large.
+type ClaimCheckMessage struct {
+	UUID         string     `json:"uuid"`
+	ContentURI   string     `json:"contentUri"`
+	LastModified string     `json:"lastModified"`
+	Deleted      bool       `json:"deleted"`
+	ClaimCheck   ClaimCheck `json:"claimCheck"`
+}
+
+type ClaimCheck struct {
+	Ref         string `json:"ref"`
+	URL         string `json:"url,omitempty"`
+	Digest      string `json:"digest"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+// contentTypeExtensions is used to carry the content type of the stored messages in their references.
+var contentTypeExtensions = map[string]string{
+	ContentType:     ".json",
+	AvroContentType: ".avro",
+}
+
+// ClaimCheckContentType returns the content type of the message stored under the given reference.
+func ClaimCheckContentType(ref string) string {
+	for contentType, ext := range contentTypeExtensions {
+		if strings.HasSuffix(ref, ext) {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+func (c *ClaimCheckConfig) exceeds(b []byte) bool {
+	return c != nil && c.Store != nil && c.Threshold > 0 && len(b) > c.Threshold
+}
+
+// check stores the encoded message and returns the claim check message to be forwarded instead.
+// The reference is derived from the digest of the stored message, so storing the same message twice is idempotent.
+func (c *ClaimCheckConfig) check(message *CombinedModel, b []byte, contentType string) ([]byte, error) {
+	sum := sha256.Sum256(b)
+	digest := hex.EncodeToString(sum[:])
+	ref := digest + contentTypeExtensions[contentType]
+	if message.UUID != "" {
+		ref = message.UUID + "-" + ref
+	}
+
+	if err := c.Store.Put(ref, b); err != nil {
+		return nil, fmt.Errorf("error storing claim checked message: %w", err)
+	}
+
+	cc := ClaimCheck{
+		Ref:         ref,
+		Digest:      "sha256:" + digest,
+		Size:        len(b),
+		ContentType: contentType,
+	}
+	if c.BaseURL != "" {
+		cc.URL = strings.TrimSuffix(c.BaseURL, "/") + ClaimCheckPath + ref
+	}
+
+	return json.Marshal(ClaimCheckMessage{
+		UUID:         message.UUID,
+		ContentURI:   message.ContentURI,
+		LastModified: message.LastModified,
+		Deleted:      message.Deleted,
+		ClaimCheck:   cc,
+	})
+}
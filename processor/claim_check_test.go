@@ -0,0 +1,99 @@
+package processor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/blobstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardMsg_ClaimCheck(t *testing.T) {
+	store, err := blobstore.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{
+		ClaimCheck: &ClaimCheckConfig{
+			Store:     store,
+			Threshold: 100,
+			BaseURL:   "http://post-publication-combiner:8080/",
+		},
+	})
+
+	model := CombinedModel{
+		UUID:         "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+		ContentURI:   "http://methode-article-mapper.svc.ft.com/content/0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+		LastModified: "2017-03-30T13:09:06.48Z",
+		Content: ContentModel{
+			"uuid":    "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+			"type":    "Article",
+			"bodyXML": strings.Repeat("<p>large body</p>", 20),
+		},
+	}
+	full, err := json.Marshal(model)
+	require.NoError(t, err)
+
+	err = f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ContentTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	m := producer.messages[0]
+	assert.Equal(t, "true", m.Headers[ClaimCheckHeader])
+	assert.Equal(t, ContentType, m.Headers["Content-Type"])
+
+	var slim ClaimCheckMessage
+	require.NoError(t, json.Unmarshal([]byte(m.Body), &slim))
+
+	sum := sha256.Sum256(full)
+	digest := hex.EncodeToString(sum[:])
+	assert.Equal(t, ClaimCheckMessage{
+		UUID:         model.UUID,
+		ContentURI:   model.ContentURI,
+		LastModified: model.LastModified,
+		ClaimCheck: ClaimCheck{
+			Ref:         model.UUID + "-" + digest + ".json",
+			URL:         "http://post-publication-combiner:8080/claim-check/" + model.UUID + "-" + digest + ".json",
+			Digest:      "sha256:" + digest,
+			Size:        len(full),
+			ContentType: ContentType,
+		},
+	}, slim)
+
+	stored, err := store.Get(slim.ClaimCheck.Ref)
+	require.NoError(t, err)
+	assert.Equal(t, full, stored)
+	assert.Equal(t, ContentType, ClaimCheckContentType(slim.ClaimCheck.Ref))
+}
+
+func TestForwardMsg_Below_ClaimCheck_Threshold(t *testing.T) {
+	store, err := blobstore.NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{
+		ClaimCheck: &ClaimCheckConfig{Store: store, Threshold: 1000},
+	})
+
+	model := CombinedModel{UUID: "some_uuid"}
+	err = f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ContentTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	assert.Empty(t, producer.messages[0].Headers[ClaimCheckHeader])
+	assert.JSONEq(
+		t,
+		`{"uuid":"some_uuid","contentUri":"","lastModified":"","deleted":false,"content":null,"internalContent":null,"metadata":null}`,
+		producer.messages[0].Body,
+	)
+}
+
+func TestClaimCheckContentType(t *testing.T) {
+	assert.Equal(t, ContentType, ClaimCheckContentType("some_uuid-abc.json"))
+	assert.Equal(t, AvroContentType, ClaimCheckContentType("some_uuid-abc.avro"))
+	assert.Equal(t, "application/octet-stream", ClaimCheckContentType("some_uuid-abc"))
+}
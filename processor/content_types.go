@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// UnknownContentTypes is what happens to the content without a type: a missing, null, empty or non-string one.
+type UnknownContentTypes string
+
+const (
+	// UnknownContentTypesWhitelisted forwards the content without a type only if an empty content type is whitelisted.
+	UnknownContentTypesWhitelisted UnknownContentTypes = ""
+	UnknownContentTypesAllowed     UnknownContentTypes = "allow"
+	UnknownContentTypesRejected    UnknownContentTypes = "reject"
+)
+
+var ErrInvalidUnknownContentTypes = errors.New("invalid unknown content types setting")
+
+func ParseUnknownContentTypes(s string) (UnknownContentTypes, error) {
+	switch u := UnknownContentTypes(strings.TrimSpace(s)); u {
+	case UnknownContentTypesWhitelisted, UnknownContentTypesAllowed, UnknownContentTypesRejected:
+		return u, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidUnknownContentTypes, s)
+}
+
+// ContentURIType infers the type of the content with a content URI matching the glob pattern.
+type ContentURIType struct {
+	Pattern string `json:"pattern"`
+	Type    string `json:"type"`
+}
+
+// ContentTypeConfig sets how the content without a type is handled.
+type ContentTypeConfig struct {
+	Unknown UnknownContentTypes `json:"unknown,omitempty"`
+	// InferFromInternalContent uses the type of the internal content for the content without one.
+	InferFromInternalContent bool `json:"inferFromInternalContent,omitempty"`
+	// URITypes infer the type from the content URI, if it is still unknown. The first matching pattern is used.
+	URITypes []ContentURIType `json:"uriTypes,omitempty"`
+}
+
+// ContentTypeFilter decides which content is forwarded by its type.
+// The whitelisted content types can be glob patterns, where * matches any characters and ? a single one.
+type ContentTypeFilter struct {
+	allowed      []*regexp.Regexp
+	emptyAllowed bool
+	config       ContentTypeConfig
+	uriPatterns  []*regexp.Regexp
+}
+
+func NewContentTypeFilter(allowed []string, config ContentTypeConfig) *ContentTypeFilter {
+	f := &ContentTypeFilter{config: config}
+	for _, t := range allowed {
+		if t = strings.TrimSpace(t); t == "" {
+			f.emptyAllowed = true
+			continue
+		}
+		f.allowed = append(f.allowed, compileGlob(t))
+	}
+	for _, u := range config.URITypes {
+		f.uriPatterns = append(f.uriPatterns, compileGlob(u.Pattern))
+	}
+	return f
+}
+
+// TypeOf returns the type of the content of the message, inferred if the content has none.
+// It is empty if the type is unknown.
+func (f *ContentTypeFilter) TypeOf(m *CombinedModel) string {
+	if t := m.Content.getType(); t != "" || f == nil {
+		return t
+	}
+	if f.config.InferFromInternalContent {
+		if t := m.InternalContent.getType(); t != "" {
+			return t
+		}
+	}
+	for i, re := range f.uriPatterns {
+		if m.ContentURI != "" && re.MatchString(m.ContentURI) {
+			return f.config.URITypes[i].Type
+		}
+	}
+	return ""
+}
+
+// Allows reports whether the content of the type is forwarded. An empty type is an unknown one.
+// A nil filter allows no content.
+func (f *ContentTypeFilter) Allows(contentType string) bool {
+	if f == nil {
+		return false
+	}
+	if contentType == "" {
+		switch f.config.Unknown {
+		case UnknownContentTypesAllowed:
+			return true
+		case UnknownContentTypesRejected:
+			return false
+		}
+		return f.emptyAllowed
+	}
+	return matchesAny(f.allowed, contentType)
+}
+
+func compileGlob(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(quoted)
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		res = append(res, compileGlob(p))
+	}
+	return res
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
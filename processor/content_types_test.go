@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentTypeFilter_Allows(t *testing.T) {
+	tests := map[string]struct {
+		allowed     []string
+		unknown     UnknownContentTypes
+		contentType string
+		expected    bool
+	}{
+		"exact":                       {allowed: []string{"Article"}, contentType: "Article", expected: true},
+		"exact is case sensitive":     {allowed: []string{"Article"}, contentType: "article"},
+		"glob":                        {allowed: []string{"LiveBlog*"}, contentType: "LiveBlogPackage", expected: true},
+		"glob matches the whole type": {allowed: []string{"Live*"}, contentType: "ContentLiveEvent"},
+		"single character":            {allowed: []string{"Clip?et"}, contentType: "ClipSet", expected: true},
+		"unknown whitelisted":         {allowed: []string{"Article", ""}, contentType: "", expected: true},
+		"unknown not whitelisted":     {allowed: []string{"Article"}, contentType: ""},
+		"unknown allowed":             {allowed: []string{"Article"}, unknown: UnknownContentTypesAllowed, contentType: "", expected: true},
+		"unknown rejected":            {allowed: []string{"Article", ""}, unknown: UnknownContentTypesRejected, contentType: ""},
+		"glob does not match unknown": {allowed: []string{"*"}, contentType: ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			f := NewContentTypeFilter(test.allowed, ContentTypeConfig{Unknown: test.unknown})
+			assert.Equal(t, test.expected, f.Allows(test.contentType))
+		})
+	}
+}
+
+func TestContentTypeFilter_TypeOf(t *testing.T) {
+	m, err := createMessage(map[string]string{}, "./testData/content-null-type.json")
+	require.NoError(t, err)
+	var cm ContentMessage
+	require.NoError(t, json.Unmarshal([]byte(m.Body), &cm))
+
+	f := NewContentTypeFilter([]string{"Video"}, ContentTypeConfig{
+		InferFromInternalContent: true,
+		URITypes: []ContentURIType{
+			{Pattern: "http://next-video-mapper.svc.ft.com/*", Type: "Video"},
+			{Pattern: "*", Type: "Content"},
+		},
+	})
+
+	tests := map[string]struct {
+		message  CombinedModel
+		expected string
+	}{
+		"content type": {
+			message:  CombinedModel{Content: ContentModel{"type": "Article"}, InternalContent: ContentModel{"type": "Video"}},
+			expected: "Article",
+		},
+		"internal content type": {
+			message:  CombinedModel{Content: cm.ContentModel, InternalContent: ContentModel{"type": "Article"}},
+			expected: "Article",
+		},
+		"content uri": {
+			message:  CombinedModel{Content: cm.ContentModel, ContentURI: cm.ContentURI},
+			expected: "Video",
+		},
+		"non-string type": {
+			message:  CombinedModel{Content: ContentModel{"type": 1}, ContentURI: "http://methode-article-mapper.svc.ft.com/content/uuid"},
+			expected: "Content",
+		},
+		"unknown": {
+			message: CombinedModel{Content: ContentModel{"type": nil}},
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, test.expected, f.TypeOf(&test.message))
+		})
+	}
+
+	assert.Equal(t, "", NewContentTypeFilter([]string{"Video"}, ContentTypeConfig{}).TypeOf(&CombinedModel{
+		Content:         cm.ContentModel,
+		InternalContent: ContentModel{"type": "Video"},
+		ContentURI:      cm.ContentURI,
+	}), "the type is only inferred if configured")
+}
+
+func TestForwarder_InferredContentType(t *testing.T) {
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{
+		SupportedContentTypes: []string{"Video"},
+		ContentTypes:          ContentTypeConfig{URITypes: []ContentURIType{{Pattern: "*/video/model/*", Type: "Video"}}},
+	})
+
+	video := &CombinedModel{
+		UUID:       "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+		ContentURI: "http://next-video-mapper.svc.ft.com/video/model/0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+		Content:    ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "type": nil},
+	}
+	require.NoError(t, f.filterAndForwardMsg(f.current(), map[string]string{}, video, ContentTrigger, nil))
+	require.Len(t, producer.messages, 1)
+	assert.Contains(t, producer.messages[0].Body, `"type":null`, "the inferred type is not added to the content")
+
+	article := &CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid"}}
+	assert.ErrorIs(t, f.filterAndForwardMsg(f.current(), map[string]string{}, article, ContentTrigger, nil), ErrInvalidContentType)
+}
@@ -10,12 +10,24 @@ type dataCombiner interface {
 	GetCombinedModelForContent(content ContentModel) (CombinedModel, error)
 	GetCombinedModelForAnnotations(metadata AnnotationsMessage) (CombinedModel, error)
 	GetCombinedModel(uuid string) (CombinedModel, error)
+	FindSources(uuid string) ([]string, error)
 }
 
+// Sources of the combined messages
+const (
+	DocumentStoreSource     = "document-store"
+	ContentCollectionSource = "content-collection"
+	InternalContentSource   = "internal-content"
+)
+
 type DataCombiner struct {
 	contentRetriever           contentRetriever
 	contentCollectionRetriever contentRetriever
 	internalContentRetriever   internalContentRetriever
+
+	// settings replace the retrievers with ones reading from the current upstreams, if set.
+	settings *SettingsStore
+	client   httputils.Client
 }
 
 func NewDataCombiner(docStoreAPIURL, internalContentAPIURL, contentCollectionRWURL string, client httputils.Client) *DataCombiner {
@@ -35,7 +47,26 @@ func NewDataCombiner(docStoreAPIURL, internalContentAPIURL, contentCollectionRWU
 	}
 }
 
+// NewReloadableDataCombiner reads the content and the annotations from the upstreams of the current settings.
+func NewReloadableDataCombiner(settings *SettingsStore, client httputils.Client) *DataCombiner {
+	return &DataCombiner{
+		settings: settings,
+		client:   client,
+	}
+}
+
+// current returns the combiner reading from the current upstreams.
+func (dc DataCombiner) current() DataCombiner {
+	if dc.settings == nil {
+		return dc
+	}
+	u := dc.settings.Load().Upstreams
+	return *NewDataCombiner(u.DocumentStoreURL, u.InternalContentURL, u.ContentCollectionURL, dc.client)
+}
+
 func (dc DataCombiner) GetCombinedModelForContent(content ContentModel) (CombinedModel, error) {
+	dc = dc.current()
+
 	uuid := content.getUUID()
 	if uuid == "" {
 		return CombinedModel{}, fmt.Errorf("content has no UUID provided, can't deduce annotations for it")
@@ -65,6 +96,8 @@ func (dc DataCombiner) GetCombinedModelForAnnotations(metadata AnnotationsMessag
 }
 
 func (dc DataCombiner) GetCombinedModel(uuid string) (CombinedModel, error) {
+	dc = dc.current()
+
 	content, err := dc.contentRetriever.getContent(uuid)
 	if err != nil {
 		return CombinedModel{}, err
@@ -100,3 +133,37 @@ func (dc DataCombiner) GetCombinedModel(uuid string) (CombinedModel, error) {
 		LastModified:    content.getLastModified(),
 	}, nil
 }
+
+// FindSources returns the sources still holding the content or the annotations with the UUID.
+// Unlike GetCombinedModel, it checks every source, whether the others have the content or not.
+func (dc DataCombiner) FindSources(uuid string) ([]string, error) {
+	dc = dc.current()
+
+	var sources []string
+
+	content, err := dc.contentRetriever.getContent(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s: %w", DocumentStoreSource, err)
+	}
+	if content.getUUID() != "" {
+		sources = append(sources, DocumentStoreSource)
+	}
+
+	collection, err := dc.contentCollectionRetriever.getContent(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s: %w", ContentCollectionSource, err)
+	}
+	if collection.getUUID() != "" {
+		sources = append(sources, ContentCollectionSource)
+	}
+
+	internalContent, annotations, err := dc.internalContentRetriever.getInternalContent(uuid)
+	if err != nil {
+		return nil, fmt.Errorf("error checking %s: %w", InternalContentSource, err)
+	}
+	if internalContent.getUUID() != "" || len(annotations) > 0 {
+		sources = append(sources, InternalContentSource)
+	}
+
+	return sources, nil
+}
@@ -896,6 +896,63 @@ func TestGetCombinedModel(t *testing.T) {
 	}
 }
 
+func TestFindSources(t *testing.T) {
+	content := ContentModel{"uuid": "some-uuid"}
+
+	tests := []struct {
+		name            string
+		content         DummyContentRetriever
+		collection      DummyContentRetriever
+		internalContent DummyInternalContentRetriever
+		expSources      []string
+		expError        string
+	}{
+		{
+			name: "gone from every source",
+		},
+		{
+			name:       "only in the document store",
+			content:    DummyContentRetriever{c: content},
+			expSources: []string{DocumentStoreSource},
+		},
+		{
+			name:            "in every source",
+			content:         DummyContentRetriever{c: content},
+			collection:      DummyContentRetriever{c: content},
+			internalContent: DummyInternalContentRetriever{c: content},
+			expSources:      []string{DocumentStoreSource, ContentCollectionSource, InternalContentSource},
+		},
+		{
+			name:            "only annotations left",
+			internalContent: DummyInternalContentRetriever{ann: []Annotation{{Thing: Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995"}}}},
+			expSources:      []string{InternalContentSource},
+		},
+		{
+			name:       "content collection error",
+			collection: DummyContentRetriever{err: fmt.Errorf("some error")},
+			expError:   "error checking content-collection: some error",
+		},
+	}
+
+	for _, testCase := range tests {
+		t.Run(testCase.name, func(t *testing.T) {
+			combiner := DataCombiner{
+				contentRetriever:           testCase.content,
+				contentCollectionRetriever: testCase.collection,
+				internalContentRetriever:   testCase.internalContent,
+			}
+
+			sources, err := combiner.FindSources("some-uuid")
+			assert.Equal(t, testCase.expSources, sources)
+			if testCase.expError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, testCase.expError)
+			}
+		})
+	}
+}
+
 func TestGetInternalContent(t *testing.T) {
 	tests := []struct {
 		name           string
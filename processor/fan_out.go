@@ -0,0 +1,216 @@
+package processor
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/google/uuid"
+	"github.com/rcrowley/go-metrics"
+)
+
+// FanOutCaller is the X-Forced-By header of the recombined members of the packages.
+const FanOutCaller = "package-fan-out"
+
+var (
+	fanOutEnqueuedCounter = metrics.GetOrRegisterCounter("fanout.members.enqueued", metrics.DefaultRegistry)
+	fanOutSkippedCounter  = metrics.GetOrRegisterCounter("fanout.members.skipped", metrics.DefaultRegistry)
+	fanOutDroppedCounter  = metrics.GetOrRegisterCounter("fanout.members.dropped", metrics.DefaultRegistry)
+	fanOutFailedCounter   = metrics.GetOrRegisterCounter("fanout.members.failed", metrics.DefaultRegistry)
+)
+
+type memberPublisher interface {
+	ForcePublication(uuid string, tid string, opts ...ForceOption) error
+}
+
+// FanOutConfig holds the limits of the recombination of the members of the packages.
+type FanOutConfig struct {
+	// ContentTypes of the packages whose members are recombined.
+	ContentTypes []string
+	// MaxMembers is the number of members recombined per package. The others are skipped.
+	MaxMembers int
+	// QueueSize is the number of members waiting to be recombined. Members are dropped while the queue is full.
+	QueueSize int
+	// Cooldown is the time a recombined member isn't recombined again for, whichever package it is in.
+	Cooldown time.Duration
+}
+
+type fanOutMember struct {
+	uuid        string
+	packageUUID string
+	tid         string
+}
+
+// FanOut recombines the members of the packages on the forced topic, after the packages are forwarded,
+// so that they don't keep a stale package context.
+// The members are recombined through the force requests, which never fan out, so the packages within packages
+// don't cascade. The cooldown keeps the members of frequently updated or overlapping packages
+// from being recombined over and over.
+type FanOut struct {
+	publisher    memberPublisher
+	config       FanOutConfig
+	contentTypes []*regexp.Regexp
+	queue        chan fanOutMember
+	log          *logger.UPPLogger
+
+	mu     sync.Mutex
+	recent map[string]time.Time
+	now    func() time.Time
+}
+
+func NewFanOut(publisher memberPublisher, config FanOutConfig, log *logger.UPPLogger) *FanOut {
+	return &FanOut{
+		publisher:    publisher,
+		config:       config,
+		contentTypes: compileGlobs(config.ContentTypes),
+		queue:        make(chan fanOutMember, config.QueueSize),
+		log:          log,
+		recent:       map[string]time.Time{},
+		now:          time.Now,
+	}
+}
+
+// Enqueue queues the members of the message for recombination, if it is a package of one of the configured types.
+// It never blocks the processing of the messages.
+func (f *FanOut) Enqueue(message *CombinedModel, contentType, tid string) {
+	if message.Deleted || !matchesAny(f.contentTypes, contentType) {
+		return
+	}
+
+	log := f.log.
+		WithTransactionID(tid).
+		WithUUID(message.UUID).
+		WithField("processor", "fan-out")
+
+	members := packageMembers(message)
+	if len(members) > f.config.MaxMembers {
+		log.Warnf("The package has %d members, only the first %d are recombined", len(members), f.config.MaxMembers)
+		fanOutSkippedCounter.Inc(int64(len(members) - f.config.MaxMembers))
+		members = members[:f.config.MaxMembers]
+	}
+
+	var enqueued int
+	for _, m := range members {
+		if !f.claim(m) {
+			fanOutSkippedCounter.Inc(1)
+			continue
+		}
+		select {
+		case f.queue <- fanOutMember{uuid: m, packageUUID: message.UUID, tid: tid}:
+			enqueued++
+			fanOutEnqueuedCounter.Inc(1)
+		default:
+			f.release(m)
+			fanOutDroppedCounter.Inc(1)
+			log.WithField("member", m).Warn("The fan-out queue is full, the package member is not recombined")
+		}
+	}
+	if enqueued > 0 {
+		log.Infof("Enqueued %d package members for recombination", enqueued)
+	}
+}
+
+// claim reports whether the member can be recombined, and starts its cooldown if so.
+func (f *FanOut) claim(member string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	now := f.now()
+	for m, at := range f.recent {
+		if now.Sub(at) >= f.config.Cooldown {
+			delete(f.recent, m)
+		}
+	}
+	if _, ok := f.recent[member]; ok {
+		return false
+	}
+	f.recent[member] = now
+	return true
+}
+
+// release ends the cooldown of a member which was not recombined.
+func (f *FanOut) release(member string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.recent, member)
+}
+
+// Run recombines the queued members one at a time, until stop is closed.
+// The members still queued at that point are dropped.
+func (f *FanOut) Run(stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			if n := len(f.queue); n > 0 {
+				fanOutDroppedCounter.Inc(int64(n))
+				f.log.Warnf("Dropped %d queued package members on stop", n)
+			}
+			return
+		case m := <-f.queue:
+			f.recombine(m)
+		}
+	}
+}
+
+func (f *FanOut) recombine(m fanOutMember) {
+	log := f.log.
+		WithTransactionID(m.tid).
+		WithUUID(m.uuid).
+		WithField("processor", "fan-out").
+		WithField("package", m.packageUUID)
+
+	err := f.publisher.ForcePublication(m.uuid, m.tid, ForcedBy(FanOutCaller))
+	if errors.Is(err, ErrHeld) {
+		log.Warn("The package member was sent to the holding topic")
+		return
+	}
+	if err != nil {
+		fanOutFailedCounter.Inc(1)
+		log.WithError(err).Warn("Could not recombine the package member")
+		return
+	}
+	log.Info("Package member recombined")
+}
+
+// packageMembers returns the UUIDs of the members of the package, in order and without duplicates,
+// from the contains lists of the internal content and the content, and from the items of a content collection.
+func packageMembers(message *CombinedModel) []string {
+	seen := map[string]bool{message.UUID: true}
+	var members []string
+	for _, refs := range []interface{}{
+		message.InternalContent["contains"],
+		message.Content["contains"],
+		message.Content["items"],
+	} {
+		list, _ := refs.([]interface{})
+		for _, ref := range list {
+			if m := memberUUID(ref); m != "" && !seen[m] {
+				seen[m] = true
+				members = append(members, m)
+			}
+		}
+	}
+	return members
+}
+
+// memberUUID returns the UUID of the member reference, read from its uuid, or from the end of its id or apiUrl.
+func memberUUID(ref interface{}) string {
+	fields, ok := ref.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	if s, ok := fields["uuid"].(string); ok {
+		if id, err := uuid.Parse(s); err == nil {
+			return id.String()
+		}
+	}
+	for _, key := range []string{"id", "apiUrl"} {
+		s, _ := fields[key].(string)
+		if id, err := UUIDFromContentURI(s); err == nil {
+			return id
+		}
+	}
+	return ""
+}
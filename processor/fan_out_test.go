@@ -0,0 +1,194 @@
+package processor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingPublisher struct {
+	mu      sync.Mutex
+	uuids   []string
+	forcers []string
+	err     error
+}
+
+func (p *recordingPublisher) ForcePublication(uuid string, _ string, opts ...ForceOption) error {
+	var r forceRequest
+	for _, opt := range opts {
+		opt(&r)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uuids = append(p.uuids, uuid)
+	p.forcers = append(p.forcers, r.forcedBy)
+	return p.err
+}
+
+func (p *recordingPublisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.uuids...)
+}
+
+const (
+	packageUUID = "6a7ad3d2-3f8a-4b1a-9d3c-2c3e8c5b9f10"
+	memberUUID1 = "a224c5d3-0f1c-49bd-b70c-c88f5d29cf60"
+	memberUUID2 = "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"
+	memberUUID3 = "41358e4b-6d05-4f44-9eaf-f6a542154110"
+)
+
+func contentPackage() *CombinedModel {
+	return &CombinedModel{
+		UUID: packageUUID,
+		Content: ContentModel{
+			"uuid": packageUUID,
+			"type": "ContentPackage",
+			"contains": []interface{}{
+				map[string]interface{}{"id": "http://www.ft.com/thing/" + memberUUID1},
+			},
+		},
+		InternalContent: ContentModel{
+			"uuid": packageUUID,
+			"contains": []interface{}{
+				map[string]interface{}{"id": "http://www.ft.com/thing/" + memberUUID1, "apiUrl": "http://api.ft.com/content/" + memberUUID1},
+				map[string]interface{}{"apiUrl": "http://api.ft.com/content/" + memberUUID2},
+				map[string]interface{}{"id": "http://www.ft.com/thing/" + packageUUID},
+				map[string]interface{}{"id": "not a member"},
+			},
+		},
+	}
+}
+
+func newTestFanOut(publisher memberPublisher, config FanOutConfig) *FanOut {
+	log, _ := testLogger()
+	if config.ContentTypes == nil {
+		config.ContentTypes = []string{"ContentPackage", "LiveBlogPackage"}
+	}
+	return NewFanOut(publisher, config, log)
+}
+
+func TestPackageMembers(t *testing.T) {
+	collection := &CombinedModel{
+		UUID: packageUUID,
+		Content: ContentModel{
+			"uuid": packageUUID,
+			"items": []interface{}{
+				map[string]interface{}{"uuid": memberUUID3},
+				map[string]interface{}{"uuid": "not-a-uuid"},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{memberUUID1, memberUUID2}, packageMembers(contentPackage()), "the package itself and the duplicates are skipped")
+	assert.Equal(t, []string{memberUUID3}, packageMembers(collection))
+	assert.Empty(t, packageMembers(&CombinedModel{UUID: packageUUID, Content: ContentModel{"contains": "invalid"}}))
+}
+
+func TestFanOut_Enqueue(t *testing.T) {
+	publisher := &recordingPublisher{}
+	f := newTestFanOut(publisher, FanOutConfig{MaxMembers: 10, QueueSize: 10, Cooldown: time.Minute})
+
+	f.Enqueue(contentPackage(), "Article", "tid_fan_out")
+	assert.Len(t, f.queue, 0, "only the packages fan out")
+
+	deleted := contentPackage()
+	deleted.Deleted = true
+	f.Enqueue(deleted, "ContentPackage", "tid_fan_out")
+	assert.Len(t, f.queue, 0, "the deleted packages don't fan out")
+
+	f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+	require.Len(t, f.queue, 2)
+	assert.Equal(t, fanOutMember{uuid: memberUUID1, packageUUID: packageUUID, tid: "tid_fan_out"}, <-f.queue)
+	assert.Equal(t, fanOutMember{uuid: memberUUID2, packageUUID: packageUUID, tid: "tid_fan_out"}, <-f.queue)
+}
+
+func TestFanOut_Limits(t *testing.T) {
+	t.Run("max members", func(t *testing.T) {
+		f := newTestFanOut(&recordingPublisher{}, FanOutConfig{MaxMembers: 1, QueueSize: 10, Cooldown: time.Minute})
+		skipped := fanOutSkippedCounter.Count()
+
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		assert.Len(t, f.queue, 1)
+		assert.Equal(t, int64(1), fanOutSkippedCounter.Count()-skipped)
+	})
+
+	t.Run("queue size", func(t *testing.T) {
+		f := newTestFanOut(&recordingPublisher{}, FanOutConfig{MaxMembers: 10, QueueSize: 1, Cooldown: time.Minute})
+		dropped := fanOutDroppedCounter.Count()
+
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		assert.Len(t, f.queue, 1)
+		assert.Equal(t, int64(1), fanOutDroppedCounter.Count()-dropped)
+
+		<-f.queue
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		assert.Equal(t, fanOutMember{uuid: memberUUID2, packageUUID: packageUUID, tid: "tid_fan_out"}, <-f.queue,
+			"the dropped members are not in cooldown")
+	})
+
+	t.Run("cooldown", func(t *testing.T) {
+		f := newTestFanOut(&recordingPublisher{}, FanOutConfig{MaxMembers: 10, QueueSize: 10, Cooldown: time.Minute})
+		now := time.Now()
+		f.now = func() time.Time { return now }
+
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		assert.Len(t, f.queue, 2, "the members are recombined once within the cooldown")
+
+		now = now.Add(time.Minute)
+		f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+		assert.Len(t, f.queue, 4)
+	})
+}
+
+func TestFanOut_Run(t *testing.T) {
+	publisher := &recordingPublisher{err: errors.New("some error")}
+	f := newTestFanOut(publisher, FanOutConfig{MaxMembers: 10, QueueSize: 10, Cooldown: time.Minute})
+	failed := fanOutFailedCounter.Count()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		f.Run(stop)
+		close(done)
+	}()
+
+	f.Enqueue(contentPackage(), "ContentPackage", "tid_fan_out")
+	assert.Eventually(t, func() bool {
+		return len(publisher.published()) == 2
+	}, time.Second, 10*time.Millisecond)
+	close(stop)
+	<-done
+
+	assert.Equal(t, []string{memberUUID1, memberUUID2}, publisher.published())
+	assert.Equal(t, []string{FanOutCaller, FanOutCaller}, publisher.forcers)
+	assert.Equal(t, int64(2), fanOutFailedCounter.Count()-failed)
+}
+
+func TestProcessContentMsg_FanOut(t *testing.T) {
+	pkg := contentPackage()
+	f := newTestFanOut(&recordingPublisher{}, FanOutConfig{MaxMembers: 10, QueueSize: 10, Cooldown: time.Minute})
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		dataCombiner: DummyDataCombiner{t: t, expectedContent: pkg.Content, data: *pkg},
+		forwarder:    newForwarder(&recordingProducer{}, ForwarderConfig{SupportedContentTypes: []string{"ContentPackage"}}),
+		opaAgent:     mockOpaAgent{returnResult: &policy.ContentPolicyResult{}},
+		fanOut:       f,
+		log:          log,
+	}
+
+	p.processContentMsg(kafka.FTMessage{
+		Headers: map[string]string{"X-Request-Id": "tid_fan_out"},
+		Body:    `{"payload":{"uuid":"` + packageUUID + `","type":"ContentPackage","contains":[{"id":"http://www.ft.com/thing/` + memberUUID1 + `"}]}}`,
+	})
+
+	assert.Len(t, f.queue, 2)
+}
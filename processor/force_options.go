@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+)
+
+// ForceTopic is the topic a forced message is sent to.
+type ForceTopic string
+
+const (
+	// ForcedTopic is the forced combined topic, where the forced messages go by default.
+	ForcedTopic ForceTopic = "forced"
+	// LiveTopic is the combined topic the published content goes to.
+	LiveTopic ForceTopic = "live"
+)
+
+var (
+	ErrInvalidForceTopic     = errors.New("invalid force topic")
+	ErrHeaderNotOverridable  = errors.New("header can't be overridden")
+	ErrLiveTopicNotAvailable = errors.New("forcing to the live topic is not configured")
+	ErrBypassWithoutReason   = errors.New("the policy bypass has no reason")
+	ErrInvalidForceOption    = errors.New("invalid force option")
+)
+
+// ParseForceTopic parses the topic of a force request. An empty string is the forced topic.
+func ParseForceTopic(s string) (ForceTopic, error) {
+	switch t := ForceTopic(s); t {
+	case "":
+		return ForcedTopic, nil
+	case ForcedTopic, LiveTopic:
+		return t, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidForceTopic, s)
+}
+
+// protectedHeaders can't be overridden by the force requests,
+// as they identify the request, who made it and the policy decision, or describe how the message is encoded.
+var protectedHeaders = map[string]bool{
+	"X-Request-Id":      true,
+	"Origin-System-Id":  true,
+	ForcedByHeader:      true,
+	DecisionIDHeader:    true,
+	PolicyWarningHeader: true,
+	ClaimCheckHeader:    true,
+	"Message-Type":      true,
+	"Content-Type":      true,
+	SchemaVersionHeader: true,
+}
+
+type forceRequest struct {
+	forcedBy     string
+	topic        ForceTopic
+	headers      map[string]string
+	origin       string
+	bypass       bool
+	bypassReason string
+}
+
+type ForceOption func(*forceRequest)
+
+// ForcedBy records the authenticated caller who requested the publication in the X-Forced-By header.
+func ForcedBy(caller string) ForceOption {
+	return func(r *forceRequest) {
+		r.forcedBy = caller
+	}
+}
+
+// ToTopic sends the forced message to the given topic instead of the forced combined topic.
+func ToTopic(topic ForceTopic) ForceOption {
+	return func(r *forceRequest) {
+		r.topic = topic
+	}
+}
+
+// WithHeaders adds the headers to the forced message, overriding the default ones.
+func WithHeaders(headers map[string]string) ForceOption {
+	return func(r *forceRequest) {
+		r.headers = headers
+	}
+}
+
+// WithOrigin sets the Origin-System-Id of the forced message.
+func WithOrigin(origin string) ForceOption {
+	return func(r *forceRequest) {
+		r.origin = origin
+	}
+}
+
+// BypassingPolicy forwards the message without evaluating the force policy.
+func BypassingPolicy(reason string) ForceOption {
+	return func(r *forceRequest) {
+		r.bypass = true
+		r.bypassReason = reason
+	}
+}
+
+func (r *forceRequest) validate() error {
+	if _, err := ParseForceTopic(string(r.topic)); err != nil {
+		return err
+	}
+	if r.bypass && r.bypassReason == "" {
+		return ErrBypassWithoutReason
+	}
+	for k := range r.headers {
+		if protectedHeaders[textproto.CanonicalMIMEHeaderKey(k)] {
+			return fmt.Errorf("%w: %s", ErrHeaderNotOverridable, k)
+		}
+	}
+	return nil
+}
+
+// apply sets the overridden headers of the forced message.
+func (r *forceRequest) apply(h map[string]string) {
+	if r.origin != "" {
+		h["Origin-System-Id"] = r.origin
+	}
+	for k, v := range r.headers {
+		h[k] = v
+	}
+	if r.forcedBy != "" {
+		h[ForcedByHeader] = r.forcedBy
+	}
+}
+
+// overrides lists the changes to the topic, the headers and the origin of the forced message. It is nil if there are none.
+func (r *forceRequest) overrides() map[string]string {
+	o := map[string]string{}
+	if r.topic != "" && r.topic != ForcedTopic {
+		o["topic"] = string(r.topic)
+	}
+	if r.origin != "" {
+		o["Origin-System-Id"] = r.origin
+	}
+	for k, v := range r.headers {
+		o[k] = v
+	}
+	if len(o) == 0 {
+		return nil
+	}
+	return o
+}
+
+// record adds the overrides and the policy bypass of the request to the audit log, if there is one.
+func (r *forceRequest) record(recorder auditRecorder, uuid, tid string) {
+	if recorder == nil {
+		return
+	}
+
+	if o := r.overrides(); o != nil {
+		recorder.Record(audit.Entry{
+			Type:          audit.ForceOverride,
+			UUID:          uuid,
+			TransactionID: tid,
+			Caller:        r.forcedBy,
+			Overrides:     o,
+		})
+	}
+	if r.bypass {
+		recorder.Record(audit.Entry{
+			Type:          audit.ForceBypass,
+			UUID:          uuid,
+			TransactionID: tid,
+			Policy:        policy.KafkaIngestForce.String(),
+			Reasons:       []string{r.bypassReason},
+			Caller:        r.forcedBy,
+		})
+	}
+}
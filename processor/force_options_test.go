@@ -0,0 +1,193 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseForceTopic(t *testing.T) {
+	for s, expected := range map[string]ForceTopic{"": ForcedTopic, "forced": ForcedTopic, "live": LiveTopic} {
+		topic, err := ParseForceTopic(s)
+		require.NoError(t, err)
+		assert.Equal(t, expected, topic)
+	}
+
+	_, err := ParseForceTopic("quarantine")
+	assert.ErrorIs(t, err, ErrInvalidForceTopic)
+}
+
+func TestForcePublication_Options(t *testing.T) {
+	skip := &policy.ContentPolicyResult{Skip: true, Reasons: []string{"not allowed"}}
+
+	tests := []struct {
+		name            string
+		opts            []ForceOption
+		liveForwarding  bool
+		policyResult    *policy.ContentPolicyResult
+		skipped         bool
+		err             error
+		expectedTopic   string
+		expectedHeaders map[string]string
+		expectedAudit   []audit.Entry
+	}{
+		{
+			name:            "no options",
+			policyResult:    &policy.ContentPolicyResult{},
+			expectedTopic:   "forced",
+			expectedHeaders: map[string]string{"Origin-System-Id": CombinerOrigin},
+		},
+		{
+			name:            "live topic, headers and origin",
+			opts:            []ForceOption{ForcedBy("ops"), ToTopic(LiveTopic), WithHeaders(map[string]string{"X-Reindex": "true"}), WithOrigin("http://cmdb.ft.com/systems/pac")},
+			liveForwarding:  true,
+			policyResult:    &policy.ContentPolicyResult{},
+			expectedTopic:   "live",
+			expectedHeaders: map[string]string{"Origin-System-Id": "http://cmdb.ft.com/systems/pac", "X-Reindex": "true", ForcedByHeader: "ops"},
+			expectedAudit: []audit.Entry{{
+				Type:      audit.ForceOverride,
+				Caller:    "ops",
+				Overrides: map[string]string{"topic": "live", "X-Reindex": "true", "Origin-System-Id": "http://cmdb.ft.com/systems/pac"},
+			}},
+		},
+		{
+			name:            "policy bypass",
+			opts:            []ForceOption{ForcedBy("ops"), BypassingPolicy("legal approved")},
+			policyResult:    skip,
+			expectedTopic:   "forced",
+			expectedHeaders: map[string]string{"Origin-System-Id": CombinerOrigin, ForcedByHeader: "ops"},
+			expectedAudit: []audit.Entry{{
+				Type:    audit.ForceBypass,
+				Caller:  "ops",
+				Policy:  "kafka_ingest_force",
+				Reasons: []string{"legal approved"},
+			}},
+		},
+		{
+			name:         "overrides are audited even if the policy skips the publication",
+			opts:         []ForceOption{WithHeaders(map[string]string{"X-Reindex": "true"})},
+			policyResult: skip,
+			skipped:      true,
+			expectedAudit: []audit.Entry{
+				{
+					Type:    audit.PolicySkip,
+					Policy:  "kafka_ingest_force",
+					Reasons: []string{"not allowed"},
+				},
+				{
+					Type:      audit.ForceOverride,
+					Overrides: map[string]string{"X-Reindex": "true"},
+				},
+			},
+		},
+		{
+			name: "live topic not configured",
+			opts: []ForceOption{ToTopic(LiveTopic)},
+			err:  ErrLiveTopicNotAvailable,
+		},
+		{
+			name: "invalid topic",
+			opts: []ForceOption{ToTopic("quarantine")},
+			err:  ErrInvalidForceTopic,
+		},
+		{
+			name: "protected header",
+			opts: []ForceOption{WithHeaders(map[string]string{"x-forced-by": "someone-else"})},
+			err:  ErrHeaderNotOverridable,
+		},
+		{
+			name: "bypass without reason",
+			opts: []ForceOption{BypassingPolicy("")},
+			err:  ErrBypassWithoutReason,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log, _ := testLogger()
+			auditLog := audit.NewLog(10)
+			forced := &recordingProducer{}
+			live := &recordingProducer{}
+
+			requestOpts := []RequestProcessorOption{WithRequestAudit(auditLog)}
+			if test.liveForwarding {
+				requestOpts = append(requestOpts, WithLiveForwarding(live, ForwarderConfig{SupportedContentTypes: []string{"Article"}}))
+			}
+			p := NewRequestProcessor(
+				DummyDataCombiner{
+					t:            t,
+					expectedUUID: "some_uuid",
+					data:         CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+				},
+				forced,
+				ForwarderConfig{SupportedContentTypes: []string{"Article"}},
+				log,
+				mockOpaAgent{returnResult: test.policyResult},
+				requestOpts...,
+			)
+
+			err := p.ForcePublication("some_uuid", "some-tid", test.opts...)
+
+			var skipErr *PolicySkipError
+			switch {
+			case test.skipped:
+				require.ErrorAs(t, err, &skipErr)
+			case test.err != nil:
+				require.ErrorIs(t, err, test.err)
+			default:
+				require.NoError(t, err)
+			}
+
+			sent := map[string][]string{}
+			for topic, producer := range map[string]*recordingProducer{"forced": forced, "live": live} {
+				for _, m := range producer.messages {
+					sent[topic] = append(sent[topic], m.Headers["X-Request-Id"])
+					if topic == test.expectedTopic {
+						for k, v := range test.expectedHeaders {
+							assert.Equal(t, v, m.Headers[k], k)
+						}
+						if _, ok := test.expectedHeaders[ForcedByHeader]; !ok {
+							assert.NotContains(t, m.Headers, ForcedByHeader)
+						}
+					}
+				}
+			}
+			if test.expectedTopic == "" {
+				assert.Empty(t, sent)
+			} else {
+				assert.Equal(t, map[string][]string{test.expectedTopic: {"some-tid"}}, sent)
+			}
+
+			entries := auditLog.Entries(audit.Filter{})
+			require.Len(t, entries, len(test.expectedAudit))
+			for i, expected := range test.expectedAudit {
+				expected.Time = entries[i].Time
+				expected.UUID = "some_uuid"
+				expected.TransactionID = "some-tid"
+				assert.Equal(t, expected, entries[i])
+			}
+		})
+	}
+}
+
+func TestForceRequest_ProtectedHeaders(t *testing.T) {
+	for _, header := range []string{
+		"X-Request-Id",
+		"origin-system-id",
+		ForcedByHeader,
+		DecisionIDHeader,
+		PolicyWarningHeader,
+		ClaimCheckHeader,
+		"message-type",
+		"Content-Type",
+		SchemaVersionHeader,
+	} {
+		t.Run(header, func(t *testing.T) {
+			r := forceRequest{headers: map[string]string{header: "overridden"}}
+			assert.ErrorIs(t, r.validate(), ErrHeaderNotOverridable)
+		})
+	}
+}
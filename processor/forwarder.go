@@ -2,65 +2,213 @@ package processor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 )
 
 const (
 	CombinerMessageType = "cms-combined-content-published"
+	SchemaVersionHeader = "Schema-Version"
+	DecisionIDHeader    = "Policy-Decision-Id"
+
+	eventTimestampFormat = "2006-01-02T15:04:05.000Z07:00"
 )
 
+var ErrTopicNotAllowed = errors.New("topic not allowed")
+
 type messageProducer interface {
 	SendMessage(message kafka.FTMessage) error
 }
 
+// keyedMessageProducer sends the combined messages keyed with the UUID of their content,
+// so that the compacted topics keep only the last message of every content.
+type keyedMessageProducer interface {
+	SendKeyedMessage(key string, message kafka.FTMessage) error
+	// SendTombstone sends a message without a value, which removes the messages of the key from the compacted topics.
+	SendTombstone(key string) error
+}
+
+// TopicProducers holds the producers of the topics the policies are allowed to route messages to.
+type TopicProducers map[string]messageProducer
+
+// messageEncoder serialises the combined message envelope into the body of a Kafka message.
+type messageEncoder interface {
+	Encode(envelope *CombinedModelV2) ([]byte, error)
+	ContentType() string
+}
+
+// ForwarderConfig holds the settings for forwarding combined messages to a single output topic.
+type ForwarderConfig struct {
+	// SupportedContentTypes are the content types, or glob patterns of them, which are forwarded.
+	SupportedContentTypes []string
+	// ContentTypes set how the content without a type is handled.
+	ContentTypes ContentTypeConfig
+	// SchemaVersion of the produced messages. Defaults to SchemaV1.
+	SchemaVersion SchemaVersion
+	// Encoder of the produced messages. Defaults to JSON.
+	Encoder messageEncoder
+	// ClaimCheck of messages exceeding a size threshold. Disabled if nil.
+	ClaimCheck *ClaimCheckConfig
+	// Transforms applied to the messages before they are encoded. Disabled if nil.
+	Transforms *TransformPipeline
+	// Routes are the topics the policy decisions can send messages to, instead of the default one.
+	Routes TopicProducers
+	// Settings replace SupportedContentTypes, ContentTypes and Routes, and the SupportedHeaders of the message processor,
+	// with the reloadable ones, if set.
+	Settings *SettingsStore
+}
+
 type forwarder struct {
-	producer              messageProducer
-	supportedContentTypes []string
+	producer      messageProducer
+	contentTypes  *ContentTypeFilter
+	schemaVersion SchemaVersion
+	encoder       messageEncoder
+	claimCheck    *ClaimCheckConfig
+	transforms    *TransformPipeline
+	routes        TopicProducers
+	settings      *SettingsStore
 }
 
-func newForwarder(producer messageProducer, supportedContentTypes []string) *forwarder {
+func newForwarder(producer messageProducer, config ForwarderConfig) *forwarder {
+	schemaVersion := config.SchemaVersion
+	if schemaVersion == 0 {
+		schemaVersion = SchemaV1
+	}
+
+	encoder := config.Encoder
+	if encoder == nil {
+		encoder = jsonEncoder{}
+	}
+
 	return &forwarder{
-		producer:              producer,
-		supportedContentTypes: supportedContentTypes,
+		producer:      producer,
+		contentTypes:  NewContentTypeFilter(config.SupportedContentTypes, config.ContentTypes),
+		schemaVersion: schemaVersion,
+		encoder:       encoder,
+		claimCheck:    config.ClaimCheck,
+		transforms:    config.Transforms,
+		routes:        config.Routes,
+		settings:      config.Settings,
 	}
 }
 
-func (f *forwarder) filterAndForwardMsg(headers map[string]string, message *CombinedModel) error {
+// current returns the settings to process a message with.
+// They are loaded once per message and passed down, so that a reload doesn't mix the old and the new ones.
+func (f *forwarder) current() *Settings {
+	if f.settings != nil {
+		return f.settings.Load()
+	}
+	return &Settings{ContentTypes: f.contentTypes, Routes: f.routes}
+}
+
+// filterAndForwardMsg forwards the message if its content type is supported, applying the policy decision, if there is one.
+func (f *forwarder) filterAndForwardMsg(
+	settings *Settings,
+	headers map[string]string,
+	message *CombinedModel,
+	trigger TriggerType,
+	decision *policy.ContentPolicyResult,
+	sources ...SourceEvent,
+) error {
 	if message.Content != nil {
-		contentType := message.Content.getType()
+		contentType := settings.ContentTypes.TypeOf(message)
 
-		if !f.isTypeAllowed(contentType) {
-			return fmt.Errorf("%w: %s", ErrInvalidContentType, contentType)
+		if !settings.ContentTypes.Allows(contentType) {
+			return fmt.Errorf("%w: %q", ErrInvalidContentType, contentType)
 		}
 	}
 
-	if err := f.forwardMsg(headers, message); err != nil {
+	if err := f.forwardMsg(settings, headers, message, trigger, decision, sources...); err != nil {
 		return fmt.Errorf("error forwarding message to Kafka: %w", err)
 	}
 
 	return nil
 }
 
-func (f *forwarder) isTypeAllowed(contentType string) bool {
-	for _, t := range f.supportedContentTypes {
-		if contentType == t {
-			return true
+func (f *forwarder) forwardMsg(
+	settings *Settings,
+	headers map[string]string,
+	message *CombinedModel,
+	trigger TriggerType,
+	decision *policy.ContentPolicyResult,
+	sources ...SourceEvent,
+) error {
+	producer := f.producer
+	if decision != nil {
+		if decision.Topic != "" {
+			var ok bool
+			if producer, ok = settings.Routes[decision.Topic]; !ok {
+				return fmt.Errorf("%w: %s", ErrTopicNotAllowed, decision.Topic)
+			}
+		}
+		for k, v := range decision.Headers {
+			headers[k] = v
+		}
+		if decision.DecisionID != "" {
+			headers[DecisionIDHeader] = decision.DecisionID
 		}
+		message = redact(message, decision.Redact)
 	}
-	return false
-}
 
-func (f *forwarder) forwardMsg(headers map[string]string, message *CombinedModel) error {
-	b, err := json.Marshal(message)
+	message = f.transforms.Apply(message, settings.ContentTypes.TypeOf(message))
+
+	b, err := f.encoder.Encode(f.envelope(message, trigger, sources))
 	if err != nil {
 		return err
 	}
 
+	contentType := f.encoder.ContentType()
+	if f.claimCheck.exceeds(b) {
+		if b, err = f.claimCheck.check(message, b, contentType); err != nil {
+			return err
+		}
+		contentType = ContentType
+		headers[ClaimCheckHeader] = "true"
+	}
+
 	headers["Message-Type"] = CombinerMessageType
-	return f.producer.SendMessage(kafka.FTMessage{
+	headers["Content-Type"] = contentType
+	headers[SchemaVersionHeader] = f.schemaVersion.String()
+	m := kafka.FTMessage{
 		Headers: headers,
 		Body:    string(b),
-	})
+	}
+	if keyed, ok := producer.(keyedMessageProducer); ok {
+		return keyed.SendKeyedMessage(message.UUID, m)
+	}
+	return producer.SendMessage(m)
+}
+
+// envelope wraps the message with the details of the event which triggered its creation.
+// Encoders of the original schema version only serialise the embedded CombinedModel.
+func (f *forwarder) envelope(message *CombinedModel, trigger TriggerType, sources []SourceEvent) *CombinedModelV2 {
+	if sources == nil {
+		sources = []SourceEvent{}
+	}
+
+	return &CombinedModelV2{
+		SchemaVersion:  f.schemaVersion,
+		Trigger:        trigger,
+		EventTimestamp: time.Now().UTC().Format(eventTimestampFormat),
+		SourceEvents:   sources,
+		CombinedModel:  *message,
+	}
+}
+
+// jsonEncoder serialises messages as JSON, the CombinedModel for SchemaV1 and the whole envelope for newer versions.
+type jsonEncoder struct{}
+
+func (jsonEncoder) Encode(envelope *CombinedModelV2) ([]byte, error) {
+	if envelope.SchemaVersion == SchemaV1 {
+		return json.Marshal(&envelope.CombinedModel)
+	}
+	return json.Marshal(envelope)
+}
+
+func (jsonEncoder) ContentType() string {
+	return ContentType
 }
@@ -1,5 +1,12 @@
 package processor
 
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+)
+
 type ContentMessage struct {
 	ContentURI   string       `json:"contentUri"`
 	ContentModel ContentModel `json:"payload"`
@@ -19,6 +26,66 @@ type CombinedModel struct {
 	Deleted      bool   `json:"deleted"`
 }
 
+// SchemaVersion identifies the shape of the combined messages sent to an output topic.
+type SchemaVersion int
+
+const (
+	// SchemaV1 is the original CombinedModel, sent without an envelope.
+	SchemaV1 SchemaVersion = 1
+	// SchemaV2 is the CombinedModelV2 envelope.
+	SchemaV2 SchemaVersion = 2
+)
+
+func ParseSchemaVersion(v int) (SchemaVersion, error) {
+	switch SchemaVersion(v) {
+	case SchemaV1, SchemaV2:
+		return SchemaVersion(v), nil
+	}
+	return 0, fmt.Errorf("unsupported schema version: %d", v)
+}
+
+func (v SchemaVersion) String() string {
+	return strconv.Itoa(int(v))
+}
+
+// TriggerType describes the kind of event which caused a combined message to be created.
+type TriggerType string
+
+const (
+	ContentTrigger  TriggerType = "content"
+	MetadataTrigger TriggerType = "metadata"
+	ForcedTrigger   TriggerType = "forced"
+)
+
+// CombinedModelV2 is the versioned envelope of the combined message.
+// The fields of the embedded CombinedModel are inlined next to the envelope ones.
+type CombinedModelV2 struct {
+	SchemaVersion  SchemaVersion `json:"schemaVersion"`
+	Trigger        TriggerType   `json:"trigger"`
+	EventTimestamp string        `json:"eventTimestamp"`
+	SourceEvents   []SourceEvent `json:"sourceEvents"`
+	CombinedModel
+}
+
+// SourceEvent references a consumed message which contributed to the creation of a combined message.
+type SourceEvent struct {
+	Topic          string `json:"topic,omitempty"`
+	TransactionID  string `json:"transactionId,omitempty"`
+	OriginSystemID string `json:"originSystemId,omitempty"`
+	MessageType    string `json:"messageType,omitempty"`
+	Timestamp      string `json:"timestamp,omitempty"`
+}
+
+func newSourceEvent(m kafka.FTMessage) SourceEvent {
+	return SourceEvent{
+		Topic:          m.Topic,
+		TransactionID:  m.Headers["X-Request-Id"],
+		OriginSystemID: m.Headers["Origin-System-Id"],
+		MessageType:    m.Headers["Message-Type"],
+		Timestamp:      m.Headers["Message-Timestamp"],
+	}
+}
+
 type AnnotationsMessage struct {
 	ContentURI   string            `json:"contentUri"`
 	Annotations  *AnnotationsModel `json:"payload"`
@@ -62,8 +129,10 @@ func (cm ContentModel) getUUID() string {
 	return getMapValueAsString("uuid", cm)
 }
 
+// getType returns an empty type for a missing, null or non-string one.
 func (cm ContentModel) getType() string {
-	return getMapValueAsString("type", cm)
+	t, _ := cm["type"].(string)
+	return t
 }
 
 func (cm ContentModel) getLastModified() string {
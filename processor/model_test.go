@@ -1,8 +1,10 @@
 package processor
 
 import (
-	"github.com/stretchr/testify/assert"
 	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestGetMapValueAsString(t *testing.T) {
@@ -42,3 +44,46 @@ func TestGetIdentifiers(t *testing.T) {
 		assert.Equal(testCase.expIDs, arr)
 	}
 }
+
+func TestParseSchemaVersion(t *testing.T) {
+	tests := []struct {
+		version    int
+		expVersion SchemaVersion
+		expErr     bool
+	}{
+		{1, SchemaV1, false},
+		{2, SchemaV2, false},
+		{0, 0, true},
+		{3, 0, true},
+	}
+
+	for _, testCase := range tests {
+		v, err := ParseSchemaVersion(testCase.version)
+		if testCase.expErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, testCase.expVersion, v)
+	}
+}
+
+func TestNewSourceEvent(t *testing.T) {
+	m := kafka.FTMessage{
+		Topic: "PostConceptAnnotations",
+		Headers: map[string]string{
+			"X-Request-Id":      "some-tid1",
+			"Origin-System-Id":  "http://cmdb.ft.com/systems/pac",
+			"Message-Type":      "concept-annotation",
+			"Message-Timestamp": "2017-03-30T13:09:06.480Z",
+		},
+	}
+
+	assert.Equal(t, SourceEvent{
+		Topic:          "PostConceptAnnotations",
+		TransactionID:  "some-tid1",
+		OriginSystemID: "http://cmdb.ft.com/systems/pac",
+		MessageType:    "concept-annotation",
+		Timestamp:      "2017-03-30T13:09:06.480Z",
+	}, newSourceEvent(m))
+}
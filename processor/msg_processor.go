@@ -2,19 +2,34 @@ package processor
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/Financial-Times/kafka-client-go/v4"
 	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/dchest/uniuri"
+	"github.com/rcrowley/go-metrics"
 )
 
 var (
 	ErrNotFound           = fmt.Errorf("content not found")
 	ErrInvalidContentType = fmt.Errorf("invalid content type")
+
+	ErrProcessingLoopNotRunning = errors.New("message processing loop is not running")
+	ErrProcessingLoopStalled    = errors.New("message processing loop is stalled")
+)
+
+var (
+	panicsCounter      = metrics.GetOrRegisterCounter("processing.panics", metrics.DefaultRegistry)
+	quarantinedCounter = metrics.GetOrRegisterCounter("processing.quarantined", metrics.DefaultRegistry)
+	// unmatchedOriginsCounter counts the metadata messages skipped because their Origin-System-Id matched no rule.
+	unmatchedOriginsCounter = metrics.GetOrRegisterCounter("metadata.origins.unmatched", metrics.DefaultRegistry)
 )
 
 type MsgProcessor struct {
@@ -23,16 +38,75 @@ type MsgProcessor struct {
 	dataCombiner dataCombiner
 	forwarder    *forwarder
 	opaAgent     policy.Agent
+	quarantine   messageProducer
+	policyErrors PolicyErrorConfig
+	policyInput  PolicyInputMode
+	audit        auditRecorder
+	fanOut       *FanOut
 	log          *logger.UPPLogger
+
+	running atomic.Bool
+	// processingSince holds the start time (in Unix nanoseconds) of the message that is currently being processed
+	// and is zero while the processing loop is idle.
+	processingSince atomic.Int64
+	activity        activityTracker
 }
 
 type MsgProcessorConfig struct {
+	// SupportedHeaders are the Origin-System-Id values of the metadata messages which are processed.
+	// They are matched exactly, unless the settings of the forwarder have origin rules.
 	SupportedHeaders []string
+	// StallTimeout is the time a single message is allowed to be processed for,
+	// before the processing loop is reported as stalled. A zero value disables the stall detection.
+	StallTimeout time.Duration
+	// ForwardingTimeout is the time messages can be received for without any being forwarded or skipped on purpose,
+	// before the processing is reported as not forwarding. A zero value disables the detection.
+	ForwardingTimeout time.Duration
 }
 
-func NewMsgProcessorConfig(supportedHeaders []string) MsgProcessorConfig {
+func NewMsgProcessorConfig(supportedHeaders []string, stallTimeout, forwardingTimeout time.Duration) MsgProcessorConfig {
 	return MsgProcessorConfig{
-		SupportedHeaders: supportedHeaders,
+		SupportedHeaders:  supportedHeaders,
+		StallTimeout:      stallTimeout,
+		ForwardingTimeout: forwardingTimeout,
+	}
+}
+
+type MsgProcessorOption func(*MsgProcessor)
+
+// WithFanOut makes the processor enqueue the members of the forwarded packages for recombination.
+func WithFanOut(fanOut *FanOut) MsgProcessorOption {
+	return func(p *MsgProcessor) {
+		p.fanOut = fanOut
+	}
+}
+
+// WithQuarantine makes the processor send every message, which caused a panic while being processed,
+// to the given producer instead of dropping it.
+func WithQuarantine(producer messageProducer) MsgProcessorOption {
+	return func(p *MsgProcessor) {
+		p.quarantine = producer
+	}
+}
+
+// WithPolicyErrors sets how the messages are handled when their policies can't be evaluated.
+func WithPolicyErrors(config PolicyErrorConfig) MsgProcessorOption {
+	return func(p *MsgProcessor) {
+		p.policyErrors = config
+	}
+}
+
+// WithPolicyInput sets what the policies are evaluated against.
+func WithPolicyInput(mode PolicyInputMode) MsgProcessorOption {
+	return func(p *MsgProcessor) {
+		p.policyInput = mode
+	}
+}
+
+// WithAudit makes the processor record the skip decisions of the policies.
+func WithAudit(recorder auditRecorder) MsgProcessorOption {
+	return func(p *MsgProcessor) {
+		p.audit = recorder
 	}
 }
 
@@ -43,33 +117,107 @@ func NewMsgProcessor(
 	dataCombiner dataCombiner,
 	producer messageProducer,
 	opaAgent policy.Agent,
-	whitelistedContentTypes []string,
-) MsgProcessor {
-	return MsgProcessor{
+	forwarderConfig ForwarderConfig,
+	opts ...MsgProcessorOption,
+) *MsgProcessor {
+	p := &MsgProcessor{
 		src:          srcCh,
 		config:       config,
 		dataCombiner: dataCombiner,
-		forwarder:    newForwarder(producer, whitelistedContentTypes),
+		forwarder:    newForwarder(producer, forwarderConfig),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
 }
 
 func (p *MsgProcessor) ProcessMessages() {
+	p.running.Store(true)
+	defer p.running.Store(false)
+
 	for {
 		m, more := <-p.src
 		if !more {
 			break
 		}
 
-		if isAnnotationMessage(m.Headers) {
-			p.processMetadataMsg(*m)
-		} else {
-			p.processContentMsg(*m)
+		p.processMessage(*m)
+	}
+}
+
+// processMessage handles a single message and recovers from any panic raised while doing so,
+// so that one malformed message can't stop the consumption of all the following ones.
+func (p *MsgProcessor) processMessage(m kafka.FTMessage) {
+	now := time.Now()
+	p.processingSince.Store(now.UnixNano())
+	defer p.processingSince.Store(0)
+	p.activity.received(m.Topic, now)
+	defer p.activity.done()
+
+	defer func() {
+		if r := recover(); r != nil {
+			p.handlePanic(m, r)
 		}
+	}()
+
+	if isAnnotationMessage(m.Headers) {
+		p.processMetadataMsg(m)
+	} else {
+		p.processContentMsg(m)
 	}
 }
 
+func (p *MsgProcessor) handlePanic(m kafka.FTMessage, r interface{}) {
+	panicsCounter.Inc(1)
+
+	log := p.log.
+		WithTransactionID(m.Headers["X-Request-Id"]).
+		WithField("topic", m.Topic).
+		WithField("stack", string(debug.Stack()))
+	log.Errorf("Recovered from panic while processing message: %v", r)
+
+	if p.quarantine == nil {
+		log.Warn("Message quarantine is not configured. The message will be dropped.")
+		return
+	}
+
+	if err := sendToQuarantine(p.quarantine, m, fmt.Sprintf("%v", r)); err != nil {
+		log.WithError(err).Error("Failed to send message to quarantine")
+		return
+	}
+
+	quarantinedCounter.Inc(1)
+	log.Info("Message sent to quarantine")
+}
+
+// ProcessingLoopCheck reports whether the processing loop is running and is not stuck on a single message.
+func (p *MsgProcessor) ProcessingLoopCheck() error {
+	if !p.running.Load() {
+		return ErrProcessingLoopNotRunning
+	}
+
+	since := p.processingSince.Load()
+	if since == 0 || p.config.StallTimeout == 0 {
+		return nil
+	}
+
+	if elapsed := time.Since(time.Unix(0, since)); elapsed > p.config.StallTimeout {
+		return fmt.Errorf("%w: current message is being processed for %s", ErrProcessingLoopStalled, elapsed.Round(time.Second))
+	}
+
+	return nil
+}
+
+// ForwardingCheck reports the messages received and forwarded per topic,
+// and fails if messages which weren't skipped on purpose have been received for longer than the forwarding timeout,
+// and still are, without any being forwarded.
+func (p *MsgProcessor) ForwardingCheck() (string, error) {
+	return p.activity.check(p.config.ForwardingTimeout, time.Now())
+}
+
 func isAnnotationMessage(msgHeaders map[string]string) bool {
 	msgType, ok := msgHeaders["Message-Type"]
 	if !ok {
@@ -93,27 +241,25 @@ func (p *MsgProcessor) processContentMsg(m kafka.FTMessage) {
 		return
 	}
 
-	var q map[string]interface{}
-	if err := json.Unmarshal([]byte(m.Body), &q); err != nil {
-		log.WithError(err).Error("Could not unmarshal the OPA Kafka Ingest query.")
-		return
-	}
+	var decision *policy.ContentPolicyResult
+	if p.policyInput != PolicyInputCombined {
+		q, err := eventPolicyInput(m.Body)
+		if err != nil {
+			log.WithError(err).Error("Could not unmarshal the OPA Kafka Ingest query.")
+			return
+		}
 
-	result, err := p.opaAgent.EvaluateKafkaIngestPolicy(q, policy.KafkaIngestContent)
-	if err != nil {
-		log.WithError(err).
-			Error("Could not evaluate the OPA Kafka Ingest policy while processing a content message.")
-		return
-	}
-	if result.Skip {
-		log.Error(formatOPASkipReasons(result.Reasons))
-		return
+		var forward bool
+		if decision, forward = p.evaluatePolicy(q, policy.KafkaIngestContent, cm.ContentModel.getUUID(), m, log); !forward {
+			return
+		}
 	}
 
 	uuid := cm.ContentModel.getUUID()
 	log = log.WithUUID(uuid)
 
 	var combinedMSG CombinedModel
+	var err error
 	if cm.ContentModel.isDeleted() {
 		combinedMSG.UUID = uuid
 		combinedMSG.LastModified = cm.LastModified
@@ -134,12 +280,36 @@ func (p *MsgProcessor) processContentMsg(m kafka.FTMessage) {
 		log.Warn("Could not find internal content when processing a content publish event.")
 	}
 
-	if err = p.forwarder.filterAndForwardMsg(m.Headers, &combinedMSG); err != nil {
+	if p.policyInput == PolicyInputCombined {
+		q, err := combinedPolicyInput(&combinedMSG, m.Headers)
+		if err != nil {
+			log.WithError(err).Error("Could not build the OPA Kafka Ingest query.")
+			return
+		}
+
+		var forward bool
+		if decision, forward = p.evaluatePolicy(q, policy.KafkaIngestContent, uuid, m, log); !forward {
+			return
+		}
+	}
+
+	settings := p.forwarder.current()
+	if err = p.forwarder.filterAndForwardMsg(settings, m.Headers, &combinedMSG, ContentTrigger, decision, newSourceEvent(m)); err != nil {
+		p.skipInvalidContentType(m, err)
 		log.WithError(err).Error("Failed to forward message to Kafka")
 		return
 	}
 
+	p.activity.forwarded(m.Topic, time.Now())
 	log.Info("Message successfully forwarded")
+	p.enqueueMembers(settings, &combinedMSG, tid)
+}
+
+func (p *MsgProcessor) origins(settings *Settings) *OriginMatcher {
+	if settings.Origins != nil {
+		return settings.Origins
+	}
+	return ExactOriginMatcher(p.config.SupportedHeaders)
 }
 
 func (p *MsgProcessor) processMetadataMsg(m kafka.FTMessage) {
@@ -151,7 +321,11 @@ func (p *MsgProcessor) processMetadataMsg(m kafka.FTMessage) {
 		WithTransactionID(tid).
 		WithField("processor", "metadata")
 
-	if !containsSubstringOf(p.config.SupportedHeaders, h) {
+	settings := p.forwarder.current()
+	rule, ok := p.origins(settings).Match(h)
+	if !ok {
+		unmatchedOriginsCounter.Inc(1)
+		p.activity.skipped(m.Topic)
 		log.WithField("originSystem", h).
 			Info("Skipped annotations with unsupported Origin-System-Id")
 		return
@@ -174,28 +348,78 @@ func (p *MsgProcessor) processMetadataMsg(m kafka.FTMessage) {
 		log.Warn("Could not find internal content when processing an annotations publish event.")
 	}
 
-	result, err := p.opaAgent.EvaluateKafkaIngestPolicy(
-		combinedMSG.Content,
-		policy.KafkaIngestMetadata,
-	)
-	if err != nil {
-		log.WithError(err).
-			Error("Could not evaluate the OPA Kafka Ingest policy while processing a metadata message.")
-		return
+	q := map[string]interface{}(combinedMSG.Content)
+	if p.policyInput == PolicyInputCombined {
+		if q, err = combinedPolicyInput(&combinedMSG, m.Headers); err != nil {
+			log.WithError(err).Error("Could not build the OPA Kafka Ingest query.")
+			return
+		}
+	}
+
+	if rule.restrictsContentTypes() {
+		if contentType := settings.ContentTypes.TypeOf(&combinedMSG); !rule.allows(contentType) {
+			p.activity.skipped(m.Topic)
+			log.WithField("originSystem", h).
+				WithField("contentType", contentType).
+				Info("Skipped annotations of a content type which is not allowed for the Origin-System-Id")
+			return
+		}
 	}
-	if result.Skip {
-		log.Error(formatOPASkipReasons(result.Reasons))
+
+	decision, forward := p.evaluatePolicy(q, policy.KafkaIngestMetadata, combinedMSG.UUID, m, log)
+	if !forward {
 		return
 	}
+	decision = routeToOriginTopic(decision, rule.Topic)
 
 	log = log.WithUUID(combinedMSG.Content.getUUID())
 
-	if err = p.forwarder.filterAndForwardMsg(m.Headers, &combinedMSG); err != nil {
+	if err = p.forwarder.filterAndForwardMsg(settings, m.Headers, &combinedMSG, MetadataTrigger, decision, newSourceEvent(m)); err != nil {
+		p.skipInvalidContentType(m, err)
 		log.WithError(err).Error("Failed to forward message to Kafka")
 		return
 	}
 
+	p.activity.forwarded(m.Topic, time.Now())
 	log.Info("Message successfully forwarded")
+	p.enqueueMembers(settings, &combinedMSG, tid)
+}
+
+// enqueueMembers fans out the forwarded package to its members, if enabled.
+func (p *MsgProcessor) enqueueMembers(settings *Settings, message *CombinedModel, tid string) {
+	if p.fanOut == nil {
+		return
+	}
+	p.fanOut.Enqueue(message, settings.ContentTypes.TypeOf(message), tid)
+}
+
+// evaluatePolicy returns the decision of the policy, if it was evaluated, and whether the message should be forwarded.
+// Skip decisions are added to the audit log.
+func (p *MsgProcessor) evaluatePolicy(
+	q map[string]interface{},
+	pol policy.Policy,
+	uuid string,
+	m kafka.FTMessage,
+	log *logger.LogEntry,
+) (*policy.ContentPolicyResult, bool) {
+	forward, decision, err := evaluatePolicy(p.opaAgent, p.policyErrors, q, pol, m, log)
+	if err != nil {
+		log.WithError(err).
+			Errorf("Could not evaluate the OPA Kafka Ingest policy %s.", pol)
+		return nil, false
+	}
+	recordSkip(p.audit, pol, decision, uuid, m.Headers["X-Request-Id"])
+	if decision != nil && decision.Skip {
+		p.activity.skipped(m.Topic)
+	}
+	return decision, forward
+}
+
+// skipInvalidContentType marks the message as skipped if its content type isn't whitelisted.
+func (p *MsgProcessor) skipInvalidContentType(m kafka.FTMessage, err error) {
+	if errors.Is(err, ErrInvalidContentType) {
+		p.activity.skipped(m.Topic)
+	}
 }
 
 func (p *MsgProcessor) extractTID(headers map[string]string) string {
@@ -209,13 +433,20 @@ func (p *MsgProcessor) extractTID(headers map[string]string) string {
 	return tid
 }
 
-func containsSubstringOf(array []string, element string) bool {
-	for _, e := range array {
-		if strings.Contains(element, e) {
-			return true
-		}
+// routeToOriginTopic sends the message to the topic of the origin rule, unless the policy decision sets another one.
+func routeToOriginTopic(decision *policy.ContentPolicyResult, topic string) *policy.ContentPolicyResult {
+	if topic == "" {
+		return decision
+	}
+	if decision == nil {
+		return &policy.ContentPolicyResult{Topic: topic}
+	}
+	if decision.Topic == "" {
+		routed := *decision
+		routed.Topic = topic
+		return &routed
 	}
-	return false
+	return decision
 }
 
 func formatOPASkipReasons(r []string) string {
@@ -75,6 +75,74 @@ func TestMsgProcessor_ProcessMessages_Closes_When_Channel_Closes(t *testing.T) {
 	}
 }
 
+func TestMsgProcessor_ProcessMessages_Recovers_From_Panic(t *testing.T) {
+	m, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+	m.Topic = "PostPublicationEvents"
+
+	ch := make(chan *kafka.FTMessage, 2)
+	quarantine := &recordingProducer{}
+	log, hook := testLogger()
+
+	// The agent returns neither a result, nor an error, which makes the processing panic.
+	p := NewMsgProcessor(log, ch, MsgProcessorConfig{}, nil, nil, mockOpaAgent{}, ForwarderConfig{}, WithQuarantine(quarantine))
+
+	ch <- &m
+	ch <- &m
+	close(ch)
+	p.ProcessMessages()
+
+	require.Len(t, quarantine.messages, 2)
+	assert.Equal(t, m.Body, quarantine.messages[0].Body)
+	assert.Equal(t, "some-tid1", quarantine.messages[0].Headers["X-Request-Id"])
+	assert.Equal(t, "PostPublicationEvents", quarantine.messages[0].Headers[QuarantineSourceTopicHeader])
+	assert.Contains(t, quarantine.messages[0].Headers[QuarantineReasonHeader], "nil pointer dereference")
+
+	assert.Equal(t, "info", hook.LastEntry().Level.String())
+	assert.Equal(t, "Message sent to quarantine", hook.LastEntry().Message)
+	assert.Equal(t, "some-tid1", hook.LastEntry().Data["transaction_id"])
+	assert.NotEmpty(t, hook.LastEntry().Data["stack"])
+}
+
+func TestMsgProcessor_ProcessMessages_Drops_Panicking_Message_Without_Quarantine(t *testing.T) {
+	m, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+
+	ch := make(chan *kafka.FTMessage, 1)
+	log, hook := testLogger()
+	p := NewMsgProcessor(log, ch, MsgProcessorConfig{}, nil, nil, mockOpaAgent{}, ForwarderConfig{})
+
+	ch <- &m
+	close(ch)
+	p.ProcessMessages()
+
+	assert.Equal(t, "warning", hook.LastEntry().Level.String())
+	assert.Equal(t, "Message quarantine is not configured. The message will be dropped.", hook.LastEntry().Message)
+}
+
+func TestMsgProcessor_ProcessingLoopCheck(t *testing.T) {
+	p := &MsgProcessor{config: MsgProcessorConfig{StallTimeout: time.Minute}}
+	assert.ErrorIs(t, p.ProcessingLoopCheck(), ErrProcessingLoopNotRunning)
+
+	p.running.Store(true)
+	assert.NoError(t, p.ProcessingLoopCheck())
+
+	p.processingSince.Store(time.Now().Add(-time.Second).UnixNano())
+	assert.NoError(t, p.ProcessingLoopCheck())
+
+	p.processingSince.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	assert.ErrorIs(t, p.ProcessingLoopCheck(), ErrProcessingLoopStalled)
+
+	p.config.StallTimeout = 0
+	assert.NoError(t, p.ProcessingLoopCheck())
+}
+
 func TestProcessContentMsg_Unmarshal_Error(t *testing.T) {
 	m := kafka.FTMessage{
 		Headers: map[string]string{"X-Request-Id": "some-tid1"},
@@ -170,7 +238,7 @@ func TestProcessContentMsg_Forwarder_Errors(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -235,7 +303,7 @@ func TestProcessContentMsg_Successfully_Forwarded(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -290,7 +358,7 @@ func TestProcessContentMsg_DeleteEvent_Successfully_Forwarded(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -323,7 +391,7 @@ func TestProcessMetadataMsg_UnSupportedOrigins(t *testing.T) {
 		returnResult: &policy.ContentPolicyResult{},
 	}
 
-	p := &MsgProcessor{config: config, log: log, opaAgent: opaAgent}
+	p := &MsgProcessor{config: config, forwarder: newForwarder(nil, ForwarderConfig{}), log: log, opaAgent: opaAgent}
 
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
@@ -359,7 +427,7 @@ func TestProcessMetadataMsg_SupportedOrigin_Unmarshal_Error(t *testing.T) {
 		returnResult: &policy.ContentPolicyResult{},
 	}
 
-	p := &MsgProcessor{config: config, log: log, opaAgent: opaAgent}
+	p := &MsgProcessor{config: config, forwarder: newForwarder(nil, ForwarderConfig{}), log: log, opaAgent: opaAgent}
 
 	assert.Nil(t, hook.LastEntry())
 	assert.Equal(t, 0, len(hook.Entries))
@@ -405,6 +473,7 @@ func TestProcessMetadataMsg_Combiner_Errors(t *testing.T) {
 	}
 
 	p := &MsgProcessor{
+		forwarder:    newForwarder(nil, ForwarderConfig{}),
 		config:       config,
 		dataCombiner: dummyDataCombiner,
 		log:          log,
@@ -460,7 +529,7 @@ func TestProcessMetadataMsg_Forwarder_Errors(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -514,7 +583,7 @@ func TestProcessMetadataMsg_Forward_Skipped(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -606,7 +675,7 @@ func TestProcessMetadataMsg_Successfully_Forwarded(t *testing.T) {
 	p := &MsgProcessor{
 		config:       config,
 		dataCombiner: dummyDataCombiner,
-		forwarder:    newForwarder(dummyMsgProducer, allowedContentTypes),
+		forwarder:    newForwarder(dummyMsgProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
@@ -653,25 +722,156 @@ func TestForwardMsg(t *testing.T) {
 		require.NoError(t, json.Unmarshal([]byte(testCase.body), &model))
 
 		p := MsgProcessor{
-			forwarder: &forwarder{
-				producer: DummyProducer{
-					t:        t,
-					expTID:   testCase.headers["X-Request-Id"],
-					expUUID:  testCase.uuid,
-					expError: testCase.err,
-					expMsg: kafka.FTMessage{
-						Headers: testCase.headers,
-						Body:    testCase.body,
-					},
+			forwarder: newForwarder(DummyProducer{
+				t:        t,
+				expTID:   testCase.headers["X-Request-Id"],
+				expUUID:  testCase.uuid,
+				expError: testCase.err,
+				expMsg: kafka.FTMessage{
+					Headers: testCase.headers,
+					Body:    testCase.body,
 				},
-			},
+			}, ForwarderConfig{}),
 		}
 
-		err := p.forwarder.forwardMsg(testCase.headers, &model)
+		err := p.forwarder.forwardMsg(p.forwarder.current(), testCase.headers, &model, ContentTrigger, nil)
 		assert.Equal(t, testCase.err, err)
 	}
 }
 
+func TestForwardMsg_SchemaV2(t *testing.T) {
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{SchemaVersion: SchemaV2})
+
+	source := SourceEvent{
+		Topic:          "PostPublicationEvents",
+		TransactionID:  "some-tid1",
+		OriginSystemID: "http://cmdb.ft.com/systems/cct",
+		Timestamp:      "2017-03-30T13:09:06.480Z",
+	}
+	model := CombinedModel{
+		UUID:    "some_uuid",
+		Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+	}
+
+	err := f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ContentTrigger, nil, source)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	m := producer.messages[0]
+	assert.Equal(t, "2", m.Headers[SchemaVersionHeader])
+	assert.Equal(t, CombinerMessageType, m.Headers["Message-Type"])
+
+	var envelope CombinedModelV2
+	require.NoError(t, json.Unmarshal([]byte(m.Body), &envelope))
+	assert.Equal(t, SchemaV2, envelope.SchemaVersion)
+	assert.Equal(t, ContentTrigger, envelope.Trigger)
+	assert.Equal(t, []SourceEvent{source}, envelope.SourceEvents)
+	assert.Equal(t, model, envelope.CombinedModel)
+
+	_, err = time.Parse(eventTimestampFormat, envelope.EventTimestamp)
+	assert.NoError(t, err)
+}
+
+func TestForwardMsg_SchemaV1_Has_Version_Header(t *testing.T) {
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{})
+
+	model := CombinedModel{UUID: "some_uuid"}
+	err := f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ForcedTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	assert.Equal(t, "1", producer.messages[0].Headers[SchemaVersionHeader])
+	assert.JSONEq(
+		t,
+		`{"uuid":"some_uuid","contentUri":"","lastModified":"","deleted":false,"content":null,"internalContent":null,"metadata":null}`,
+		producer.messages[0].Body,
+	)
+}
+
+func TestForwardMsg_PolicyDecision(t *testing.T) {
+	defaultProducer := &recordingProducer{}
+	routedProducer := &recordingProducer{}
+	f := newForwarder(defaultProducer, ForwarderConfig{
+		Routes: TopicProducers{"RestrictedCombinedPostPublicationEvents": routedProducer},
+	})
+
+	model := CombinedModel{
+		UUID:            "some_uuid",
+		Content:         ContentModel{"uuid": "some_uuid", "editorialDesk": "/FT/Professional/Central Banking"},
+		InternalContent: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+		Metadata:        []Annotation{{Thing: Thing{ID: "some_id"}}},
+	}
+	decision := &policy.ContentPolicyResult{
+		Topic:   "RestrictedCombinedPostPublicationEvents",
+		Headers: map[string]string{"Restricted": "true"},
+		Redact:  []string{"content.editorialDesk", "internalContent.bodyXML", "metadata"},
+	}
+
+	err := f.forwardMsg(f.current(), map[string]string{"X-Request-Id": "some-tid1"}, &model, ContentTrigger, decision)
+	require.NoError(t, err)
+
+	assert.Empty(t, defaultProducer.messages)
+	require.Len(t, routedProducer.messages, 1)
+	assert.Equal(t, "true", routedProducer.messages[0].Headers["Restricted"])
+	assert.Equal(t, "some-tid1", routedProducer.messages[0].Headers["X-Request-Id"])
+	assert.JSONEq(
+		t,
+		`{"uuid":"some_uuid","contentUri":"","lastModified":"","deleted":false,"content":{"uuid":"some_uuid"},"internalContent":{"uuid":"some_uuid"},"metadata":null}`,
+		routedProducer.messages[0].Body,
+	)
+	assert.Equal(t, "/FT/Professional/Central Banking", model.Content["editorialDesk"], "the combined message should not be modified")
+
+	err = f.forwardMsg(f.current(), map[string]string{}, &model, ContentTrigger, &policy.ContentPolicyResult{Topic: "Unknown"})
+	assert.ErrorIs(t, err, ErrTopicNotAllowed)
+	assert.Len(t, routedProducer.messages, 1)
+	assert.Empty(t, defaultProducer.messages)
+}
+
+func TestProcessMessages_Apply_PolicyDecision(t *testing.T) {
+	content, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+	annotations, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid2", "Origin-System-Id": "http://cmdb.ft.com/systems/pac"},
+		"./testData/annotations.json",
+	)
+	require.NoError(t, err)
+
+	cm := &ContentMessage{}
+	require.NoError(t, json.Unmarshal([]byte(content.Body), cm))
+	am := &AnnotationsMessage{}
+	require.NoError(t, json.Unmarshal([]byte(annotations.Body), am))
+
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		config: MsgProcessorConfig{SupportedHeaders: []string{"http://cmdb.ft.com/systems/pac"}},
+		dataCombiner: DummyDataCombiner{
+			t:                t,
+			expectedContent:  cm.ContentModel,
+			expectedMetadata: *am,
+			data:             CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+		},
+		forwarder: newForwarder(producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}),
+		log:       log,
+		opaAgent: mockOpaAgent{
+			returnResult: &policy.ContentPolicyResult{Headers: map[string]string{"Restricted": "true"}},
+		},
+	}
+
+	p.processContentMsg(content)
+	p.processMetadataMsg(annotations)
+
+	require.Len(t, producer.messages, 2)
+	for _, m := range producer.messages {
+		assert.Equal(t, "true", m.Headers["Restricted"])
+	}
+}
+
 func TestExtractTID(t *testing.T) {
 	assertion := assert.New(t)
 
@@ -719,50 +919,6 @@ func TestExtractTIDForEmptyHeader(t *testing.T) {
 	assertion.Contains(actualTID, "_post_publication_combiner")
 }
 
-func TestSupports(t *testing.T) {
-	tests := []struct {
-		element   string
-		array     []string
-		expResult bool
-	}{
-		{
-			element:   "some value",
-			array:     []string{"some value", "some other value"},
-			expResult: true,
-		},
-		{
-			element:   "some value",
-			array:     []string{"some other value"},
-			expResult: false,
-		},
-		{
-			element:   "some value",
-			array:     []string{},
-			expResult: false,
-		},
-		{
-			element:   "",
-			array:     []string{"some value", "some other value"},
-			expResult: false,
-		},
-		{
-			element:   "",
-			array:     []string{},
-			expResult: false,
-		},
-	}
-
-	for _, testCase := range tests {
-		result := containsSubstringOf(testCase.array, testCase.element)
-		assert.Equal(
-			t,
-			testCase.expResult,
-			result,
-			fmt.Sprintf("Element %v was not found in %v", testCase.array, testCase.element),
-		)
-	}
-}
-
 type DummyProducer struct {
 	t        *testing.T
 	expUUID  string
@@ -803,6 +959,15 @@ func (p DummyProducer) SendMessage(m kafka.FTMessage) error {
 	return nil
 }
 
+type recordingProducer struct {
+	messages []kafka.FTMessage
+}
+
+func (p *recordingProducer) SendMessage(m kafka.FTMessage) error {
+	p.messages = append(p.messages, m)
+	return nil
+}
+
 type DummyDataCombiner struct {
 	t                *testing.T
 	expectedContent  ContentModel
@@ -810,6 +975,7 @@ type DummyDataCombiner struct {
 	expectedUUID     string
 	data             CombinedModel
 	err              error
+	sources          []string
 }
 
 func (c DummyDataCombiner) GetCombinedModelForContent(content ContentModel) (CombinedModel, error) {
@@ -829,6 +995,11 @@ func (c DummyDataCombiner) GetCombinedModel(uuid string) (CombinedModel, error)
 	return c.data, c.err
 }
 
+func (c DummyDataCombiner) FindSources(uuid string) ([]string, error) {
+	assert.Equal(c.t, c.expectedUUID, uuid)
+	return c.sources, c.err
+}
+
 func createMessage(headers map[string]string, fixture string) (kafka.FTMessage, error) {
 	f, err := os.Open(fixture)
 	if err != nil {
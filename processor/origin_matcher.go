@@ -0,0 +1,110 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// OriginMatchType is the way an origin rule compares the Origin-System-Id of the metadata messages with its value.
+type OriginMatchType string
+
+const (
+	OriginExact  OriginMatchType = "exact"
+	OriginPrefix OriginMatchType = "prefix"
+	// OriginRegex rules match the whole Origin-System-Id, as if the expression was enclosed in ^ and $.
+	OriginRegex OriginMatchType = "regex"
+)
+
+var ErrInvalidOriginRule = errors.New("invalid origin rule")
+
+// OriginRule selects the metadata messages of the origin systems which are processed.
+type OriginRule struct {
+	Match OriginMatchType `json:"match"`
+	Value string          `json:"value"`
+	// ContentTypes, or glob patterns of them, restrict the content types the annotations of the origin are forwarded for.
+	// All the supported content types are allowed if there are none.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// Topic is the routing topic the messages of the origin are sent to, unless the policy decision sets another one.
+	Topic string `json:"topic,omitempty"`
+
+	re           *regexp.Regexp
+	contentTypes []*regexp.Regexp
+}
+
+func (r OriginRule) matches(origin string) bool {
+	switch r.Match {
+	case OriginExact:
+		return origin == r.Value
+	case OriginPrefix:
+		return strings.HasPrefix(origin, r.Value)
+	case OriginRegex:
+		return r.re.MatchString(origin)
+	}
+	return false
+}
+
+// restrictsContentTypes reports whether the annotations of the origin are only forwarded for some content types.
+func (r OriginRule) restrictsContentTypes() bool {
+	return len(r.contentTypes) > 0
+}
+
+// allows reports whether the annotations of the origin are forwarded for the content type.
+func (r OriginRule) allows(contentType string) bool {
+	return !r.restrictsContentTypes() || matchesAny(r.contentTypes, contentType)
+}
+
+// OriginMatcher finds the rule of an Origin-System-Id. The first matching rule is used.
+type OriginMatcher struct {
+	rules []OriginRule
+}
+
+func NewOriginMatcher(rules []OriginRule) (*OriginMatcher, error) {
+	m := &OriginMatcher{rules: make([]OriginRule, 0, len(rules))}
+	for i, r := range rules {
+		if r.Value == "" {
+			return nil, fmt.Errorf("%w: rule %d has no value", ErrInvalidOriginRule, i)
+		}
+		switch r.Match {
+		case OriginExact, OriginPrefix:
+		case OriginRegex:
+			re, err := regexp.Compile("^(?:" + r.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("%w: rule %d: %w", ErrInvalidOriginRule, i, err)
+			}
+			r.re = re
+		default:
+			return nil, fmt.Errorf("%w: rule %d has unknown match type %q", ErrInvalidOriginRule, i, r.Match)
+		}
+		r.contentTypes = compileGlobs(r.ContentTypes)
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// ExactOriginMatcher matches the given Origin-System-Id values exactly, ignoring the whitespace around them.
+func ExactOriginMatcher(origins []string) *OriginMatcher {
+	m := &OriginMatcher{}
+	for _, o := range origins {
+		if o = strings.TrimSpace(o); o != "" {
+			m.rules = append(m.rules, OriginRule{Match: OriginExact, Value: o})
+		}
+	}
+	return m
+}
+
+// Match returns the first rule matching the origin.
+func (m *OriginMatcher) Match(origin string) (OriginRule, bool) {
+	for _, r := range m.rules {
+		if r.matches(origin) {
+			return r, true
+		}
+	}
+	return OriginRule{}, false
+}
+
+// Rules returns the rules in the order they are matched in.
+func (m *OriginMatcher) Rules() []OriginRule {
+	return m.rules
+}
@@ -0,0 +1,145 @@
+package processor
+
+import (
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginMatcher_Match(t *testing.T) {
+	m, err := NewOriginMatcher([]OriginRule{
+		{Match: OriginExact, Value: "http://cmdb.ft.com/systems/pac"},
+		{Match: OriginPrefix, Value: "http://cmdb.ft.com/systems/methode-", Topic: "Methode"},
+		{Match: OriginRegex, Value: `http://cmdb\.ft\.com/systems/(spark|cct)`},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		origin  string
+		matched bool
+		topic   string
+	}{
+		"exact":                      {origin: "http://cmdb.ft.com/systems/pac", matched: true},
+		"exact does not match more":  {origin: "http://cmdb.ft.com/systems/pac-test"},
+		"exact does not match less":  {origin: "http://cmdb.ft.com/systems/pa"},
+		"prefix":                     {origin: "http://cmdb.ft.com/systems/methode-web-pub", matched: true, topic: "Methode"},
+		"regex":                      {origin: "http://cmdb.ft.com/systems/cct", matched: true},
+		"regex matches the whole id": {origin: "http://cmdb.ft.com/systems/spark-test"},
+		"empty":                      {origin: ""},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, ok := m.Match(test.origin)
+			assert.Equal(t, test.matched, ok)
+			assert.Equal(t, test.topic, rule.Topic)
+		})
+	}
+}
+
+func TestNewOriginMatcher_InvalidRules(t *testing.T) {
+	for name, rule := range map[string]OriginRule{
+		"no value":     {Match: OriginExact},
+		"unknown type": {Match: "substring", Value: "pac"},
+		"bad regex":    {Match: OriginRegex, Value: "(pac"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewOriginMatcher([]OriginRule{rule})
+			assert.ErrorIs(t, err, ErrInvalidOriginRule)
+		})
+	}
+}
+
+func TestExactOriginMatcher_TrimsWhitespace(t *testing.T) {
+	m := ExactOriginMatcher([]string{"http://cmdb.ft.com/systems/pac", " http://cmdb.ft.com/systems/next-video-editor", ""})
+
+	_, ok := m.Match("http://cmdb.ft.com/systems/next-video-editor")
+	assert.True(t, ok)
+	_, ok = m.Match("")
+	assert.False(t, ok)
+	assert.Len(t, m.Rules(), 2)
+}
+
+func TestProcessMetadataMsg_OriginRules(t *testing.T) {
+	annotations := AnnotationsMessage{Annotations: &AnnotationsModel{UUID: "0cef259d-030d-497d-b4ef-e8fa0ee6db6b"}}
+	origins, err := NewOriginMatcher([]OriginRule{
+		{Match: OriginExact, Value: "http://cmdb.ft.com/systems/pac", ContentTypes: []string{"Article"}},
+		{Match: OriginPrefix, Value: "http://cmdb.ft.com/systems/next-video-", Topic: "Videos"},
+	})
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		origin      string
+		contentType string
+		decision    *policy.ContentPolicyResult
+		expDefault  int
+		expRouted   int
+		expSkipped  int64
+	}{
+		"allowed content type": {
+			origin:      "http://cmdb.ft.com/systems/pac",
+			contentType: "Article",
+			expDefault:  1,
+		},
+		"content type not allowed for the origin": {
+			origin:      "http://cmdb.ft.com/systems/pac",
+			contentType: "Video",
+		},
+		"unmatched origin": {
+			origin:      "http://cmdb.ft.com/systems/pac-test",
+			contentType: "Article",
+			expSkipped:  1,
+		},
+		"origin topic": {
+			origin:      "http://cmdb.ft.com/systems/next-video-editor",
+			contentType: "Video",
+			expRouted:   1,
+		},
+		"the policy topic takes precedence": {
+			origin:      "http://cmdb.ft.com/systems/next-video-editor",
+			contentType: "Video",
+			decision:    &policy.ContentPolicyResult{Topic: "Articles"},
+			expDefault:  1,
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			decision := test.decision
+			if decision == nil {
+				decision = &policy.ContentPolicyResult{}
+			}
+			producer := &recordingProducer{}
+			routed := &recordingProducer{}
+			log, _ := testLogger()
+			p := &MsgProcessor{
+				dataCombiner: DummyDataCombiner{
+					t:                t,
+					expectedMetadata: annotations,
+					data: CombinedModel{
+						UUID:    "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+						Content: ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "type": test.contentType},
+					},
+				},
+				forwarder: newForwarder(producer, ForwarderConfig{Settings: NewSettingsStore(Settings{
+					Origins:      origins,
+					ContentTypes: NewContentTypeFilter([]string{"Article", "Video"}, ContentTypeConfig{}),
+					Routes:       TopicProducers{"Videos": routed, "Articles": producer},
+				})}),
+				opaAgent: mockOpaAgent{returnResult: decision},
+				log:      log,
+			}
+
+			skipped := unmatchedOriginsCounter.Count()
+			p.processMetadataMsg(kafka.FTMessage{
+				Headers: map[string]string{"X-Request-Id": "tid_origin_rules", "Origin-System-Id": test.origin},
+				Body:    `{"payload":{"uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","annotations":null}}`,
+			})
+
+			assert.Len(t, producer.messages, test.expDefault)
+			assert.Len(t, routed.messages, test.expRouted)
+			assert.Equal(t, test.expSkipped, unmatchedOriginsCounter.Count()-skipped)
+		})
+	}
+}
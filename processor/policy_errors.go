@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"fmt"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/rcrowley/go-metrics"
+)
+
+const (
+	PolicyWarningHeader   = "Policy-Evaluation-Warning"
+	HoldReasonHeader      = "Hold-Reason"
+	HoldSourceTopicHeader = "Hold-Source-Topic"
+)
+
+// PolicyErrorMode decides what happens to a message when its policy can't be evaluated.
+type PolicyErrorMode string
+
+const (
+	// PolicyErrorSkip drops the message, or fails the force request.
+	PolicyErrorSkip PolicyErrorMode = "skip"
+	// PolicyErrorAllow forwards the message with the Policy-Evaluation-Warning header.
+	PolicyErrorAllow PolicyErrorMode = "allow"
+	// PolicyErrorHold sends the message to a holding topic, from which it can be replayed once the policy agent recovers.
+	PolicyErrorHold PolicyErrorMode = "hold"
+)
+
+func ParsePolicyErrorMode(s string) (PolicyErrorMode, error) {
+	switch m := PolicyErrorMode(s); m {
+	case PolicyErrorSkip, PolicyErrorAllow, PolicyErrorHold:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown policy error mode %q", s)
+}
+
+type PolicyErrorConfig struct {
+	// Modes per policy. Policies without a mode use PolicyErrorSkip.
+	Modes map[policy.Policy]PolicyErrorMode
+	// Hold receives the messages of the policies in PolicyErrorHold mode.
+	Hold messageProducer
+}
+
+func (c PolicyErrorConfig) Validate() error {
+	for p, m := range c.Modes {
+		if m == PolicyErrorHold && c.Hold == nil {
+			return fmt.Errorf("policy %s is in %s mode, but there is no holding topic", p, m)
+		}
+	}
+	return nil
+}
+
+func (c PolicyErrorConfig) mode(p policy.Policy) PolicyErrorMode {
+	if m, ok := c.Modes[p]; ok {
+		return m
+	}
+	return PolicyErrorSkip
+}
+
+// evaluatePolicy reports whether the message should be forwarded according to the policy,
+// together with the decision of the policy, which is nil if it couldn't be evaluated.
+// Evaluation errors are handled according to the mode of the policy, and are only returned
+// if the message can't be forwarded nor held.
+func evaluatePolicy(
+	agent policy.Agent,
+	config PolicyErrorConfig,
+	q map[string]interface{},
+	p policy.Policy,
+	m kafka.FTMessage,
+	log *logger.LogEntry,
+) (bool, *policy.ContentPolicyResult, error) {
+	result, err := agent.EvaluateKafkaIngestPolicy(q, p)
+	if err == nil {
+		if result.Skip {
+			log.WithField("decision_id", result.DecisionID).Error(formatOPASkipReasons(result.Reasons))
+			return false, result, nil
+		}
+		warnUnappliedRedactions(result, log)
+		return true, result, nil
+	}
+
+	mode := config.mode(p)
+	switch mode {
+	case PolicyErrorAllow:
+		countPolicyError(p, string(mode))
+		log.WithError(err).Warnf("Could not evaluate the %s policy. The message will be forwarded with a warning.", p)
+		m.Headers[PolicyWarningHeader] = fmt.Sprintf("%s policy was not evaluated", p)
+		return true, nil, nil
+	case PolicyErrorHold:
+		holdErr := config.Hold.SendMessage(annotatedCopy(m, map[string]string{
+			HoldReasonHeader:      err.Error(),
+			HoldSourceTopicHeader: m.Topic,
+		}))
+		if holdErr != nil {
+			// The message is dropped, so it isn't counted as held.
+			countPolicyError(p, holdFailed)
+			log.WithError(holdErr).Error("Failed to send message to the holding topic")
+			return false, nil, err
+		}
+		countPolicyError(p, string(mode))
+		log.WithError(err).Warnf("Could not evaluate the %s policy. The message was sent to the holding topic.", p)
+		return false, nil, nil
+	}
+
+	countPolicyError(p, string(mode))
+	return false, nil, err
+}
+
+// holdFailed counts the messages which couldn't be sent to the holding topic, and were dropped.
+const holdFailed = "hold_failed"
+
+func countPolicyError(p policy.Policy, outcome string) {
+	metrics.GetOrRegisterCounter(fmt.Sprintf("policy.%s.errors.%s", p, outcome), metrics.DefaultRegistry).Inc(1)
+}
@@ -0,0 +1,203 @@
+package processor
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/rcrowley/go-metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicyErrorMode(t *testing.T) {
+	for _, s := range []string{"skip", "allow", "hold"} {
+		mode, err := ParsePolicyErrorMode(s)
+		require.NoError(t, err)
+		assert.Equal(t, PolicyErrorMode(s), mode)
+	}
+
+	_, err := ParsePolicyErrorMode("ignore")
+	assert.Error(t, err)
+}
+
+func TestPolicyErrorConfigValidate(t *testing.T) {
+	config := PolicyErrorConfig{
+		Modes: map[policy.Policy]PolicyErrorMode{policy.KafkaIngestContent: PolicyErrorHold},
+	}
+	assert.Error(t, config.Validate())
+
+	config.Hold = &recordingProducer{}
+	assert.NoError(t, config.Validate())
+}
+
+func TestEvaluatePolicy(t *testing.T) {
+	evaluationErr := errors.New("connection refused")
+
+	tests := []struct {
+		name            string
+		agent           mockOpaAgent
+		mode            PolicyErrorMode
+		hold            messageProducer
+		expectedForward bool
+		expectedErr     error
+		expectedHeader  string
+		expectedHeld    int
+		counter         string
+		uncounted       string
+	}{
+		{
+			name:            "forward",
+			agent:           mockOpaAgent{returnResult: &policy.ContentPolicyResult{}},
+			expectedForward: true,
+		},
+		{
+			name:  "skip decision",
+			agent: mockOpaAgent{returnResult: &policy.ContentPolicyResult{Skip: true, Reasons: []string{"reason"}}},
+		},
+		{
+			name:        "error without a mode",
+			agent:       mockOpaAgent{returnError: evaluationErr},
+			expectedErr: evaluationErr,
+			counter:     "policy.kafka_ingest_content.errors.skip",
+		},
+		{
+			name:        "error in skip mode",
+			agent:       mockOpaAgent{returnError: evaluationErr},
+			mode:        PolicyErrorSkip,
+			expectedErr: evaluationErr,
+			counter:     "policy.kafka_ingest_content.errors.skip",
+		},
+		{
+			name:            "error in allow mode",
+			agent:           mockOpaAgent{returnError: evaluationErr},
+			mode:            PolicyErrorAllow,
+			expectedForward: true,
+			expectedHeader:  "kafka_ingest_content policy was not evaluated",
+			counter:         "policy.kafka_ingest_content.errors.allow",
+		},
+		{
+			name:         "error in hold mode",
+			agent:        mockOpaAgent{returnError: evaluationErr},
+			mode:         PolicyErrorHold,
+			hold:         &recordingProducer{},
+			expectedHeld: 1,
+			counter:      "policy.kafka_ingest_content.errors.hold",
+		},
+		{
+			name:        "error in hold mode with a failing holding topic",
+			agent:       mockOpaAgent{returnError: evaluationErr},
+			mode:        PolicyErrorHold,
+			hold:        DummyProducer{expError: errors.New("producer error")},
+			expectedErr: evaluationErr,
+			counter:     "policy.kafka_ingest_content.errors.hold_failed",
+			uncounted:   "policy.kafka_ingest_content.errors.hold",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			log, _ := testLogger()
+			config := PolicyErrorConfig{Hold: test.hold}
+			if test.mode != "" {
+				config.Modes = map[policy.Policy]PolicyErrorMode{policy.KafkaIngestContent: test.mode}
+			}
+			m := kafka.FTMessage{
+				Headers: map[string]string{"X-Request-Id": "some-tid"},
+				Body:    `{"uuid":"some_uuid"}`,
+				Topic:   "PostPublicationEvents",
+			}
+
+			var before, uncountedBefore int64
+			if test.counter != "" {
+				before = metrics.GetOrRegisterCounter(test.counter, metrics.DefaultRegistry).Count()
+			}
+			if test.uncounted != "" {
+				uncountedBefore = metrics.GetOrRegisterCounter(test.uncounted, metrics.DefaultRegistry).Count()
+			}
+
+			forward, _, err := evaluatePolicy(test.agent, config, map[string]interface{}{}, policy.KafkaIngestContent, m, log.WithTransactionID("some-tid"))
+
+			assert.Equal(t, test.expectedForward, forward)
+			assert.ErrorIs(t, err, test.expectedErr)
+			assert.Equal(t, test.expectedHeader, m.Headers[PolicyWarningHeader])
+			if test.counter != "" {
+				assert.Equal(t, before+1, metrics.GetOrRegisterCounter(test.counter, metrics.DefaultRegistry).Count())
+			}
+			if test.uncounted != "" {
+				assert.Equal(t, uncountedBefore, metrics.GetOrRegisterCounter(test.uncounted, metrics.DefaultRegistry).Count())
+			}
+
+			if recorder, ok := test.hold.(*recordingProducer); ok {
+				require.Len(t, recorder.messages, test.expectedHeld)
+				held := recorder.messages[0]
+				assert.Equal(t, m.Body, held.Body)
+				assert.Equal(t, "connection refused", held.Headers[HoldReasonHeader])
+				assert.Equal(t, "PostPublicationEvents", held.Headers[HoldSourceTopicHeader])
+				assert.Equal(t, "some-tid", held.Headers["X-Request-Id"])
+			}
+		})
+	}
+}
+
+func TestForcePublication_PolicyError_Hold(t *testing.T) {
+	hold := &recordingProducer{}
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	dataCombiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: "some_uuid",
+		data: CombinedModel{
+			UUID:    "some_uuid",
+			Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+		},
+	}
+
+	p := NewRequestProcessor(
+		dataCombiner,
+		producer,
+		ForwarderConfig{SupportedContentTypes: []string{"Article"}},
+		log,
+		mockOpaAgent{returnError: errors.New("timeout")},
+		WithRequestPolicyErrors(PolicyErrorConfig{
+			Modes: map[policy.Policy]PolicyErrorMode{policy.KafkaIngestForce: PolicyErrorHold},
+			Hold:  hold,
+		}),
+	)
+
+	assert.ErrorIs(t, p.ForcePublication("some_uuid", "some-tid"), ErrHeld)
+	assert.Empty(t, producer.messages)
+	require.Len(t, hold.messages, 1)
+	assert.JSONEq(t, `{"uuid":"some_uuid"}`, hold.messages[0].Body)
+	assert.Equal(t, CombinerOrigin, hold.messages[0].Headers["Origin-System-Id"])
+	assert.Equal(t, ForceRequestSource, hold.messages[0].Headers[HoldSourceTopicHeader])
+}
+
+func TestForcePublication_PolicyError_Allow(t *testing.T) {
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	dataCombiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: "some_uuid",
+		data: CombinedModel{
+			UUID:    "some_uuid",
+			Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+		},
+	}
+
+	p := NewRequestProcessor(
+		dataCombiner,
+		producer,
+		ForwarderConfig{SupportedContentTypes: []string{"Article"}},
+		log,
+		mockOpaAgent{returnError: errors.New("timeout")},
+		WithRequestPolicyErrors(PolicyErrorConfig{
+			Modes: map[policy.Policy]PolicyErrorMode{policy.KafkaIngestForce: PolicyErrorAllow},
+		}),
+	)
+
+	require.NoError(t, p.ForcePublication("some_uuid", "some-tid"))
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "kafka_ingest_force policy was not evaluated", producer.messages[0].Headers[PolicyWarningHeader])
+}
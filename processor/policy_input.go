@@ -0,0 +1,57 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PolicyInputMode decides what the policies are evaluated against.
+type PolicyInputMode string
+
+const (
+	// PolicyInputEvent evaluates the content policy against the body of the content event,
+	// and the metadata and force policies against the combined content.
+	PolicyInputEvent PolicyInputMode = "event"
+	// PolicyInputCombined evaluates all the policies against the whole combined message
+	// (content, internal content and annotations), together with the headers of the event which triggered it.
+	PolicyInputCombined PolicyInputMode = "combined"
+)
+
+func ParsePolicyInputMode(s string) (PolicyInputMode, error) {
+	switch m := PolicyInputMode(s); m {
+	case PolicyInputEvent, PolicyInputCombined:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown policy input mode %q", s)
+}
+
+// eventPolicyInput builds the input of the content policy in PolicyInputEvent mode: the body of the content event.
+func eventPolicyInput(body string) (map[string]interface{}, error) {
+	var q map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// combinedPolicyInput builds the input of the policies in PolicyInputCombined mode:
+// the combined message as it is forwarded, with the event headers under "headers".
+func combinedPolicyInput(message *CombinedModel, headers map[string]string) (map[string]interface{}, error) {
+	b, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var q map[string]interface{}
+	if err = json.Unmarshal(b, &q); err != nil {
+		return nil, err
+	}
+
+	h := make(map[string]interface{}, len(headers))
+	for k, v := range headers {
+		h[k] = v
+	}
+	q["headers"] = h
+
+	return q, nil
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingOpaAgent struct {
+	queries  []map[string]interface{}
+	policies []policy.Policy
+	result   *policy.ContentPolicyResult
+}
+
+func (a *recordingOpaAgent) EvaluateKafkaIngestPolicy(q map[string]interface{}, p policy.Policy) (*policy.ContentPolicyResult, error) {
+	a.queries = append(a.queries, q)
+	a.policies = append(a.policies, p)
+	return a.result, nil
+}
+
+func TestParsePolicyInputMode(t *testing.T) {
+	for _, s := range []string{"event", "combined"} {
+		mode, err := ParsePolicyInputMode(s)
+		require.NoError(t, err)
+		assert.Equal(t, PolicyInputMode(s), mode)
+	}
+
+	_, err := ParsePolicyInputMode("raw")
+	assert.Error(t, err)
+}
+
+func TestCombinedPolicyInput(t *testing.T) {
+	message := &CombinedModel{
+		UUID:            "some_uuid",
+		ContentURI:      "http://upp-content-validator.svc.ft.com/content/some_uuid",
+		LastModified:    "2017-03-30T13:09:06.48Z",
+		Content:         ContentModel{"uuid": "some_uuid", "type": "Article"},
+		InternalContent: ContentModel{"uuid": "some_uuid", "editorialDesk": "/FT/Pink"},
+		Metadata: []Annotation{
+			{Thing: Thing{ID: "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995", Predicate: "http://base-url/about"}},
+		},
+	}
+
+	q, err := combinedPolicyInput(message, map[string]string{"X-Request-Id": "some-tid", "Origin-System-Id": "origin"})
+	require.NoError(t, err)
+
+	b, err := json.Marshal(q)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"uuid": "some_uuid",
+		"contentUri": "http://upp-content-validator.svc.ft.com/content/some_uuid",
+		"lastModified": "2017-03-30T13:09:06.48Z",
+		"deleted": false,
+		"content": {"uuid": "some_uuid", "type": "Article"},
+		"internalContent": {"uuid": "some_uuid", "editorialDesk": "/FT/Pink"},
+		"metadata": [{"thing": {"id": "http://base-url/80bec524-8c75-4d0f-92fa-abce3962d995", "predicate": "http://base-url/about"}}],
+		"headers": {"X-Request-Id": "some-tid", "Origin-System-Id": "origin"}
+	}`, string(b))
+}
+
+func TestProcessMessages_CombinedPolicyInput(t *testing.T) {
+	content, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+	annotations, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid2", "Origin-System-Id": "http://cmdb.ft.com/systems/pac"},
+		"./testData/annotations.json",
+	)
+	require.NoError(t, err)
+
+	cm := &ContentMessage{}
+	require.NoError(t, json.Unmarshal([]byte(content.Body), cm))
+	am := &AnnotationsMessage{}
+	require.NoError(t, json.Unmarshal([]byte(annotations.Body), am))
+
+	combined := CombinedModel{
+		UUID:            "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+		Content:         ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "type": "Article"},
+		InternalContent: ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "editorialDesk": "/FT/Pink"},
+	}
+
+	agent := &recordingOpaAgent{result: &policy.ContentPolicyResult{}}
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		config: MsgProcessorConfig{SupportedHeaders: []string{"http://cmdb.ft.com/systems/pac"}},
+		dataCombiner: DummyDataCombiner{
+			t:                t,
+			expectedContent:  cm.ContentModel,
+			expectedMetadata: *am,
+			data:             combined,
+		},
+		forwarder:   newForwarder(producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}),
+		log:         log,
+		opaAgent:    agent,
+		policyInput: PolicyInputCombined,
+	}
+
+	p.processContentMsg(content)
+	p.processMetadataMsg(annotations)
+
+	require.Len(t, agent.queries, 2)
+	assert.Equal(t, []policy.Policy{policy.KafkaIngestContent, policy.KafkaIngestMetadata}, agent.policies)
+	for i, q := range agent.queries {
+		assert.Equal(t, map[string]interface{}{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "editorialDesk": "/FT/Pink"}, q["internalContent"])
+		assert.Equal(t, "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", q["uuid"])
+		assert.Equal(t, []string{"some-tid1", "some-tid2"}[i], q["headers"].(map[string]interface{})["X-Request-Id"])
+	}
+	assert.Equal(t, cm.ContentURI, agent.queries[0]["contentUri"])
+	assert.Len(t, producer.messages, 2)
+}
+
+func TestProcessContentMsg_CombinedPolicyInput_Skip(t *testing.T) {
+	m, err := createMessage(
+		map[string]string{"X-Request-Id": "some-tid1"},
+		"./testData/content.json",
+	)
+	require.NoError(t, err)
+
+	cm := &ContentMessage{}
+	require.NoError(t, json.Unmarshal([]byte(m.Body), cm))
+
+	agent := &recordingOpaAgent{result: &policy.ContentPolicyResult{Skip: true, Reasons: []string{"reason"}}}
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		dataCombiner: DummyDataCombiner{
+			t:               t,
+			expectedContent: cm.ContentModel,
+			data:            CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "Article"}},
+		},
+		forwarder:   newForwarder(producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}),
+		log:         log,
+		opaAgent:    agent,
+		policyInput: PolicyInputCombined,
+	}
+
+	p.processContentMsg(m)
+
+	assert.Len(t, agent.queries, 1)
+	assert.Empty(t, producer.messages)
+}
+
+func TestForcePublication_CombinedPolicyInput(t *testing.T) {
+	agent := &recordingOpaAgent{result: &policy.ContentPolicyResult{}}
+	log, _ := testLogger()
+	p := NewRequestProcessor(
+		DummyDataCombiner{
+			t:            t,
+			expectedUUID: "some_uuid",
+			data: CombinedModel{
+				UUID:            "some_uuid",
+				Content:         ContentModel{"uuid": "some_uuid", "type": "Article"},
+				InternalContent: ContentModel{"uuid": "some_uuid"},
+			},
+		},
+		&recordingProducer{},
+		ForwarderConfig{SupportedContentTypes: []string{"Article"}},
+		log,
+		agent,
+		WithRequestPolicyInput(PolicyInputCombined),
+	)
+
+	require.NoError(t, p.ForcePublication("some_uuid", "some-tid"))
+	require.Len(t, agent.queries, 1)
+	assert.Equal(t, map[string]interface{}{"uuid": "some_uuid"}, agent.queries[0]["internalContent"])
+	assert.Equal(t, CombinerOrigin, agent.queries[0]["headers"].(map[string]interface{})["Origin-System-Id"])
+}
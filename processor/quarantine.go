@@ -0,0 +1,35 @@
+package processor
+
+import (
+	"github.com/Financial-Times/kafka-client-go/v4"
+)
+
+const (
+	QuarantineReasonHeader      = "Quarantine-Reason"
+	QuarantineSourceTopicHeader = "Quarantine-Source-Topic"
+)
+
+// sendToQuarantine forwards the original message unchanged, only annotating its headers
+// with the reason for the quarantine and the topic the message was consumed from.
+func sendToQuarantine(producer messageProducer, m kafka.FTMessage, reason string) error {
+	return producer.SendMessage(annotatedCopy(m, map[string]string{
+		QuarantineReasonHeader:      reason,
+		QuarantineSourceTopicHeader: m.Topic,
+	}))
+}
+
+// annotatedCopy returns a copy of the message with the given headers added, leaving the original headers untouched.
+func annotatedCopy(m kafka.FTMessage, annotations map[string]string) kafka.FTMessage {
+	headers := make(map[string]string, len(m.Headers)+len(annotations))
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	for k, v := range annotations {
+		headers[k] = v
+	}
+
+	return kafka.FTMessage{
+		Headers: headers,
+		Body:    m.Body,
+	}
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+)
+
+var ErrNoRecordedContent = errors.New("no content recorded for the annotations")
+
+// RecordedEvent is the body of a content or annotations event, recorded in the format of the files in processor/testData.
+type RecordedEvent struct {
+	Name string
+	Body string
+}
+
+// PolicyCase is a policy evaluation of a recorded event, with the same input the processors would build for it.
+type PolicyCase struct {
+	Event  string
+	UUID   string
+	Policy policy.Policy
+	Input  map[string]interface{}
+}
+
+// LoadRecordedEvents reads the JSON files of the directory, sorted by name.
+func LoadRecordedEvents(dir string) ([]RecordedEvent, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	events := make([]RecordedEvent, 0, len(files))
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, RecordedEvent{Name: filepath.Base(f), Body: string(b)})
+	}
+
+	return events, nil
+}
+
+// BuildPolicyCases builds the policy inputs of the recorded events, in the order of the events.
+// Content events are evaluated against the content policy.
+// As the document store can't be read offline, annotations events are evaluated against the metadata policy
+// with the last content event recorded for the same uuid.
+// The recorded events have no headers, so the combined inputs have empty ones.
+// The events which can't be turned into a policy input are returned with the reason, by name.
+func BuildPolicyCases(events []RecordedEvent, mode PolicyInputMode) ([]PolicyCase, map[string]error) {
+	failed := map[string]error{}
+	contents := map[string]*ContentMessage{}
+	parsed := make([]recordedEvent, 0, len(events))
+	for _, e := range events {
+		r, err := parseRecordedEvent(e)
+		if err != nil {
+			failed[e.Name] = err
+			continue
+		}
+		if r.content != nil {
+			contents[r.content.ContentModel.getUUID()] = r.content
+		}
+		parsed = append(parsed, r)
+	}
+
+	var cases []PolicyCase
+	for _, r := range parsed {
+		c, err := r.policyCase(contents, mode)
+		if err != nil {
+			failed[r.name] = err
+			continue
+		}
+		cases = append(cases, c)
+	}
+
+	return cases, failed
+}
+
+// recordedEvent holds either the content or the annotations of a recorded event.
+type recordedEvent struct {
+	name        string
+	body        string
+	content     *ContentMessage
+	annotations *AnnotationsMessage
+}
+
+func parseRecordedEvent(e RecordedEvent) (recordedEvent, error) {
+	r := recordedEvent{name: e.Name, body: e.Body}
+
+	var cm ContentMessage
+	if err := json.Unmarshal([]byte(e.Body), &cm); err != nil {
+		return r, err
+	}
+	if _, ok := cm.ContentModel["annotations"]; !ok {
+		r.content = &cm
+		return r, nil
+	}
+
+	var ann AnnotationsMessage
+	if err := json.Unmarshal([]byte(e.Body), &ann); err != nil {
+		return r, err
+	}
+	r.annotations = &ann
+	return r, nil
+}
+
+func (r recordedEvent) policyCase(contents map[string]*ContentMessage, mode PolicyInputMode) (PolicyCase, error) {
+	if r.content != nil {
+		c := PolicyCase{Event: r.name, UUID: r.content.ContentModel.getUUID(), Policy: policy.KafkaIngestContent}
+		var err error
+		if mode == PolicyInputCombined {
+			c.Input, err = combinedPolicyInput(recordedCombinedModel(r.content), map[string]string{})
+		} else {
+			c.Input, err = eventPolicyInput(r.body)
+		}
+		return c, err
+	}
+
+	uuid := r.annotations.getContentUUID()
+	cm, ok := contents[uuid]
+	if !ok {
+		return PolicyCase{}, fmt.Errorf("%w: %s", ErrNoRecordedContent, uuid)
+	}
+
+	c := PolicyCase{Event: r.name, UUID: uuid, Policy: policy.KafkaIngestMetadata}
+	combinedMSG := recordedCombinedModel(cm)
+	if mode != PolicyInputCombined {
+		c.Input = combinedMSG.Content
+		return c, nil
+	}
+
+	combinedMSG.Metadata = r.annotations.Annotations.Annotations
+	var err error
+	c.Input, err = combinedPolicyInput(combinedMSG, map[string]string{})
+	return c, err
+}
+
+// recordedCombinedModel is the combined message built for a recorded content event, without internal content and annotations.
+func recordedCombinedModel(cm *ContentMessage) *CombinedModel {
+	return &CombinedModel{
+		UUID:         cm.ContentModel.getUUID(),
+		Content:      cm.ContentModel,
+		ContentURI:   cm.ContentURI,
+		LastModified: cm.LastModified,
+		Deleted:      cm.ContentModel.isDeleted(),
+	}
+}
@@ -0,0 +1,76 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRecordedEvents(t *testing.T) {
+	events, err := LoadRecordedEvents("testData")
+	require.NoError(t, err)
+
+	require.Len(t, events, 7)
+	assert.Equal(t, "annotations.json", events[0].Name)
+	assert.Equal(t, "content.json", events[6].Name)
+	assert.Equal(t, readTestFile(t, "testData/content.json"), events[6].Body)
+}
+
+func TestBuildPolicyCases_EventInput(t *testing.T) {
+	content := readTestFile(t, "testData/content-with-centralBanking-editorialDesk.json")
+	events := []RecordedEvent{
+		{Name: "content.json", Body: content},
+		{Name: "annotations.json", Body: readTestFile(t, "testData/annotations.json")},
+		{Name: "invalid.json", Body: "{"},
+		{Name: "other-annotations.json", Body: `{"payload": {"uuid": "other-uuid", "annotations": []}}`},
+	}
+
+	cases, failed := BuildPolicyCases(events, PolicyInputEvent)
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(content), &body))
+	expected := []PolicyCase{
+		{Event: "content.json", UUID: "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", Policy: policy.KafkaIngestContent, Input: body},
+		{Event: "annotations.json", UUID: "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", Policy: policy.KafkaIngestMetadata, Input: body["payload"].(map[string]interface{})},
+	}
+	assert.Equal(t, expected, cases)
+
+	require.Len(t, failed, 2)
+	assert.Error(t, failed["invalid.json"])
+	assert.ErrorIs(t, failed["other-annotations.json"], ErrNoRecordedContent)
+}
+
+func TestBuildPolicyCases_CombinedInput(t *testing.T) {
+	events := []RecordedEvent{
+		{Name: "content.json", Body: readTestFile(t, "testData/content-with-centralBanking-editorialDesk.json")},
+		{Name: "annotations.json", Body: readTestFile(t, "testData/annotations.json")},
+	}
+
+	cases, failed := BuildPolicyCases(events, PolicyInputCombined)
+	require.Empty(t, failed)
+	require.Len(t, cases, 2)
+
+	content := cases[0].Input
+	assert.Equal(t, policy.KafkaIngestContent, cases[0].Policy)
+	assert.Equal(t, "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", content["uuid"])
+	assert.Equal(t, "/FT/Professional/Central Banking", content["content"].(map[string]interface{})["editorialDesk"])
+	assert.Equal(t, map[string]interface{}{}, content["headers"])
+	assert.Nil(t, content["metadata"])
+
+	metadata := cases[1].Input
+	assert.Equal(t, policy.KafkaIngestMetadata, cases[1].Policy)
+	assert.Equal(t, content["content"], metadata["content"])
+	assert.Len(t, metadata["metadata"], 1)
+}
+
+func readTestFile(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(b)
+}
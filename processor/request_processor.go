@@ -1,34 +1,128 @@
 package processor
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
 	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 )
 
 const (
 	CombinerOrigin = "forced-combined-msg"
 	ContentType    = "application/json"
+	ForcedByHeader = "X-Forced-By"
+	// ForceRequestSource is the Hold-Source-Topic of the held force requests, which have no source topic.
+	// They are replayed by forcing the publication of their UUID again.
+	ForceRequestSource = "force-request"
 )
 
+var (
+	ErrContentExists = errors.New("content exists")
+	// ErrHeld is returned when the force policy couldn't be evaluated and the request was sent to the holding topic instead.
+	ErrHeld = errors.New("held until the policy can be evaluated")
+)
+
+// PolicySkipError is returned when a policy decides that the message shouldn't be published.
+type PolicySkipError struct {
+	Policy     policy.Policy
+	Reasons    []string
+	DecisionID string
+}
+
+func (e *PolicySkipError) Error() string {
+	return fmt.Sprintf("skipped by the %s policy: %s", e.Policy, strings.Join(e.Reasons, ", "))
+}
+
 type RequestProcessor struct {
 	dataCombiner dataCombiner
 	forwarder    *forwarder
 	log          *logger.UPPLogger
 	opaAgent     policy.Agent
+	policyErrors PolicyErrorConfig
+	policyInput  PolicyInputMode
+	audit        auditRecorder
+	// liveForwarder sends the messages forced to the live topic. Forcing to it is refused if nil.
+	liveForwarder *forwarder
+}
+
+type RequestProcessorOption func(*RequestProcessor)
+
+// WithRequestPolicyErrors sets how the force requests are handled when their policies can't be evaluated.
+func WithRequestPolicyErrors(config PolicyErrorConfig) RequestProcessorOption {
+	return func(p *RequestProcessor) {
+		p.policyErrors = config
+	}
+}
+
+// WithRequestPolicyInput sets what the force policy is evaluated against.
+func WithRequestPolicyInput(mode PolicyInputMode) RequestProcessorOption {
+	return func(p *RequestProcessor) {
+		p.policyInput = mode
+	}
+}
+
+// WithRequestAudit makes the processor record the skip decisions of the force policy.
+func WithRequestAudit(recorder auditRecorder) RequestProcessorOption {
+	return func(p *RequestProcessor) {
+		p.audit = recorder
+	}
 }
 
-func NewRequestProcessor(dataCombiner dataCombiner, producer messageProducer, allowedContentTypes []string, log *logger.UPPLogger, opaAgent policy.Agent) *RequestProcessor {
-	return &RequestProcessor{
+// WithLiveForwarding allows the force requests to send the messages to the combined topic the published content goes to.
+func WithLiveForwarding(producer messageProducer, config ForwarderConfig) RequestProcessorOption {
+	return func(p *RequestProcessor) {
+		p.liveForwarder = newForwarder(producer, config)
+	}
+}
+
+func NewRequestProcessor(
+	dataCombiner dataCombiner,
+	producer messageProducer,
+	forwarderConfig ForwarderConfig,
+	log *logger.UPPLogger,
+	opaAgent policy.Agent,
+	opts ...RequestProcessorOption,
+) *RequestProcessor {
+	p := &RequestProcessor{
 		dataCombiner: dataCombiner,
-		forwarder:    newForwarder(producer, allowedContentTypes),
+		forwarder:    newForwarder(producer, forwarderConfig),
 		log:          log,
 		opaAgent:     opaAgent,
 	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+func (p *RequestProcessor) forwarderFor(topic ForceTopic) (*forwarder, error) {
+	if topic != LiveTopic {
+		return p.forwarder, nil
+	}
+	if p.liveForwarder == nil {
+		return nil, ErrLiveTopicNotAvailable
+	}
+	return p.liveForwarder, nil
 }
 
-func (p *RequestProcessor) ForcePublication(uuid string, tid string) error {
+func (p *RequestProcessor) ForcePublication(uuid string, tid string, opts ...ForceOption) error {
+	var r forceRequest
+	for _, opt := range opts {
+		opt(&r)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	forwarder, err := p.forwarderFor(r.topic)
+	if err != nil {
+		return err
+	}
+	settings := forwarder.current()
+
 	h := map[string]string{
 		"X-Request-Id":     tid,
 		"Content-Type":     ContentType,
@@ -38,6 +132,15 @@ func (p *RequestProcessor) ForcePublication(uuid string, tid string) error {
 	log := p.log.
 		WithTransactionID(tid).
 		WithField("processor", "RequestProcessor")
+	if r.forcedBy != "" {
+		log = log.WithField("forcedBy", r.forcedBy)
+	}
+	if o := r.overrides(); o != nil {
+		log = log.WithField("overrides", o)
+	}
+	r.apply(h)
+	// The overrides are recorded whatever the policy decides, so that the denied attempts are in the audit trail too.
+	r.record(p.audit, uuid, tid)
 
 	message, err := p.dataCombiner.GetCombinedModel(uuid)
 	if err != nil {
@@ -48,19 +151,101 @@ func (p *RequestProcessor) ForcePublication(uuid string, tid string) error {
 		return ErrNotFound
 	}
 
-	result, err := p.opaAgent.EvaluateKafkaIngestPolicy(
-		message.Content,
-		policy.KafkaIngestMetadata,
+	if r.bypass {
+		log.WithField("reason", r.bypassReason).Warn("The force policy is bypassed")
+		return forwarder.filterAndForwardMsg(settings, h, &message, ForcedTrigger, nil)
+	}
+
+	q := map[string]interface{}(message.Content)
+	if p.policyInput == PolicyInputCombined {
+		if q, err = combinedPolicyInput(&message, h); err != nil {
+			return fmt.Errorf("error building the policy query: %w", err)
+		}
+	}
+
+	// There is no source message for the force requests, so a held request carries only the UUID,
+	// which is enough to force the publication again.
+	request := kafka.FTMessage{
+		Headers: h,
+		Body:    fmt.Sprintf(`{"uuid":%q}`, uuid),
+		Topic:   ForceRequestSource,
+	}
+	forward, result, err := evaluatePolicy(
+		p.opaAgent,
+		p.policyErrors,
+		q,
+		policy.KafkaIngestForce,
+		request,
+		log,
 	)
 	if err != nil {
 		log.WithError(err).
-			Error("Could not evaluate the OPA Kafka Ingest policy while processing a /content/ metadata message.")
+			Error("Could not evaluate the OPA Kafka Ingest policy while processing a force request.")
+		return err
+	}
+	if result != nil && result.Skip {
+		recordSkip(p.audit, policy.KafkaIngestForce, result, uuid, tid)
+		return &PolicySkipError{Policy: policy.KafkaIngestForce, Reasons: result.Reasons, DecisionID: result.DecisionID}
+	}
+	if !forward {
+		return ErrHeld
+	}
+
+	return forwarder.filterAndForwardMsg(settings, h, &message, ForcedTrigger, result)
+}
+
+// ForceDeletion sends a deleted combined message for content which is gone from every source,
+// so that the consumers can remove what they still hold of it. It returns ErrContentExists if any source has the content.
+// If the messages of the topic are keyed, the deleted message is followed by a tombstone.
+// The force policy isn't evaluated, as there is no content to evaluate it against.
+func (p *RequestProcessor) ForceDeletion(uuid string, tid string, opts ...ForceOption) error {
+	var r forceRequest
+	for _, opt := range opts {
+		opt(&r)
+	}
+	if r.bypass {
+		return fmt.Errorf("%w: deletions aren't evaluated by the force policy", ErrInvalidForceOption)
+	}
+	if err := r.validate(); err != nil {
+		return err
+	}
+	// The overrides are recorded before the sources are checked, so that the refused deletions are in the audit trail too.
+	r.record(p.audit, uuid, tid)
+	forwarder, err := p.forwarderFor(r.topic)
+	if err != nil {
 		return err
 	}
-	if result.Skip {
-		log.Error(formatOPASkipReasons(result.Reasons))
+	settings := forwarder.current()
+
+	sources, err := p.dataCombiner.FindSources(uuid)
+	if err != nil {
+		return fmt.Errorf("error checking the sources of the content: %w", err)
+	}
+	if len(sources) > 0 {
+		return fmt.Errorf("%w in %s", ErrContentExists, strings.Join(sources, ", "))
+	}
+
+	h := map[string]string{
+		"X-Request-Id":     tid,
+		"Content-Type":     ContentType,
+		"Origin-System-Id": CombinerOrigin,
+	}
+	r.apply(h)
+
+	message := CombinedModel{
+		UUID:         uuid,
+		LastModified: time.Now().UTC().Format(eventTimestampFormat),
+		Deleted:      true,
+	}
+
+	if err = forwarder.filterAndForwardMsg(settings, h, &message, ForcedTrigger, nil); err != nil {
 		return err
 	}
 
-	return p.forwarder.filterAndForwardMsg(h, &message)
+	if keyed, ok := forwarder.producer.(keyedMessageProducer); ok {
+		if err = keyed.SendTombstone(uuid); err != nil {
+			return fmt.Errorf("error sending the tombstone: %w", err)
+		}
+	}
+	return nil
 }
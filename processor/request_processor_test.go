@@ -1,12 +1,15 @@
 package processor
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
 	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/audit"
 	"github.com/Financial-Times/post-publication-combiner/v2/policy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRequestProcessor_ForcePublication(t *testing.T) {
@@ -59,10 +62,11 @@ func TestRequestProcessor_ForcePublication(t *testing.T) {
 				}},
 			messageProducer: NewDummyProducer(t, testUUID, testTID, kafka.FTMessage{
 				Headers: map[string]string{
-					"Message-Type":     CombinerMessageType,
-					"X-Request-Id":     testTID,
-					"Origin-System-Id": CombinerOrigin,
-					"Content-Type":     ContentType,
+					"Message-Type":      CombinerMessageType,
+					"X-Request-Id":      testTID,
+					"Origin-System-Id":  CombinerOrigin,
+					"Content-Type":      ContentType,
+					SchemaVersionHeader: "1",
 				},
 				Body: `{"uuid":"some_uuid","contentUri":"","lastModified":"","deleted":false,
 							"content":{"uuid":"some_uuid","title":"simple title","type":"Article"},
@@ -115,10 +119,11 @@ func TestRequestProcessor_ForcePublication(t *testing.T) {
 				}},
 			messageProducer: NewDummyProducer(t, testUUID, "", kafka.FTMessage{
 				Headers: map[string]string{
-					"Message-Type":     CombinerMessageType,
-					"X-Request-Id":     "[ignore]",
-					"Origin-System-Id": CombinerOrigin,
-					"Content-Type":     ContentType,
+					"Message-Type":      CombinerMessageType,
+					"X-Request-Id":      "[ignore]",
+					"Origin-System-Id":  CombinerOrigin,
+					"Content-Type":      ContentType,
+					SchemaVersionHeader: "1",
 				},
 				Body: `{"uuid":"some_uuid","contentUri":"","lastModified":"","deleted":false,
 						"content":{"uuid":"some_uuid","title":"simple title","type":"Article"},
@@ -194,7 +199,7 @@ func TestRequestProcessor_ForcePublication(t *testing.T) {
 				returnResult: &policy.ContentPolicyResult{},
 			}
 
-			requestProcessor := NewRequestProcessor(test.dataCombiner, test.messageProducer, allowedContentTypes, log, opaAgent)
+			requestProcessor := NewRequestProcessor(test.dataCombiner, test.messageProducer, ForwarderConfig{SupportedContentTypes: allowedContentTypes}, log, opaAgent)
 
 			err := requestProcessor.ForcePublication(testUUID, test.publishTID)
 			assert.ErrorIs(t, err, test.err)
@@ -202,3 +207,140 @@ func TestRequestProcessor_ForcePublication(t *testing.T) {
 		})
 	}
 }
+
+func TestForcePublication_Skipped_By_Policy(t *testing.T) {
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	dataCombiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: "some_uuid",
+		data: CombinedModel{
+			UUID:    "some_uuid",
+			Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+		},
+	}
+	opaAgent := mockOpaAgent{
+		returnResult: &policy.ContentPolicyResult{
+			Skip:    true,
+			Reasons: []string{"editorialDesk: /FT/Professional/Central Banking not allowed"},
+		},
+	}
+
+	p := NewRequestProcessor(dataCombiner, producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}, log, opaAgent)
+
+	err := p.ForcePublication("some_uuid", "some-tid")
+
+	var skipErr *PolicySkipError
+	require.ErrorAs(t, err, &skipErr)
+	assert.Equal(t, policy.KafkaIngestForce, skipErr.Policy)
+	assert.Equal(t, []string{"editorialDesk: /FT/Professional/Central Banking not allowed"}, skipErr.Reasons)
+	assert.Empty(t, producer.messages)
+}
+
+func TestForcePublication_ForcedBy(t *testing.T) {
+	producer := &recordingProducer{}
+	log, _ := testLogger()
+	dataCombiner := DummyDataCombiner{
+		t:            t,
+		expectedUUID: "some_uuid",
+		data: CombinedModel{
+			UUID:    "some_uuid",
+			Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+		},
+	}
+	opaAgent := mockOpaAgent{returnResult: &policy.ContentPolicyResult{}}
+
+	p := NewRequestProcessor(dataCombiner, producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}, log, opaAgent)
+
+	require.NoError(t, p.ForcePublication("some_uuid", "some-tid", ForcedBy("reindexer")))
+	require.NoError(t, p.ForcePublication("some_uuid", "some-tid"))
+
+	require.Len(t, producer.messages, 2)
+	assert.Equal(t, "reindexer", producer.messages[0].Headers[ForcedByHeader])
+	assert.NotContains(t, producer.messages[1].Headers, ForcedByHeader)
+}
+
+func TestForceDeletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []string
+		opts    []ForceOption
+		err     error
+		audited int
+	}{
+		{name: "content gone from every source", opts: []ForceOption{ForcedBy("ops")}},
+		{name: "content gone with overrides", opts: []ForceOption{ForcedBy("ops"), WithHeaders(map[string]string{"X-Reason": "takedown"})}, audited: 1},
+		{name: "content still in a source", sources: []string{ContentCollectionSource}, err: ErrContentExists},
+		{
+			name:    "content still in a source with overrides",
+			sources: []string{ContentCollectionSource},
+			opts:    []ForceOption{WithOrigin("http://cmdb.ft.com/systems/pac")},
+			err:     ErrContentExists,
+			audited: 1,
+		},
+		{name: "policy bypass", opts: []ForceOption{BypassingPolicy("gone")}, err: ErrInvalidForceOption},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			producer := &recordingProducer{}
+			log, _ := testLogger()
+			auditLog := audit.NewLog(10)
+			dataCombiner := DummyDataCombiner{t: t, expectedUUID: "some_uuid", sources: test.sources}
+
+			p := NewRequestProcessor(dataCombiner, producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}, log, mockOpaAgent{},
+				WithRequestAudit(auditLog))
+
+			err := p.ForceDeletion("some_uuid", "some-tid", test.opts...)
+			assert.Len(t, auditLog.Entries(audit.Filter{Type: audit.ForceOverride}), test.audited, "the overrides are recorded whether the deletion is sent or not")
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				assert.Empty(t, producer.messages)
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, producer.messages, 1)
+			m := producer.messages[0]
+			assert.Equal(t, "some-tid", m.Headers["X-Request-Id"])
+			assert.Equal(t, CombinerOrigin, m.Headers["Origin-System-Id"])
+			assert.Equal(t, "ops", m.Headers[ForcedByHeader])
+
+			var combined CombinedModel
+			require.NoError(t, json.Unmarshal([]byte(m.Body), &combined))
+			assert.Equal(t, "some_uuid", combined.UUID)
+			assert.True(t, combined.Deleted)
+			assert.Nil(t, combined.Content)
+			assert.NotEmpty(t, combined.LastModified)
+		})
+	}
+}
+
+type keyedRecordingProducer struct {
+	recordingProducer
+	keys       []string
+	tombstones []string
+}
+
+func (p *keyedRecordingProducer) SendKeyedMessage(key string, m kafka.FTMessage) error {
+	p.keys = append(p.keys, key)
+	return p.SendMessage(m)
+}
+
+func (p *keyedRecordingProducer) SendTombstone(key string) error {
+	p.tombstones = append(p.tombstones, key)
+	return nil
+}
+
+func TestForceDeletion_KeyedMessages(t *testing.T) {
+	producer := &keyedRecordingProducer{}
+	log, _ := testLogger()
+	dataCombiner := DummyDataCombiner{t: t, expectedUUID: "some_uuid"}
+
+	p := NewRequestProcessor(dataCombiner, producer, ForwarderConfig{SupportedContentTypes: []string{"Article"}}, log, mockOpaAgent{})
+	require.NoError(t, p.ForceDeletion("some_uuid", "some-tid"))
+
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, []string{"some_uuid"}, producer.keys, "the deleted message is keyed")
+	assert.Equal(t, []string{"some_uuid"}, producer.tombstones, "the deleted message is followed by a tombstone")
+}
@@ -0,0 +1,49 @@
+package processor
+
+import "sync/atomic"
+
+// Settings are the parts of the configuration which can be reloaded while the service runs.
+type Settings struct {
+	// Origins match the Origin-System-Id values of the metadata messages which are processed.
+	Origins *OriginMatcher
+	// ContentTypes decide which content is forwarded by its type.
+	ContentTypes *ContentTypeFilter
+	// Routes are the topics the policy decisions can send messages to.
+	Routes    TopicProducers
+	Upstreams Upstreams
+}
+
+// Upstreams are the services the content and the annotations are read from.
+type Upstreams struct {
+	// DocumentStoreURL, InternalContentURL and ContentCollectionURL read the content and the annotations,
+	// with the {uuid} placeholder.
+	DocumentStoreURL     string
+	InternalContentURL   string
+	ContentCollectionURL string
+	// DocumentStoreIdentifierURL finds the content by its identifiers, with the {authority} and {identifierValue} placeholders.
+	DocumentStoreIdentifierURL string
+	// The base URLs of the services are checked by the healthchecks.
+	DocumentStoreBaseURL     string
+	InternalContentBaseURL   string
+	ContentCollectionBaseURL string
+}
+
+// SettingsStore holds the current settings, shared by the processors, the forwarders and the data combiner.
+// The settings are replaced as a whole, so their users never see a mix of the old and the new ones.
+type SettingsStore struct {
+	current atomic.Pointer[Settings]
+}
+
+func NewSettingsStore(s Settings) *SettingsStore {
+	store := &SettingsStore{}
+	store.Store(s)
+	return store
+}
+
+func (s *SettingsStore) Load() *Settings {
+	return s.current.Load()
+}
+
+func (s *SettingsStore) Store(settings Settings) {
+	s.current.Store(&settings)
+}
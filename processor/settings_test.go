@@ -0,0 +1,158 @@
+package processor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettings_Forwarder(t *testing.T) {
+	settings := NewSettingsStore(Settings{ContentTypes: NewContentTypeFilter([]string{"Article"}, ContentTypeConfig{})})
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{SupportedContentTypes: []string{"Video"}, Settings: settings})
+	liveEvent := &CombinedModel{UUID: "some_uuid", Content: ContentModel{"uuid": "some_uuid", "type": "LiveEvent"}}
+
+	err := f.filterAndForwardMsg(f.current(), map[string]string{}, liveEvent, ForcedTrigger, nil)
+	assert.ErrorIs(t, err, ErrInvalidContentType, "the settings replace the configured content types")
+
+	routed := &recordingProducer{}
+	settings.Store(Settings{
+		ContentTypes: NewContentTypeFilter([]string{"Article", "LiveEvent"}, ContentTypeConfig{}),
+		Routes:       TopicProducers{"LiveEvents": routed},
+	})
+
+	require.NoError(t, f.filterAndForwardMsg(f.current(), map[string]string{}, liveEvent, ForcedTrigger, nil))
+	require.NoError(t, f.filterAndForwardMsg(f.current(), map[string]string{}, liveEvent, ForcedTrigger, &policy.ContentPolicyResult{Topic: "LiveEvents"}))
+	assert.Len(t, producer.messages, 1)
+	assert.Len(t, routed.messages, 1)
+}
+
+func TestSettings_MsgProcessor_Origins(t *testing.T) {
+	settings := NewSettingsStore(Settings{Origins: ExactOriginMatcher([]string{"http://cmdb.ft.com/systems/pac"})})
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		config:    MsgProcessorConfig{SupportedHeaders: []string{"http://cmdb.ft.com/systems/binding-service"}},
+		forwarder: newForwarder(&recordingProducer{}, ForwarderConfig{Settings: settings}),
+		log:       log,
+	}
+
+	_, ok := p.origins(p.forwarder.current()).Match("http://cmdb.ft.com/systems/pac")
+	assert.True(t, ok)
+	_, ok = p.origins(p.forwarder.current()).Match("http://cmdb.ft.com/systems/binding-service")
+	assert.False(t, ok, "the settings replace the supported headers")
+
+	settings.Store(Settings{Origins: ExactOriginMatcher([]string{"http://cmdb.ft.com/systems/next-video-editor"})})
+	_, ok = p.origins(p.forwarder.current()).Match("http://cmdb.ft.com/systems/pac")
+	assert.False(t, ok)
+	_, ok = p.origins(p.forwarder.current()).Match("http://cmdb.ft.com/systems/next-video-editor")
+	assert.True(t, ok)
+}
+
+// reloadingCombiner stores new settings while the message is combined, like a reload in the middle of the processing.
+type reloadingCombiner struct {
+	DummyDataCombiner
+	settings *SettingsStore
+	reloaded Settings
+}
+
+func (c reloadingCombiner) GetCombinedModelForAnnotations(AnnotationsMessage) (CombinedModel, error) {
+	c.settings.Store(c.reloaded)
+	return c.data, nil
+}
+
+func TestSettings_MsgProcessor_ReloadWhileProcessing(t *testing.T) {
+	producer := &recordingProducer{}
+	settings := NewSettingsStore(Settings{
+		Origins:      ExactOriginMatcher([]string{"http://cmdb.ft.com/systems/pac"}),
+		ContentTypes: NewContentTypeFilter([]string{"Article"}, ContentTypeConfig{}),
+	})
+	log, _ := testLogger()
+	p := &MsgProcessor{
+		dataCombiner: reloadingCombiner{
+			DummyDataCombiner: DummyDataCombiner{
+				data: CombinedModel{
+					UUID:    "0cef259d-030d-497d-b4ef-e8fa0ee6db6b",
+					Content: ContentModel{"uuid": "0cef259d-030d-497d-b4ef-e8fa0ee6db6b", "type": "Article"},
+				},
+			},
+			settings: settings,
+			reloaded: Settings{
+				Origins:      ExactOriginMatcher([]string{"http://cmdb.ft.com/systems/pac"}),
+				ContentTypes: NewContentTypeFilter([]string{"Video"}, ContentTypeConfig{}),
+			},
+		},
+		forwarder: newForwarder(producer, ForwarderConfig{Settings: settings}),
+		opaAgent:  mockOpaAgent{returnResult: &policy.ContentPolicyResult{}},
+		log:       log,
+	}
+
+	p.processMetadataMsg(kafka.FTMessage{
+		Headers: map[string]string{"X-Request-Id": "tid_reload", "Origin-System-Id": "http://cmdb.ft.com/systems/pac"},
+		Body:    `{"payload":{"uuid":"0cef259d-030d-497d-b4ef-e8fa0ee6db6b","annotations":null}}`,
+	})
+
+	assert.Len(t, producer.messages, 1, "the message is processed with the settings loaded when it was received")
+	assert.False(t, settings.Load().ContentTypes.Allows("Article"))
+}
+
+func TestSettings_DataCombiner_Upstreams(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	settings := NewSettingsStore(Settings{Upstreams: Upstreams{
+		DocumentStoreURL:     server.URL + "/old-document-store/{uuid}",
+		InternalContentURL:   server.URL + "/internal-content/{uuid}",
+		ContentCollectionURL: server.URL + "/content-collection/{uuid}",
+	}})
+	dc := NewReloadableDataCombiner(settings, server.Client())
+
+	_, err := dc.GetCombinedModel("some_uuid")
+	require.NoError(t, err)
+
+	u := settings.Load().Upstreams
+	u.DocumentStoreURL = server.URL + "/document-store/{uuid}"
+	settings.Store(Settings{Upstreams: u})
+
+	_, err = dc.GetCombinedModel("some_uuid")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{
+		"/old-document-store/some_uuid": 1,
+		"/document-store/some_uuid":     1,
+		"/content-collection/some_uuid": 2,
+	}, requests)
+}
+
+func TestSettings_UUIDResolver_Upstreams(t *testing.T) {
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.URL.Path]++
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	settings := NewSettingsStore(Settings{Upstreams: Upstreams{
+		DocumentStoreIdentifierURL: server.URL + "/old-content-query?identifierValue={identifierValue}",
+	}})
+	r := NewReloadableUUIDResolver(settings, server.Client())
+
+	_, err := r.ResolveIdentifier(Identifier{Authority: "http://api.ft.com/system/FTCOM-METHODE", IdentifierValue: "methode id"})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	settings.Store(Settings{Upstreams: Upstreams{
+		DocumentStoreIdentifierURL: server.URL + "/content-query?identifierValue={identifierValue}",
+	}})
+	_, err = r.ResolveIdentifier(Identifier{Authority: "http://api.ft.com/system/FTCOM-METHODE", IdentifierValue: "methode id"})
+	require.ErrorIs(t, err, ErrNotFound)
+
+	assert.Equal(t, map[string]int{"/old-content-query": 1, "/content-query": 1}, requests)
+}
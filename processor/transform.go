@@ -0,0 +1,293 @@
+package processor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/rcrowley/go-metrics"
+)
+
+var unappliedRedactionsCounter = metrics.GetOrRegisterCounter("policy.redact.unapplied", metrics.DefaultRegistry)
+
+const (
+	projectStep   = "project"
+	renameStep    = "rename"
+	stripBodyStep = "stripBody"
+
+	contentTarget         = "content"
+	internalContentTarget = "internalContent"
+)
+
+// TransformStepConfig declares a single step of the transformation pipeline.
+// Fields are addressed by dot separated paths, e.g. "alternativeTitles.promotionalTitle".
+type TransformStepConfig struct {
+	// Type is one of "project", "rename" or "stripBody".
+	Type string `json:"type"`
+	// ContentTypes, or glob patterns of them, the step is applied to. If empty, the step is applied to all the messages.
+	ContentTypes []string `json:"contentTypes,omitempty"`
+	// Target is either "content" or "internalContent". Not used by the "stripBody" steps.
+	Target string `json:"target,omitempty"`
+
+	// Include lists the only fields kept by a "project" step.
+	Include []string `json:"include,omitempty"`
+	// Exclude lists the fields dropped by a "project" step.
+	Exclude []string `json:"exclude,omitempty"`
+
+	// From and To are the field paths of a "rename" step.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+
+	// Fields dropped from the content by a "stripBody" step, when the internal content is present. Defaults to "bodyXML".
+	Fields []string `json:"fields,omitempty"`
+}
+
+type TransformConfig struct {
+	Steps []TransformStepConfig `json:"steps"`
+}
+
+// TransformPipeline reshapes the combined messages before they are forwarded.
+type TransformPipeline struct {
+	steps []transformStep
+}
+
+type transformStep struct {
+	TransformStepConfig
+	contentTypes []*regexp.Regexp
+}
+
+func LoadTransformPipeline(path string) (*TransformPipeline, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading transformation config: %w", err)
+	}
+
+	var config TransformConfig
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("error unmarshalling transformation config: %w", err)
+	}
+
+	return NewTransformPipeline(config)
+}
+
+func NewTransformPipeline(config TransformConfig) (*TransformPipeline, error) {
+	steps := make([]transformStep, 0, len(config.Steps))
+	for i, s := range config.Steps {
+		if err := validateTransformStep(s); err != nil {
+			return nil, fmt.Errorf("invalid transformation step %d: %w", i, err)
+		}
+		steps = append(steps, transformStep{TransformStepConfig: s, contentTypes: compileGlobs(s.ContentTypes)})
+	}
+	return &TransformPipeline{steps: steps}, nil
+}
+
+func validateTransformStep(s TransformStepConfig) error {
+	switch s.Type {
+	case projectStep:
+		if len(s.Include) > 0 == (len(s.Exclude) > 0) {
+			return fmt.Errorf("exactly one of include or exclude should be set")
+		}
+	case renameStep:
+		if s.From == "" || s.To == "" {
+			return fmt.Errorf("both from and to should be set")
+		}
+	case stripBodyStep:
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q", s.Type)
+	}
+
+	if s.Target != contentTarget && s.Target != internalContentTarget {
+		return fmt.Errorf("unknown target %q", s.Target)
+	}
+	return nil
+}
+
+// Apply returns a transformed copy of the message, of the given content type. The message itself is not modified.
+// The content type is the one the whitelist filters the message by, inferred if the content has none.
+func (p *TransformPipeline) Apply(message *CombinedModel, contentType string) *CombinedModel {
+	if p == nil || len(p.steps) == 0 {
+		return message
+	}
+
+	transformed := *message
+	transformed.Content = copyContent(message.Content)
+	transformed.InternalContent = copyContent(message.InternalContent)
+
+	for _, s := range p.steps {
+		if len(s.contentTypes) > 0 && !matchesAny(s.contentTypes, contentType) {
+			continue
+		}
+		applyTransformStep(s.TransformStepConfig, &transformed)
+	}
+
+	return &transformed
+}
+
+func applyTransformStep(s TransformStepConfig, m *CombinedModel) {
+	if s.Type == stripBodyStep {
+		if m.Content == nil || m.InternalContent == nil {
+			return
+		}
+		fields := s.Fields
+		if len(fields) == 0 {
+			fields = []string{"bodyXML"}
+		}
+		for _, f := range fields {
+			deletePath(m.Content, f)
+		}
+		return
+	}
+
+	target := &m.Content
+	if s.Target == internalContentTarget {
+		target = &m.InternalContent
+	}
+	if *target == nil {
+		return
+	}
+
+	switch s.Type {
+	case projectStep:
+		if len(s.Include) > 0 {
+			projected := ContentModel{}
+			for _, f := range s.Include {
+				if v, ok := getPath(*target, f); ok {
+					setPath(projected, f, v)
+				}
+			}
+			*target = projected
+			return
+		}
+		for _, f := range s.Exclude {
+			deletePath(*target, f)
+		}
+	case renameStep:
+		if v, ok := getPath(*target, s.From); ok {
+			deletePath(*target, s.From)
+			setPath(*target, s.To, v)
+		}
+	}
+}
+
+// redact returns a copy of the message without the fields at the given paths. The paths start with
+// "content", "internalContent" or "metadata", e.g. "internalContent.bodyXML". The annotations can only be removed altogether.
+// The other paths are ignored here, and reported by warnUnappliedRedactions when the policy is evaluated.
+func redact(message *CombinedModel, paths []string) *CombinedModel {
+	if len(paths) == 0 {
+		return message
+	}
+
+	redacted := *message
+	redacted.Content = copyContent(message.Content)
+	redacted.InternalContent = copyContent(message.InternalContent)
+
+	for _, p := range paths {
+		root, field, _ := strings.Cut(p, ".")
+		switch {
+		case root == contentTarget && field == "":
+			redacted.Content = nil
+		case root == contentTarget:
+			deletePath(redacted.Content, field)
+		case root == internalContentTarget && field == "":
+			redacted.InternalContent = nil
+		case root == internalContentTarget:
+			deletePath(redacted.InternalContent, field)
+		case root == "metadata" && field == "":
+			redacted.Metadata = nil
+		}
+	}
+
+	return &redacted
+}
+
+// redactable reports whether redact can apply the path: the root is known, and the annotations aren't redacted partially.
+func redactable(path string) bool {
+	root, field, _ := strings.Cut(path, ".")
+	switch root {
+	case contentTarget, internalContentTarget:
+		return true
+	case "metadata":
+		return field == ""
+	}
+	return false
+}
+
+// warnUnappliedRedactions logs and counts the redact paths of the decision which redact ignores.
+func warnUnappliedRedactions(decision *policy.ContentPolicyResult, log *logger.LogEntry) {
+	for _, p := range decision.Redact {
+		if !redactable(p) {
+			unappliedRedactionsCounter.Inc(1)
+			log.WithField("decision_id", decision.DecisionID).
+				WithField("path", p).
+				Warn("The redact path of the policy decision can't be applied, the field is forwarded")
+		}
+	}
+}
+
+func getPath(m map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = next
+	}
+	v, ok := m[keys[len(keys)-1]]
+	return v, ok
+}
+
+func setPath(m map[string]interface{}, path string, v interface{}) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			m[k] = next
+		}
+		m = next
+	}
+	m[keys[len(keys)-1]] = v
+}
+
+func deletePath(m map[string]interface{}, path string) {
+	keys := strings.Split(path, ".")
+	for _, k := range keys[:len(keys)-1] {
+		next, ok := m[k].(map[string]interface{})
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, keys[len(keys)-1])
+}
+
+func copyContent(c ContentModel) ContentModel {
+	if c == nil {
+		return nil
+	}
+	return copyValue(map[string]interface{}(c)).(map[string]interface{})
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			c[k] = copyValue(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(t))
+		for i, v := range t {
+			c[i] = copyValue(v)
+		}
+		return c
+	}
+	return v
+}
@@ -0,0 +1,297 @@
+package processor
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransformPipelineApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []TransformStepConfig
+		// contentType is the one the message is filtered by, the type of its content if empty.
+		contentType string
+		message     CombinedModel
+		expected    CombinedModel
+	}{
+		{
+			name: "project include keeps nested fields",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "content", Include: []string{"uuid", "type", "alternativeTitles.promotionalTitle", "missing"}},
+			},
+			message: CombinedModel{
+				Content: ContentModel{
+					"uuid":              "some_uuid",
+					"type":              "Article",
+					"title":             "title",
+					"alternativeTitles": map[string]interface{}{"promotionalTitle": "promo", "contentPackageTitle": "package"},
+				},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{
+					"uuid":              "some_uuid",
+					"type":              "Article",
+					"alternativeTitles": map[string]interface{}{"promotionalTitle": "promo"},
+				},
+			},
+		},
+		{
+			name: "project exclude on internal content",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "internalContent", Exclude: []string{"embeds", "body.tree"}},
+			},
+			message: CombinedModel{
+				InternalContent: ContentModel{
+					"uuid":   "some_uuid",
+					"embeds": []interface{}{"embed"},
+					"body":   map[string]interface{}{"tree": "tree", "xml": "xml"},
+				},
+			},
+			expected: CombinedModel{
+				InternalContent: ContentModel{
+					"uuid": "some_uuid",
+					"body": map[string]interface{}{"xml": "xml"},
+				},
+			},
+		},
+		{
+			name: "rename",
+			steps: []TransformStepConfig{
+				{Type: "rename", Target: "content", From: "standfirst", To: "summary.text"},
+				{Type: "rename", Target: "content", From: "missing", To: "other"},
+			},
+			message: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "standfirst": "standfirst"},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "summary": map[string]interface{}{"text": "standfirst"}},
+			},
+		},
+		{
+			name: "strip body when the internal content is present",
+			steps: []TransformStepConfig{
+				{Type: "stripBody"},
+			},
+			message: CombinedModel{
+				Content:         ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+				InternalContent: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+			},
+			expected: CombinedModel{
+				Content:         ContentModel{"uuid": "some_uuid"},
+				InternalContent: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+			},
+		},
+		{
+			name: "keep body when the internal content is missing",
+			steps: []TransformStepConfig{
+				{Type: "stripBody"},
+			},
+			message: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+			},
+		},
+		{
+			name: "steps restricted to other content types are skipped",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "content", ContentTypes: []string{"ContentPackage"}, Include: []string{"uuid"}},
+			},
+			message: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "type": "Article"},
+			},
+		},
+		{
+			name: "steps restricted to glob patterns of content types",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "content", ContentTypes: []string{"LiveBlog*"}, Include: []string{"uuid"}},
+			},
+			message: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "type": "LiveBlogPost", "title": "title"},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid"},
+			},
+		},
+		{
+			name: "steps restricted to the inferred content type",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "content", ContentTypes: []string{"Video"}, Include: []string{"uuid"}},
+			},
+			contentType: "Video",
+			message: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid", "title": "title"},
+			},
+			expected: CombinedModel{
+				Content: ContentModel{"uuid": "some_uuid"},
+			},
+		},
+		{
+			name: "deleted content",
+			steps: []TransformStepConfig{
+				{Type: "project", Target: "content", Include: []string{"uuid"}},
+				{Type: "stripBody"},
+			},
+			message: CombinedModel{
+				UUID:    "some_uuid",
+				Deleted: true,
+			},
+			expected: CombinedModel{
+				UUID:    "some_uuid",
+				Deleted: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := NewTransformPipeline(TransformConfig{Steps: test.steps})
+			require.NoError(t, err)
+
+			original, err := json.Marshal(test.message)
+			require.NoError(t, err)
+
+			contentType := test.contentType
+			if contentType == "" {
+				contentType = test.message.Content.getType()
+			}
+			actual := p.Apply(&test.message, contentType)
+			assert.Equal(t, test.expected, *actual)
+
+			after, err := json.Marshal(test.message)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(original), string(after), "the original message should not be modified")
+		})
+	}
+}
+
+func TestTransformPipelineApply_Nil(t *testing.T) {
+	var p *TransformPipeline
+	message := &CombinedModel{UUID: "some_uuid"}
+	assert.Same(t, message, p.Apply(message, ""))
+}
+
+func TestNewTransformPipeline_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		step TransformStepConfig
+	}{
+		{name: "unknown type", step: TransformStepConfig{Type: "drop", Target: "content"}},
+		{name: "unknown target", step: TransformStepConfig{Type: "project", Target: "metadata", Include: []string{"uuid"}}},
+		{name: "no projection", step: TransformStepConfig{Type: "project", Target: "content"}},
+		{name: "include and exclude", step: TransformStepConfig{Type: "project", Target: "content", Include: []string{"uuid"}, Exclude: []string{"title"}}},
+		{name: "rename without to", step: TransformStepConfig{Type: "rename", Target: "content", From: "title"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewTransformPipeline(TransformConfig{Steps: []TransformStepConfig{test.step}})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadTransformPipeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "transform.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"steps":[{"type":"stripBody"},{"type":"project","target":"content","exclude":["title"]}]}`), 0600))
+
+	p, err := LoadTransformPipeline(path)
+	require.NoError(t, err)
+	assert.Len(t, p.steps, 2)
+
+	_, err = LoadTransformPipeline(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	message := &CombinedModel{
+		UUID:            "some_uuid",
+		Content:         ContentModel{"uuid": "some_uuid", "alternativeTitles": map[string]interface{}{"promotionalTitle": "promo"}},
+		InternalContent: ContentModel{"uuid": "some_uuid"},
+		Metadata:        []Annotation{{Thing: Thing{ID: "some_id"}}},
+	}
+
+	assert.Same(t, message, redact(message, nil))
+
+	redacted := redact(message, []string{"content.alternativeTitles.promotionalTitle", "internalContent", "unknown.field", "content.missing"})
+	assert.Equal(t, &CombinedModel{
+		UUID:     "some_uuid",
+		Content:  ContentModel{"uuid": "some_uuid", "alternativeTitles": map[string]interface{}{}},
+		Metadata: []Annotation{{Thing: Thing{ID: "some_id"}}},
+	}, redacted)
+	assert.Equal(t, map[string]interface{}{"promotionalTitle": "promo"}, message.Content["alternativeTitles"])
+	assert.NotNil(t, message.InternalContent)
+}
+
+func TestWarnUnappliedRedactions(t *testing.T) {
+	log, hook := testLogger()
+	before := unappliedRedactionsCounter.Count()
+
+	warnUnappliedRedactions(&policy.ContentPolicyResult{
+		DecisionID: "some_decision",
+		Redact:     []string{"content.editorialDesk", "internalContent", "metadata", "metadata.predicate", "unknown.field"},
+	}, log.WithTransactionID("some-tid"))
+
+	assert.Equal(t, int64(2), unappliedRedactionsCounter.Count()-before)
+	var paths []interface{}
+	for _, e := range hook.AllEntries() {
+		assert.Equal(t, "some_decision", e.Data["decision_id"])
+		paths = append(paths, e.Data["path"])
+	}
+	assert.Equal(t, []interface{}{"metadata.predicate", "unknown.field"}, paths)
+}
+
+func TestForwardMsg_Transforms(t *testing.T) {
+	p, err := NewTransformPipeline(TransformConfig{Steps: []TransformStepConfig{{Type: "stripBody"}}})
+	require.NoError(t, err)
+
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{Transforms: p})
+
+	err = f.forwardMsg(f.current(), map[string]string{}, &CombinedModel{
+		UUID:            "some_uuid",
+		Content:         ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+		InternalContent: ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+	}, ContentTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	var forwarded CombinedModel
+	require.NoError(t, json.Unmarshal([]byte(producer.messages[0].Body), &forwarded))
+	assert.Equal(t, ContentModel{"uuid": "some_uuid"}, forwarded.Content)
+	assert.Equal(t, ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"}, forwarded.InternalContent)
+}
+
+func TestForwardMsg_Transforms_InferredContentType(t *testing.T) {
+	p, err := NewTransformPipeline(TransformConfig{Steps: []TransformStepConfig{{Type: "stripBody", ContentTypes: []string{"Live*"}}}})
+	require.NoError(t, err)
+
+	producer := &recordingProducer{}
+	f := newForwarder(producer, ForwarderConfig{
+		SupportedContentTypes: []string{"LiveBlogPost"},
+		ContentTypes:          ContentTypeConfig{InferFromInternalContent: true},
+		Transforms:            p,
+	})
+
+	err = f.forwardMsg(f.current(), map[string]string{}, &CombinedModel{
+		UUID:            "some_uuid",
+		Content:         ContentModel{"uuid": "some_uuid", "bodyXML": "<body/>"},
+		InternalContent: ContentModel{"uuid": "some_uuid", "type": "LiveBlogPost"},
+	}, ContentTrigger, nil)
+	require.NoError(t, err)
+	require.Len(t, producer.messages, 1)
+
+	var forwarded CombinedModel
+	require.NoError(t, json.Unmarshal([]byte(producer.messages[0].Body), &forwarded))
+	assert.Equal(t, ContentModel{"uuid": "some_uuid"}, forwarded.Content, "the step applies to the type inferred from the internal content")
+}
@@ -0,0 +1,91 @@
+package processor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/httputils"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidContentURI = errors.New("invalid content URI")
+
+// UUIDResolver finds the UUIDs of the content by their identifiers.
+type UUIDResolver struct {
+	// identifierURL is the document-store-api endpoint resolving an identifier,
+	// with the {authority} and {identifierValue} placeholders.
+	identifierURL string
+	settings      *SettingsStore
+	client        httputils.Client
+}
+
+func NewUUIDResolver(identifierURL string, client httputils.Client) *UUIDResolver {
+	return &UUIDResolver{
+		identifierURL: identifierURL,
+		client:        client,
+	}
+}
+
+// NewReloadableUUIDResolver finds the UUIDs through the document-store-api of the current settings.
+func NewReloadableUUIDResolver(settings *SettingsStore, client httputils.Client) *UUIDResolver {
+	return &UUIDResolver{
+		settings: settings,
+		client:   client,
+	}
+}
+
+// currentIdentifierURL returns the identifier endpoint of the current upstreams.
+func (r *UUIDResolver) currentIdentifierURL() string {
+	if r.settings == nil {
+		return r.identifierURL
+	}
+	return r.settings.Load().Upstreams.DocumentStoreIdentifierURL
+}
+
+// ResolveIdentifier returns the UUID of the content with the identifier, or ErrNotFound if there is none.
+// The endpoint can either return the content, or redirect to it.
+func (r *UUIDResolver) ResolveIdentifier(id Identifier) (string, error) {
+	uri := strings.NewReplacer(
+		"{authority}", url.QueryEscape(id.Authority),
+		"{identifierValue}", url.QueryEscape(id.IdentifierValue),
+	).Replace(r.currentIdentifierURL())
+
+	b, err := httputils.ExecuteRequest(uri, r.client)
+	if err != nil {
+		var codeError *httputils.StatusCodeError
+		if errors.As(err, &codeError) && codeError.StatusCode == http.StatusNotFound {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+
+	var content ContentModel
+	if err = json.Unmarshal(b, &content); err != nil {
+		return "", fmt.Errorf("error unmarshalling the content of the identifier: %w", err)
+	}
+
+	contentUUID := content.getUUID()
+	if contentUUID == "" {
+		return "", ErrNotFound
+	}
+	return contentUUID, nil
+}
+
+// UUIDFromContentURI returns the UUID ending the content URI, e.g. http://api.ft.com/content/a224c5d3-0f1c-49bd-b70c-c88f5d29cf60.
+func UUIDFromContentURI(contentURI string) (string, error) {
+	u, err := url.Parse(contentURI)
+	if err != nil || u.Path == "" {
+		return "", fmt.Errorf("%w: %q", ErrInvalidContentURI, contentURI)
+	}
+
+	id, err := uuid.Parse(path.Base(u.Path))
+	if err != nil {
+		return "", fmt.Errorf("%w: %q doesn't end with a UUID", ErrInvalidContentURI, contentURI)
+	}
+	return id.String(), nil
+}
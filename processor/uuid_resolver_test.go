@@ -0,0 +1,88 @@
+package processor
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveIdentifier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/content-query":
+			if r.URL.Query().Get("identifierAuthority") != "http://api.ft.com/system/FTCOM-METHODE" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			switch r.URL.Query().Get("identifierValue") {
+			case "methode id":
+				http.Redirect(w, r, "/content/622de808-3a7a-49bd-a7fb-2a33f64695be", http.StatusMovedPermanently)
+			case "broken":
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/content/622de808-3a7a-49bd-a7fb-2a33f64695be":
+			_, _ = w.Write([]byte(`{"uuid":"622de808-3a7a-49bd-a7fb-2a33f64695be","type":"Article"}`))
+		}
+	}))
+	defer server.Close()
+
+	r := NewUUIDResolver(server.URL+"/content-query?identifierAuthority={authority}&identifierValue={identifierValue}", server.Client())
+
+	tests := []struct {
+		name     string
+		id       Identifier
+		expected string
+		err      error
+	}{
+		{
+			name:     "resolved identifier",
+			id:       Identifier{Authority: "http://api.ft.com/system/FTCOM-METHODE", IdentifierValue: "methode id"},
+			expected: "622de808-3a7a-49bd-a7fb-2a33f64695be",
+		},
+		{
+			name: "unknown identifier",
+			id:   Identifier{Authority: "http://api.ft.com/system/FTCOM-METHODE", IdentifierValue: "other id"},
+			err:  ErrNotFound,
+		},
+		{
+			name: "unknown authority",
+			id:   Identifier{Authority: "http://api.ft.com/system/OTHER", IdentifierValue: "methode id"},
+			err:  ErrNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uuid, err := r.ResolveIdentifier(test.id)
+			assert.ErrorIs(t, err, test.err)
+			assert.Equal(t, test.expected, uuid)
+		})
+	}
+
+	_, err := r.ResolveIdentifier(Identifier{Authority: "http://api.ft.com/system/FTCOM-METHODE", IdentifierValue: "broken"})
+	assert.ErrorContains(t, err, fmt.Sprintf("status: %d", http.StatusServiceUnavailable))
+}
+
+func TestUUIDFromContentURI(t *testing.T) {
+	tests := map[string]string{
+		"http://api.ft.com/content/622de808-3a7a-49bd-a7fb-2a33f64695be":                        "622de808-3a7a-49bd-a7fb-2a33f64695be",
+		"http://methode-article-mapper.svc.ft.com/content/622DE808-3A7A-49BD-A7FB-2A33F64695BE": "622de808-3a7a-49bd-a7fb-2a33f64695be",
+		"http://api.ft.com/things/622de808-3a7a-49bd-a7fb-2a33f64695be?x=1":                     "622de808-3a7a-49bd-a7fb-2a33f64695be",
+	}
+	for uri, expected := range tests {
+		uuid, err := UUIDFromContentURI(uri)
+		require.NoError(t, err, uri)
+		assert.Equal(t, expected, uuid)
+	}
+
+	for _, uri := range []string{"", "http://api.ft.com/content/", "http://api.ft.com/content/some-id", "%zz"} {
+		_, err := UUIDFromContentURI(uri)
+		assert.ErrorIs(t, err, ErrInvalidContentURI, uri)
+	}
+}
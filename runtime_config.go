@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v4"
+	"github.com/Financial-Times/post-publication-combiner/v2/filewatch"
+	"github.com/Financial-Times/post-publication-combiner/v2/processor"
+)
+
+const redacted = "REDACTED"
+
+// runtimeConfig is the configuration which can be reloaded from the runtime configuration file while the service runs.
+// The fields missing from the file keep the values of the environment variables.
+type runtimeConfig struct {
+	WhitelistedContentTypes                []string                    `json:"whitelistedContentTypes"`
+	ContentTypes                           processor.ContentTypeConfig `json:"contentTypes"`
+	WhitelistedMetadataOriginSystemHeaders []string                    `json:"whitelistedMetadataOriginSystemHeaders"`
+	// OriginSystemRules replace the whitelisted Origin-System-Id values, which are matched exactly, if there are any.
+	OriginSystemRules []processor.OriginRule `json:"originSystemRules,omitempty"`
+	RoutingTopics     []string               `json:"routingTopics"`
+	Upstreams         runtimeUpstreams       `json:"upstreams"`
+	// endpoints can't be set in the file.
+	endpoints upstreamEndpoints
+}
+
+// runtimeUpstreams are the base URLs of the services the content and the annotations are read from.
+type runtimeUpstreams struct {
+	DocumentStore     string `json:"documentStore"`
+	InternalContent   string `json:"internalContent"`
+	ContentCollection string `json:"contentCollection"`
+}
+
+// upstreamEndpoints are the paths of the endpoints of the upstreams, relative to their base URLs.
+type upstreamEndpoints struct {
+	DocumentStore           string
+	DocumentStoreIdentifier string
+	InternalContent         string
+	ContentCollection       string
+}
+
+// loadRuntimeConfig reads the file over the defaults.
+func loadRuntimeConfig(path string, defaults runtimeConfig) (runtimeConfig, error) {
+	// The decoder reuses the slices it decodes into, which must not be the ones of the defaults.
+	c := defaults
+	c.WhitelistedContentTypes = slices.Clone(defaults.WhitelistedContentTypes)
+	c.ContentTypes.URITypes = slices.Clone(defaults.ContentTypes.URITypes)
+	c.WhitelistedMetadataOriginSystemHeaders = slices.Clone(defaults.WhitelistedMetadataOriginSystemHeaders)
+	c.OriginSystemRules = slices.Clone(defaults.OriginSystemRules)
+	c.RoutingTopics = slices.Clone(defaults.RoutingTopics)
+	if path == "" {
+		return c, c.validate()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return c, fmt.Errorf("error reading the runtime configuration: %w", err)
+	}
+	defer f.Close()
+
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields()
+	if err = d.Decode(&c); err != nil {
+		return c, fmt.Errorf("error parsing the runtime configuration: %w", err)
+	}
+	return c, c.validate()
+}
+
+func (c runtimeConfig) validate() error {
+	if len(c.WhitelistedContentTypes) == 0 {
+		return errors.New("no content types are whitelisted")
+	}
+	if _, err := processor.ParseUnknownContentTypes(string(c.ContentTypes.Unknown)); err != nil {
+		return err
+	}
+	for _, u := range c.ContentTypes.URITypes {
+		if u.Pattern == "" || u.Type == "" {
+			return fmt.Errorf("the content URI type %q:%q has no type or no pattern", u.Type, u.Pattern)
+		}
+	}
+	if _, err := c.origins(); err != nil {
+		return err
+	}
+	for _, r := range c.OriginSystemRules {
+		if r.Topic != "" && !slices.Contains(c.RoutingTopics, r.Topic) {
+			return fmt.Errorf("the topic %q of the origin rule %q is not a routing topic", r.Topic, r.Value)
+		}
+	}
+	for name, u := range map[string]string{
+		"documentStore":     c.Upstreams.DocumentStore,
+		"internalContent":   c.Upstreams.InternalContent,
+		"contentCollection": c.Upstreams.ContentCollection,
+	} {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return fmt.Errorf("the %s upstream %q is not a URL", name, redactURL(u))
+		}
+	}
+	return nil
+}
+
+func (c runtimeConfig) origins() (*processor.OriginMatcher, error) {
+	if len(c.OriginSystemRules) == 0 {
+		return processor.ExactOriginMatcher(c.WhitelistedMetadataOriginSystemHeaders), nil
+	}
+	return processor.NewOriginMatcher(c.OriginSystemRules)
+}
+
+func (c runtimeConfig) settings(routes processor.TopicProducers) (processor.Settings, error) {
+	origins, err := c.origins()
+	if err != nil {
+		return processor.Settings{}, err
+	}
+	return processor.Settings{
+		Origins:      origins,
+		ContentTypes: processor.NewContentTypeFilter(c.WhitelistedContentTypes, c.ContentTypes),
+		Routes:       routes,
+		Upstreams: processor.Upstreams{
+			DocumentStoreURL:           c.Upstreams.DocumentStore + c.endpoints.DocumentStore,
+			InternalContentURL:         c.Upstreams.InternalContent + c.endpoints.InternalContent,
+			ContentCollectionURL:       c.Upstreams.ContentCollection + c.endpoints.ContentCollection,
+			DocumentStoreIdentifierURL: c.Upstreams.DocumentStore + c.endpoints.DocumentStoreIdentifier,
+			DocumentStoreBaseURL:       c.Upstreams.DocumentStore,
+			InternalContentBaseURL:     c.Upstreams.InternalContent,
+			ContentCollectionBaseURL:   c.Upstreams.ContentCollection,
+		},
+	}, nil
+}
+
+// parseContentURITypes parses the type:pattern pairs, keeping their order.
+func parseContentURITypes(pairs []string) ([]processor.ContentURIType, error) {
+	var uriTypes []processor.ContentURIType
+	for _, p := range pairs {
+		t, pattern, ok := strings.Cut(strings.TrimSpace(p), ":")
+		if !ok || t == "" || pattern == "" {
+			return nil, fmt.Errorf("%q is not a type:pattern pair", p)
+		}
+		uriTypes = append(uriTypes, processor.ContentURIType{Pattern: pattern, Type: t})
+	}
+	return uriTypes, nil
+}
+
+// redacted hides the credentials in the upstream URLs.
+func (c runtimeConfig) redacted() runtimeConfig {
+	c.Upstreams = runtimeUpstreams{
+		DocumentStore:     redactURL(c.Upstreams.DocumentStore),
+		InternalContent:   redactURL(c.Upstreams.InternalContent),
+		ContentCollection: redactURL(c.Upstreams.ContentCollection),
+	}
+	return c
+}
+
+// redactURL hides the password and the query parameters, which could be API keys, of the URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+
+	query := u.Query()
+	for name := range query {
+		if isSecretParameter(name) {
+			query.Set(name, redacted)
+			u.RawQuery = query.Encode()
+		}
+	}
+
+	// The placeholders are escaped by the encoding.
+	return strings.NewReplacer("%7B", "{", "%7D", "}").Replace(u.String())
+}
+
+func isSecretParameter(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range []string{"key", "token", "secret", "password", "signature"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// routeProducers creates the producers of the routing topics the first time they are configured, and keeps them until the service stops.
+type routeProducers struct {
+	create func(topic string) (messageSender, error)
+
+	mu        sync.Mutex
+	producers processor.TopicProducers
+}
+
+type messageSender interface {
+	SendMessage(message kafka.FTMessage) error
+}
+
+func (r *routeProducers) get(topics []string) (processor.TopicProducers, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	routes := processor.TopicProducers{}
+	for _, topic := range topics {
+		producer, ok := r.producers[topic]
+		if !ok {
+			var err error
+			if producer, err = r.create(topic); err != nil {
+				return nil, fmt.Errorf("could not create message producer for the %s topic: %w", topic, err)
+			}
+			r.producers[topic] = producer
+		}
+		routes[topic] = producer
+	}
+	return routes, nil
+}
+
+// configReloader applies the runtime configuration file to the settings store, every time the file changes.
+type configReloader struct {
+	path     string
+	defaults runtimeConfig
+	settings *processor.SettingsStore
+	routes   *routeProducers
+	log      *logger.UPPLogger
+
+	mu       sync.RWMutex
+	active   runtimeConfig
+	loadedAt time.Time
+}
+
+// reload loads the runtime configuration and applies it, all at once. The current configuration is kept if this fails.
+func (r *configReloader) reload() error {
+	c, err := loadRuntimeConfig(r.path, r.defaults)
+	if err != nil {
+		return err
+	}
+	routes, err := r.routes.get(c.RoutingTopics)
+	if err != nil {
+		return err
+	}
+	settings, err := c.settings(routes)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings.Store(settings)
+	r.active = c
+	r.loadedAt = time.Now().UTC()
+	return nil
+}
+
+// watch reloads the runtime configuration every time its file changes, until stop is closed.
+func (r *configReloader) watch(stop <-chan struct{}, interval time.Duration) error {
+	w, err := filewatch.NewWatcher([]string{r.path}, interval, r.log)
+	if err != nil {
+		return err
+	}
+
+	w.Run(stop, func() {
+		if err := r.reload(); err != nil {
+			r.log.WithError(err).Error("Could not reload the runtime configuration, the previous one is still in use")
+			return
+		}
+		r.log.Info("Reloaded the runtime configuration")
+	})
+	return nil
+}
+
+type activeConfigResponse struct {
+	File     string        `json:"file,omitempty"`
+	LoadedAt time.Time     `json:"loadedAt"`
+	Config   runtimeConfig `json:"config"`
+}
+
+// getConfig returns the active runtime configuration, with the secrets redacted.
+func (r *configReloader) getConfig(w http.ResponseWriter, _ *http.Request) {
+	r.mu.RLock()
+	response := activeConfigResponse{
+		File:     r.path,
+		LoadedAt: r.loadedAt,
+		Config:   r.active.redacted(),
+	}
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		r.log.WithError(err).Error("Failed to write the runtime configuration")
+	}
+}
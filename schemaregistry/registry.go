@@ -0,0 +1,177 @@
+package schemaregistry
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/Financial-Times/post-publication-combiner/v2/httputils"
+)
+
+const (
+	// magicByte prefixes every message encoded in the schema registry wire format.
+	magicByte byte = 0
+	// wireFormatHeaderBytes is the length of the magic byte and the schema ID preceding the payload.
+	wireFormatHeaderBytes = 5
+)
+
+var (
+	ErrSchemaNotFound    = errors.New("schema not found")
+	ErrInvalidWireFormat = errors.New("invalid schema registry wire format")
+)
+
+type Schema struct {
+	ID      int    `json:"id"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+	Schema  string `json:"schema"`
+}
+
+type Registry interface {
+	LatestSchema(subject string) (*Schema, error)
+	SchemaByID(id int) (*Schema, error)
+}
+
+// TopicSubject returns the subject name under which the schema of the messages in the given topic is registered.
+func TopicSubject(topic string) string {
+	return topic + "-value"
+}
+
+// EncodeWireFormat prefixes the payload with the magic byte and the big-endian schema ID.
+func EncodeWireFormat(schemaID int, payload []byte) []byte {
+	b := make([]byte, wireFormatHeaderBytes, wireFormatHeaderBytes+len(payload))
+	b[0] = magicByte
+	binary.BigEndian.PutUint32(b[1:], uint32(schemaID))
+	return append(b, payload...)
+}
+
+// DecodeWireFormat returns the schema ID and the payload of a message encoded with EncodeWireFormat.
+func DecodeWireFormat(b []byte) (int, []byte, error) {
+	if len(b) < wireFormatHeaderBytes || b[0] != magicByte {
+		return 0, nil, ErrInvalidWireFormat
+	}
+	return int(binary.BigEndian.Uint32(b[1:wireFormatHeaderBytes])), b[wireFormatHeaderBytes:], nil
+}
+
+// Client reads schemas from a Confluent compatible schema registry.
+type Client struct {
+	baseURL string
+	client  httputils.Client
+}
+
+func NewClient(baseURL string, client httputils.Client) *Client {
+	return &Client{
+		baseURL: baseURL,
+		client:  client,
+	}
+}
+
+func (c *Client) LatestSchema(subject string) (*Schema, error) {
+	b, err := c.get(fmt.Sprintf("%s/subjects/%s/versions/latest", c.baseURL, url.PathEscape(subject)))
+	if err != nil {
+		return nil, err
+	}
+
+	var s Schema
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("error unmarshalling schema for subject %q: %w", subject, err)
+	}
+
+	return &s, nil
+}
+
+func (c *Client) SchemaByID(id int) (*Schema, error) {
+	b, err := c.get(fmt.Sprintf("%s/schemas/ids/%d", c.baseURL, id))
+	if err != nil {
+		return nil, err
+	}
+
+	s := Schema{ID: id}
+	if err = json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("error unmarshalling schema with id %d: %w", id, err)
+	}
+
+	return &s, nil
+}
+
+func (c *Client) get(uri string) ([]byte, error) {
+	b, err := httputils.ExecuteRequest(uri, c.client)
+	if err != nil {
+		var codeError *httputils.StatusCodeError
+		if errors.As(err, &codeError) && codeError.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %w", ErrSchemaNotFound, err)
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// FileRegistry is a read-only registry backed by a local index file,
+// meant to stand in for the schema registry in tests and local runs.
+//
+// The index lists the registered schemas, each pointing to an Avro schema file relative to the index:
+//
+//	{"schemas": [{"id": 1, "subject": "CombinedPostPublicationEvents-value", "version": 1, "file": "combined.avsc"}]}
+type FileRegistry struct {
+	byID      map[int]*Schema
+	bySubject map[string]*Schema
+}
+
+func NewFileRegistry(indexPath string) (*FileRegistry, error) {
+	b, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema registry index: %w", err)
+	}
+
+	var index struct {
+		Schemas []struct {
+			ID      int    `json:"id"`
+			Subject string `json:"subject"`
+			Version int    `json:"version"`
+			File    string `json:"file"`
+		} `json:"schemas"`
+	}
+	if err = json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("error unmarshalling schema registry index: %w", err)
+	}
+
+	r := &FileRegistry{
+		byID:      map[int]*Schema{},
+		bySubject: map[string]*Schema{},
+	}
+	for _, e := range index.Schemas {
+		schema, err := os.ReadFile(filepath.Join(filepath.Dir(indexPath), e.File))
+		if err != nil {
+			return nil, fmt.Errorf("error reading schema %d: %w", e.ID, err)
+		}
+
+		s := &Schema{ID: e.ID, Subject: e.Subject, Version: e.Version, Schema: string(schema)}
+		r.byID[s.ID] = s
+		if latest, ok := r.bySubject[s.Subject]; !ok || latest.Version < s.Version {
+			r.bySubject[s.Subject] = s
+		}
+	}
+
+	return r, nil
+}
+
+func (r *FileRegistry) LatestSchema(subject string) (*Schema, error) {
+	s, ok := r.bySubject[subject]
+	if !ok {
+		return nil, fmt.Errorf("%w: subject %q", ErrSchemaNotFound, subject)
+	}
+	return s, nil
+}
+
+func (r *FileRegistry) SchemaByID(id int) (*Schema, error) {
+	s, ok := r.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+	}
+	return s, nil
+}
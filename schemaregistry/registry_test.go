@@ -0,0 +1,77 @@
+package schemaregistry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWireFormat(t *testing.T) {
+	b := EncodeWireFormat(258, []byte("payload"))
+	assert.Equal(t, []byte{0, 0, 0, 1, 2, 'p', 'a', 'y', 'l', 'o', 'a', 'd'}, b)
+
+	id, payload, err := DecodeWireFormat(b)
+	require.NoError(t, err)
+	assert.Equal(t, 258, id)
+	assert.Equal(t, []byte("payload"), payload)
+}
+
+func TestDecodeWireFormat_Errors(t *testing.T) {
+	for _, b := range [][]byte{nil, {0, 0, 1}, {1, 0, 0, 0, 1, 'x'}} {
+		_, _, err := DecodeWireFormat(b)
+		assert.ErrorIs(t, err, ErrInvalidWireFormat)
+	}
+}
+
+func TestFileRegistry(t *testing.T) {
+	r, err := NewFileRegistry("./schemas/registry.json")
+	require.NoError(t, err)
+
+	latest, err := r.LatestSchema(TopicSubject("CombinedPostPublicationEvents"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, latest.ID)
+	assert.Contains(t, latest.Schema, "CombinedPostPublicationEvent")
+
+	byID, err := r.SchemaByID(1)
+	require.NoError(t, err)
+	assert.Equal(t, latest.Schema, byID.Schema)
+
+	_, err = r.LatestSchema("unknown-value")
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+
+	_, err = r.SchemaByID(42)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
+
+func TestNewFileRegistry_Missing_Index(t *testing.T) {
+	_, err := NewFileRegistry("./schemas/missing.json")
+	assert.Error(t, err)
+}
+
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/subjects/CombinedPostPublicationEvents-value/versions/latest", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"subject":"CombinedPostPublicationEvents-value","version":3,"id":7,"schema":"\"string\""}`))
+	})
+	mux.HandleFunc("/schemas/ids/7", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"schema":"\"string\""}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := NewClient(server.URL, http.DefaultClient)
+
+	latest, err := c.LatestSchema(TopicSubject("CombinedPostPublicationEvents"))
+	require.NoError(t, err)
+	assert.Equal(t, &Schema{ID: 7, Subject: "CombinedPostPublicationEvents-value", Version: 3, Schema: `"string"`}, latest)
+
+	byID, err := c.SchemaByID(7)
+	require.NoError(t, err)
+	assert.Equal(t, &Schema{ID: 7, Schema: `"string"`}, byID)
+
+	_, err = c.SchemaByID(8)
+	assert.ErrorIs(t, err, ErrSchemaNotFound)
+}
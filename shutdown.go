@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+type closer interface {
+	Close() error
+}
+
+type shutdownPhase struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type namedCloser struct {
+	name   string
+	closer closer
+}
+
+// gracefulShutdown runs the phases of the shutdown in the order they were added, all of them sharing the same deadline.
+type gracefulShutdown struct {
+	log     *logger.UPPLogger
+	timeout time.Duration
+	phases  []shutdownPhase
+
+	// The producers of the routing topics can be created by the reloads of the runtime configuration at any time.
+	mu        sync.Mutex
+	producers []namedCloser
+}
+
+func newGracefulShutdown(log *logger.UPPLogger, timeout time.Duration) *gracefulShutdown {
+	return &gracefulShutdown{
+		log:     log,
+		timeout: timeout,
+	}
+}
+
+func (s *gracefulShutdown) add(name string, run func(ctx context.Context) error) {
+	s.phases = append(s.phases, shutdownPhase{name: name, run: run})
+}
+
+// closeOnExit registers a producer to be closed, and flushed, by closeProducers.
+func (s *gracefulShutdown) closeOnExit(name string, c closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.producers = append(s.producers, namedCloser{name: name, closer: c})
+}
+
+// closeProducers closes all the registered producers, even after the deadline, so that the sent messages are flushed.
+func (s *gracefulShutdown) closeProducers(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, p := range s.producers {
+		s.log.Infof("[Shutdown] Closing %s", p.name)
+		if err := p.closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s could not stop: %w", p.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// run executes the phases one after the other. Failed phases, including the ones which exceeded the deadline,
+// are logged and the shutdown carries on with the next phase.
+func (s *gracefulShutdown) run() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	s.log.Infof("[Shutdown] PostPublicationCombiner is shutting down, with a deadline of %s", s.timeout)
+	for _, p := range s.phases {
+		start := time.Now()
+		s.log.Infof("[Shutdown] %s", p.name)
+		if err := p.run(ctx); err != nil {
+			s.log.WithError(err).Errorf("[Shutdown] %s failed after %s", p.name, time.Since(start).Round(time.Millisecond))
+			continue
+		}
+		s.log.Infof("[Shutdown] %s finished in %s", p.name, time.Since(start).Round(time.Millisecond))
+	}
+	s.log.Infof("[Shutdown] PostPublicationCombiner has shut down")
+}
+
+// waitFor waits until done is closed or the context is done.
+func waitFor(ctx context.Context, done <-chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCloser struct {
+	name   string
+	err    error
+	closed *[]string
+}
+
+func (c mockCloser) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return c.err
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	var calls []string
+	s := newGracefulShutdown(logger.NewUPPLogger("TEST", "PANIC"), 10*time.Millisecond)
+
+	s.add("first", func(context.Context) error {
+		calls = append(calls, "first")
+		return errors.New("first failed")
+	})
+	s.add("waiting", func(ctx context.Context) error {
+		calls = append(calls, "waiting")
+		err := waitFor(ctx, make(chan struct{}))
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		return err
+	})
+	s.closeOnExit("producer", mockCloser{name: "producer", closed: &calls})
+	s.closeOnExit("failing producer", mockCloser{name: "failing producer", err: errors.New("close error"), closed: &calls})
+	s.closeOnExit("other producer", mockCloser{name: "other producer", closed: &calls})
+	s.add("closing", func(ctx context.Context) error {
+		err := s.closeProducers(ctx)
+		assert.EqualError(t, err, "failing producer could not stop: close error")
+		return err
+	})
+
+	s.run()
+
+	assert.Equal(t, []string{"first", "waiting", "producer", "failing producer", "other producer"}, calls,
+		"the phases run in order, carrying on after failures and the deadline")
+}
+
+func TestWaitFor(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	assert.NoError(t, waitFor(context.Background(), done))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, waitFor(ctx, make(chan struct{})), context.Canceled)
+}